@@ -6,6 +6,6 @@ import (
 )
 
 func main() {
-	ctx := kong.Parse(&agent.Cmd)
+	ctx := kong.Parse(&agent.Cmd, kong.Configuration(agent.LoadConfig, agent.DefaultConfigFiles...))
 	ctx.FatalIfErrorf(ctx.Run())
 }
@@ -1,11 +1,23 @@
 package main
 
 import (
+	"errors"
+	"os"
+
 	"github.com/alecthomas/kong"
+	"github.com/numtide/nits/internal/cmd"
 	"github.com/numtide/nits/internal/cmd/cli"
 )
 
 func main() {
 	ctx := kong.Parse(&cli.Cmd)
-	ctx.FatalIfErrorf(ctx.Run())
+
+	err := ctx.Run()
+
+	var exit *cmd.ExitCodeError
+	if errors.As(err, &exit) {
+		os.Exit(exit.Code)
+	}
+
+	ctx.FatalIfErrorf(err)
 }
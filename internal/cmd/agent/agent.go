@@ -1,13 +1,53 @@
 package agent
 
 import (
+	"time"
+
+	"github.com/alecthomas/kong"
+
+	"github.com/numtide/nits/internal/cmd"
+	"github.com/numtide/nits/pkg/agent/command"
+	"github.com/numtide/nits/pkg/agent/files"
+	"github.com/numtide/nits/pkg/agent/forward"
+	"github.com/numtide/nits/pkg/agent/health"
+	"github.com/numtide/nits/pkg/agent/info"
+	"github.com/numtide/nits/pkg/agent/journal"
+	"github.com/numtide/nits/pkg/agent/metrics"
+	"github.com/numtide/nits/pkg/agent/nixos"
+	"github.com/numtide/nits/pkg/agent/secrets"
+	"github.com/numtide/nits/pkg/agent/shell"
+	"github.com/numtide/nits/pkg/agent/systemd"
 	"github.com/numtide/nits/pkg/nats"
 )
 
+type spoolOptions struct {
+	Dir      string        `env:"SPOOL_DIR" help:"Directory in which to spool logs whilst disconnected. Spooling is disabled when empty."`
+	MaxBytes cmd.ByteSize  `env:"SPOOL_MAX_BYTES" default:"64MiB" help:"Maximum size of the spool, the oldest entries are discarded first."`
+	MaxAge   time.Duration `env:"SPOOL_MAX_AGE" default:"168h" help:"Maximum age of spooled entries."`
+}
+
 var Cmd struct {
-	Nats     nats.CliOptions `embed:"" prefix:"nats-"`
-	LogLevel string          `enum:"debug,info,warn,error,fatal" env:"LOG_LEVEL" default:"warn" help:"Configure logging level."`
+	Config    kong.ConfigFlag       `type:"existingfile" placeholder:"FILE" help:"JSON or TOML file (by .toml extension) from which to read settings. Flags and environment variables take precedence."`
+	Labels    map[string]string     `env:"LABELS" placeholder:"KEY=VALUE" help:"Labels describing the agent, by which it can be selected. Labels assigned to the agent centrally take precedence."`
+	Nats      nats.CliOptions       `embed:"" prefix:"nats-"`
+	Heartbeat info.HeartbeatOptions `embed:"" prefix:"heartbeat-"`
+	Health    health.Options        `embed:"" prefix:"health-"`
+	Nixos     nixos.Options         `embed:"" prefix:"nixos-"`
+	Journal   journal.Options       `embed:"" prefix:"journal-"`
+	Metrics   metrics.Options       `embed:"" prefix:"metrics-"`
+	Systemd   systemd.Options       `embed:"" prefix:"systemd-"`
+	Exec      command.Options       `embed:"" prefix:"exec-"`
+	Shell     shell.Options         `embed:"" prefix:"shell-"`
+	Forward   forward.Options       `embed:"" prefix:"forward-"`
+	Files     files.Options         `embed:"" prefix:"files-"`
+	Secrets   secrets.Options       `embed:"" prefix:"secrets-"`
+	Spool     spoolOptions          `embed:"" prefix:"spool-"`
+	LogLevel  string                `enum:"debug,info,warn,error,fatal" env:"LOG_LEVEL" default:"warn" help:"Configure logging level."`
 
 	Run  runCmd  `cmd:"" help:"Run an agent." default:"1"`
 	Nkey nkeyCmd `cmd:"" help:"Produce a User NKey from an ed25519 key"`
+
+	ConfigCmd struct {
+		Check configCheckCmd `cmd:"" help:"Validate the configuration and print the effective settings."`
+	} `cmd:"" name:"config" help:"Configuration related functions"`
 }
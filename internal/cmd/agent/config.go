@@ -0,0 +1,196 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/alecthomas/kong"
+	"github.com/juju/errors"
+	"github.com/numtide/nits/pkg/agent"
+)
+
+// DefaultConfigFiles are loaded when present, in addition to any file given with --config.
+var DefaultConfigFiles = []string{"/etc/nits/agent.json", "/etc/nits/agent.toml"}
+
+// configResolver resolves flags from a JSON or TOML configuration file. Flags may be given by name e.g. "nats-url", or
+// grouped into sections by their prefix e.g. {"nats": {"url": "..."}} or a [nats] table. Underscores may be used in
+// place of dashes. Flags which are maps, such as labels, take a section of their own e.g. {"labels": {"role": "db"}},
+// whose keys are used as is.
+//
+// Values from the file take precedence over defaults but not over flags or environment variables.
+type configResolver map[string]any
+
+// LoadConfig is a kong.ConfigurationLoader for agent configuration files. Files ending in .toml are parsed as TOML,
+// anything else as JSON.
+func LoadConfig(r io.Reader) (kong.Resolver, error) {
+	if named, ok := r.(interface{ Name() string }); ok && filepath.Ext(named.Name()) == ".toml" {
+		return LoadTOMLConfig(r)
+	}
+	return LoadJSONConfig(r)
+}
+
+// LoadJSONConfig is a kong.ConfigurationLoader for agent configuration files in JSON.
+func LoadJSONConfig(r io.Reader) (kong.Resolver, error) {
+	values := make(map[string]any)
+	if err := json.NewDecoder(r).Decode(&values); err != nil {
+		return nil, errors.Annotate(err, "failed to parse config")
+	}
+	return newConfigResolver(values), nil
+}
+
+// LoadTOMLConfig is a kong.ConfigurationLoader for agent configuration files in TOML.
+func LoadTOMLConfig(r io.Reader) (kong.Resolver, error) {
+	values := make(map[string]any)
+	if _, err := toml.NewDecoder(r).Decode(&values); err != nil {
+		return nil, errors.Annotate(err, "failed to parse config")
+	}
+	return newConfigResolver(values), nil
+}
+
+func newConfigResolver(values map[string]any) configResolver {
+	resolver := make(configResolver)
+	resolver.flatten("", values)
+	return resolver
+}
+
+func (c configResolver) flatten(prefix string, values map[string]any) {
+	for key, value := range values {
+		name := strings.ReplaceAll(key, "_", "-")
+		if prefix != "" {
+			name = prefix + "-" + name
+		}
+		if section, ok := value.(map[string]any); ok {
+			// the section is kept whole in case it is the value of a map flag
+			c[name] = section
+			c.flatten(name, section)
+		} else {
+			c[name] = value
+		}
+	}
+}
+
+// Validate ensures every key in the file corresponds to a flag, so that typos are not silently ignored.
+func (c configResolver) Validate(app *kong.Application) error {
+	known := make(map[string]bool)
+	var maps []string
+	_ = kong.Visit(app.Node, func(node kong.Visitable, next kong.Next) error {
+		if flag, ok := node.(*kong.Flag); ok {
+			known[flag.Name] = true
+			if flag.IsMap() {
+				maps = append(maps, flag.Name+"-")
+			}
+		}
+		return next(nil)
+	})
+
+	var unknown []string
+	for name, value := range c {
+		if known[name] {
+			continue
+		} else if _, ok := value.(map[string]any); ok {
+			// a section, the entries of which are checked in turn
+			continue
+		} else if slices.ContainsFunc(maps, func(prefix string) bool { return strings.HasPrefix(name, prefix) }) {
+			// an entry within the value of a map flag
+			continue
+		}
+		unknown = append(unknown, name)
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return errors.Errorf("unknown config keys: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+func (c configResolver) Resolve(_ *kong.Context, _ *kong.Path, flag *kong.Flag) (any, error) {
+	// kong applies resolvers after environment variables, which should take precedence. Empty variables are treated as
+	// unset, since that is how the NixOS module passes list options which have not been configured.
+	for _, env := range flag.Envs {
+		if os.Getenv(env) != "" {
+			return nil, nil
+		}
+	}
+	value := c[flag.Name]
+	if _, ok := value.(map[string]any); ok && !flag.IsMap() {
+		// a section which happens to share its name with a flag
+		return nil, nil
+	}
+	return value, nil
+}
+
+// validateOptions checks the options for each service, beyond what can be expressed with kong tags.
+func validateOptions() error {
+	for _, opts := range []struct {
+		name string
+		opts interface{ Validate() error }
+	}{
+		{"health", &Cmd.Health},
+		{"nixos", &Cmd.Nixos},
+		{"systemd", &Cmd.Systemd},
+		{"exec", &Cmd.Exec},
+		{"forward", &Cmd.Forward},
+		{"files", &Cmd.Files},
+		{"secrets", &Cmd.Secrets},
+	} {
+		if err := opts.opts.Validate(); err != nil {
+			return errors.Annotate(err, opts.name)
+		}
+	}
+	for key := range Cmd.Labels {
+		if err := agent.ValidateLabelKey(key); err != nil {
+			return errors.Annotate(err, "labels")
+		}
+	}
+	return nil
+}
+
+type configCheckCmd struct {
+	Format string `enum:"json,toml" default:"json" help:"Format in which to print the effective settings, one of json or toml."`
+}
+
+func (c *configCheckCmd) Run(ctx *kong.Context) error {
+	if err := validateOptions(); err != nil {
+		return err
+	}
+
+	// print the effective settings in a form which can itself be used as a config file
+	settings := make(map[string]any)
+	for _, flag := range ctx.Flags() {
+		if flag.Name == "help" || flag.Name == "config" {
+			continue
+		}
+		if kind := flag.Target.Kind(); (kind == reflect.String || kind == reflect.Slice || kind == reflect.Map) && flag.Target.Len() == 0 {
+			// unset paths in particular cannot be read back, as they would be resolved relative to the working dir
+			continue
+		}
+
+		value := flag.Target.Interface()
+		if stringer, ok := value.(fmt.Stringer); ok {
+			// durations and sizes are otherwise rendered as plain numbers
+			value = stringer.String()
+		}
+		settings[flag.Name] = value
+	}
+
+	if c.Format == "toml" {
+		return toml.NewEncoder(os.Stdout).Encode(settings)
+	}
+
+	b, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(b))
+	return nil
+}
@@ -8,10 +8,15 @@ import (
 
 	"github.com/numtide/nits/internal/cmd"
 	"github.com/numtide/nits/pkg/agent"
+	"github.com/numtide/nits/pkg/nats"
 )
 
 type runCmd struct{}
 
+func (a *runCmd) Validate() error {
+	return validateOptions()
+}
+
 func (a *runCmd) Run() (err error) {
 	level, err := log.ParseLevel(Cmd.LogLevel)
 	if err != nil {
@@ -26,7 +31,26 @@ func (a *runCmd) Run() (err error) {
 	log.SetTimeFormat(time.RFC3339)
 
 	return cmd.Run(func(ctx context.Context) (err error) {
+		if Cmd.Spool.Dir != "" {
+			if agent.Spool, err = nats.NewSpool(Cmd.Spool.Dir, int64(Cmd.Spool.MaxBytes), Cmd.Spool.MaxAge); err != nil {
+				return
+			}
+		}
+
+		agent.LogLevel = Cmd.LogLevel
+		agent.Labels = Cmd.Labels
 		agent.NatsOptions = &Cmd.Nats
+		agent.HeartbeatOptions = &Cmd.Heartbeat
+		agent.HealthOptions = &Cmd.Health
+		agent.NixosOptions = &Cmd.Nixos
+		agent.JournalOptions = &Cmd.Journal
+		agent.MetricsOptions = &Cmd.Metrics
+		agent.SystemdOptions = &Cmd.Systemd
+		agent.ExecOptions = &Cmd.Exec
+		agent.ShellOptions = &Cmd.Shell
+		agent.ForwardOptions = &Cmd.Forward
+		agent.FilesOptions = &Cmd.Files
+		agent.SecretsOptions = &Cmd.Secrets
 		return agent.Run(ctx)
 	})
 }
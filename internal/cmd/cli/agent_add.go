@@ -13,6 +13,7 @@ import (
 	nexec "github.com/numtide/nits/pkg/exec"
 	nutil "github.com/numtide/nits/pkg/nats"
 
+	"github.com/numtide/nits/pkg/agent/config"
 	"github.com/numtide/nits/pkg/subject"
 
 	"github.com/juju/errors"
@@ -71,7 +72,6 @@ func (a *agentAdd) Run() (err error) {
 		return
 	}
 
-	agentSubject := fmt.Sprintf("NITS.AGENT.%s.>", nkey)
 	agentByName := subject.AgentWithName(a.Name)
 	agentInfoService := subject.AgentService(nkey, "INFO")
 
@@ -91,23 +91,54 @@ func (a *agentAdd) Run() (err error) {
 
 	log.Info("adding an agent user", "operator", op.Name, "account", a.Cluster, "name", a.Name)
 
-	nsc = cmd.LogExec(
-		nexec.Nsc(
-			"add", "user", "-a", a.Cluster,
-			"-k", nkey,
-			"-n", a.Name,
-			"--allow-pubsub", agentSubject,
-			"--allow-pub", subject.AgentRegistration(nkey),
-			"--allow-pub", "$JS.API.STREAM.NAMES",
-			"--allow-sub", "$SRV.>",
-			"--allow-pub", "_INBOX.>",
-		),
-	)
+	args := []string{"add", "user", "-a", a.Cluster, "-k", nkey, "-n", a.Name}
+	nsc = cmd.LogExec(nexec.Nsc(append(args, agentPermissions(nkey)...)...))
 
 	if _, err = nsc.Output(); err != nil {
 		nexec.LogError("failed to add agent user", err)
 		return
 	}
 
-	return
+	return render(struct {
+		Name    string `json:"name"`
+		NKey    string `json:"nkey"`
+		Cluster string `json:"cluster"`
+	}{a.Name, nkey, a.Cluster}, nil)
+}
+
+// agentPermissions returns the nsc arguments which grant an agent user with the given nkey everything it needs. They are
+// applied when adding an agent, and again by agent update for agents which were added by an earlier version.
+func agentPermissions(nkey string) []string {
+	filesBucket := subject.AgentFilesBucket(nkey)
+	filesStream := "OBJ_" + filesBucket
+	secretsStream := "KV_" + subject.AgentSecretsBucket
+	configStream := "KV_" + subject.AgentConfigBucket
+
+	return []string{
+		"--allow-pubsub", subject.AgentWithNKey(nkey) + ".>",
+		"--allow-pub", subject.AgentRegistration(nkey),
+		"--allow-pub", "$JS.API.STREAM.NAMES",
+		"--allow-sub", "$SRV.>",
+		"--allow-pub", "_INBOX.>",
+		// access to this agent's own object store used for file transfers
+		"--allow-pub", fmt.Sprintf("$O.%s.>", filesBucket),
+		"--allow-pub", "$JS.API.STREAM.INFO." + filesStream,
+		"--allow-pub", "$JS.API.STREAM.MSG.GET." + filesStream,
+		"--allow-pub", "$JS.API.STREAM.PURGE." + filesStream,
+		"--allow-pub", "$JS.API.DIRECT.GET." + filesStream + ".>",
+		"--allow-pub", "$JS.API.CONSUMER.CREATE." + filesStream + ".>",
+		"--allow-pub", "$JS.API.CONSUMER.DELETE." + filesStream + ".>",
+		"--allow-pub", "$JS.FC." + filesStream + ".>",
+		// read only access to the settings for this agent and the defaults for every agent
+		"--allow-pub", "$JS.API.STREAM.INFO." + configStream,
+		"--allow-pub", fmt.Sprintf("$JS.API.CONSUMER.CREATE.%s.*.$KV.%s.%s", configStream, subject.AgentConfigBucket, nkey),
+		"--allow-pub", fmt.Sprintf("$JS.API.CONSUMER.CREATE.%s.*.$KV.%s.%s", configStream, subject.AgentConfigBucket, config.DefaultKey),
+		"--allow-pub", "$JS.API.CONSUMER.DELETE." + configStream + ".>",
+		"--allow-pub", "$JS.FC." + configStream + ".>",
+		// read only access to the secrets sealed for this agent
+		"--allow-pub", "$JS.API.STREAM.INFO." + secretsStream,
+		"--allow-pub", fmt.Sprintf("$JS.API.CONSUMER.CREATE.%s.*.$KV.%s.%s.>", secretsStream, subject.AgentSecretsBucket, nkey),
+		"--allow-pub", "$JS.API.CONSUMER.DELETE." + secretsStream + ".>",
+		"--allow-pub", "$JS.FC." + secretsStream + ".>",
+	}
 }
@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/internal/cmd"
+	"github.com/numtide/nits/pkg/agent/config"
+	nnats "github.com/numtide/nits/pkg/nats"
+)
+
+type agentConfigGet struct {
+	Nats nnats.CliOptions `embed:"" prefix:"nats-"`
+
+	Name string `arg:"" help:"Name, nkey or nkey prefix of the agent, or default for settings which apply to every agent"`
+}
+
+func (g *agentConfigGet) Run() error {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	return cmd.Run(func(ctx context.Context) (err error) {
+		var (
+			conn     *nats.Conn
+			key      string
+			settings *config.Settings
+		)
+
+		if conn, err = g.Nats.Connect(); err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if key, err = resolveConfigKey(ctx, conn, g.Name); err != nil {
+			return
+		} else if settings, err = config.Get(conn, key); err != nil {
+			return
+		}
+
+		return render(settings, func() {
+			printSettings(settings)
+		})
+	})
+}
+
+type agentConfigSet struct {
+	Nats nnats.CliOptions `embed:"" prefix:"nats-"`
+
+	Name     string   `arg:"" help:"Name, nkey or nkey prefix of the agent, or default for settings which apply to every agent"`
+	Settings []string `arg:"" help:"Settings in the form key=value e.g. log-level=debug or heartbeat-interval=10s"`
+}
+
+func (s *agentConfigSet) Run() error {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	values := make(map[string]string, len(s.Settings))
+	for _, setting := range s.Settings {
+		key, value, ok := strings.Cut(setting, "=")
+		if !ok {
+			return errors.Errorf("setting '%s' must be in the form key=value", setting)
+		}
+		values[key] = value
+	}
+
+	return updateSettings(&s.Nats, s.Name, func(settings *config.Settings) error {
+		for key, value := range values {
+			if err := settings.Set(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type agentConfigUnset struct {
+	Nats nnats.CliOptions `embed:"" prefix:"nats-"`
+
+	Name string   `arg:"" help:"Name, nkey or nkey prefix of the agent, or default for settings which apply to every agent"`
+	Keys []string `arg:"" help:"Keys of the settings to remove, reverting to the default or local configuration"`
+}
+
+func (u *agentConfigUnset) Run() error {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	return updateSettings(&u.Nats, u.Name, func(settings *config.Settings) error {
+		for _, key := range u.Keys {
+			if err := settings.Unset(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// resolveConfigKey returns the key under which settings for the named agent are stored.
+func resolveConfigKey(ctx context.Context, conn *nats.Conn, name string) (string, error) {
+	if name == config.DefaultKey {
+		return config.DefaultKey, nil
+	}
+	return resolveNKey(ctx, conn, name)
+}
+
+func updateSettings(opts *nnats.CliOptions, name string, fn func(settings *config.Settings) error) error {
+	return cmd.Run(func(ctx context.Context) (err error) {
+		var (
+			conn     *nats.Conn
+			key      string
+			settings *config.Settings
+		)
+
+		if conn, err = opts.Connect(); err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if key, err = resolveConfigKey(ctx, conn, name); err != nil {
+			return
+		} else if settings, err = config.Update(conn, key, fn); err != nil {
+			return
+		}
+
+		log.Info("updated agent config", "key", key, "settings", settings)
+
+		return render(struct {
+			Key string `json:"key"`
+			*config.Settings
+		}{key, settings}, nil)
+	})
+}
+
+func printSettings(settings *config.Settings) {
+	var values map[string]any
+	if b, err := json.Marshal(settings); err != nil {
+		return
+	} else if err = json.Unmarshal(b, &values); err != nil {
+		return
+	}
+
+	for _, key := range config.Keys() {
+		if value, ok := values[key]; ok {
+			kvPrintln(key+":", fmt.Sprint(value))
+		}
+	}
+}
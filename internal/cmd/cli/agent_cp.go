@@ -0,0 +1,278 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/dustin/go-humanize"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/internal/cmd"
+	"github.com/numtide/nits/pkg/agent/files"
+	"github.com/numtide/nits/pkg/agent/info"
+	nnats "github.com/numtide/nits/pkg/nats"
+)
+
+type agentCopy struct {
+	Nats        nnats.CliOptions `embed:"" prefix:"nats-"`
+	Source      string           `arg:"" help:"File to copy, either a local path or <agent>:<path>."`
+	Destination string           `arg:"" help:"Where to copy the file to, either a local path or <agent>:<path>."`
+
+	Mode    string        `help:"Octal mode for a file copied to an agent e.g. 0600. Defaults to that of the source file."`
+	Owner   string        `help:"Owner of a file copied to an agent."`
+	Group   string        `help:"Group of a file copied to an agent."`
+	Timeout time.Duration `default:"30m" help:"How long to wait for the agent to transfer the file."`
+}
+
+// copySummary describes a completed copy.
+type copySummary struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Size        int64  `json:"size"`
+	Digest      string `json:"digest"`
+}
+
+// splitRemote splits an <agent>:<path> argument, returning an empty name for a local path.
+func splitRemote(arg string) (name string, path string) {
+	if name, path, ok := strings.Cut(arg, ":"); ok && name != "" && !strings.Contains(name, "/") {
+		return name, path
+	}
+	return "", arg
+}
+
+func (c *agentCopy) Run() error {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	srcName, srcPath := splitRemote(c.Source)
+	dstName, dstPath := splitRemote(c.Destination)
+
+	if (srcName == "") == (dstName == "") {
+		return errors.New("exactly one of the source and destination must be on an agent, in the form <agent>:<path>")
+	}
+
+	name := srcName
+	if name == "" {
+		name = dstName
+	}
+
+	var mode os.FileMode
+	if c.Mode != "" {
+		value, err := strconv.ParseUint(c.Mode, 8, 32)
+		if err != nil {
+			return errors.Annotatef(err, "invalid mode %q", c.Mode)
+		}
+		mode = os.FileMode(value)
+	}
+
+	return cmd.Run(func(ctx context.Context) (err error) {
+		var (
+			conn    *nats.Conn
+			encoded *nats.EncodedConn
+			obs     nats.ObjectStore
+			target  *info.Response
+		)
+
+		if conn, err = c.Nats.Connect(); err != nil {
+			return
+		} else if encoded, err = nats.NewEncodedConn(conn, nats.JSON_ENCODER); err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if target, err = resolveOnline(ctx, conn, name); err != nil {
+			return
+		} else if obs, err = filesBucket(conn, target.NKey); err != nil {
+			return errors.Annotate(err, "failed to open the files object store")
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+
+		var summary *copySummary
+		if srcName != "" {
+			summary, err = c.download(ctx, encoded, obs, target, srcPath, dstPath)
+		} else {
+			summary, err = c.upload(ctx, encoded, obs, target, srcPath, dstPath, mode)
+		}
+
+		if err != nil {
+			return
+		}
+
+		return render(summary, func() {
+			println(fmt.Sprintf("Copied %s to %s (%s)", summary.Source, summary.Destination, humanize.IBytes(uint64(summary.Size))))
+		})
+	})
+}
+
+func (c *agentCopy) download(
+	ctx context.Context,
+	conn *nats.EncodedConn,
+	obs nats.ObjectStore,
+	target *info.Response,
+	src string,
+	dst string,
+) (summary *copySummary, err error) {
+	log.Info("requesting file from agent", "name", target.Name, "path", src)
+
+	var m *files.Manifest
+	if m, err = files.GetWithContext(ctx, conn, target.NKey, files.GetRequest{Path: src}); err != nil {
+		return
+	}
+
+	// copying into a directory
+	if stat, statErr := os.Stat(dst); (statErr == nil && stat.IsDir()) || strings.HasSuffix(dst, string(os.PathSeparator)) {
+		dst = filepath.Join(dst, filepath.Base(src))
+	}
+
+	// keep the partial file between attempts so that an interrupted copy can resume
+	partial := dst + ".nits-partial"
+
+	var f *os.File
+	if f, err = os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0o600); err != nil {
+		return
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	log.Info("downloading file", "id", m.Id, "size", humanize.IBytes(uint64(m.Size)), "parts", len(m.Parts))
+
+	if err = files.Download(ctx, obs, m, f, c.progress(m.Size)); errors.Is(err, files.ErrCorrupt) {
+		_ = os.Remove(partial)
+		return
+	} else if err != nil {
+		return
+	} else if err = f.Chmod(m.Mode.Perm()); err != nil {
+		return
+	} else if err = os.Rename(partial, dst); err != nil {
+		return
+	}
+
+	if err := files.Remove(obs, m); err != nil {
+		log.Warn("failed to remove transfer from the object store", "id", m.Id, "error", err)
+	}
+
+	return &copySummary{
+		Source:      target.Name + ":" + src,
+		Destination: dst,
+		Size:        m.Size,
+		Digest:      m.Digest,
+	}, nil
+}
+
+func (c *agentCopy) upload(
+	ctx context.Context,
+	conn *nats.EncodedConn,
+	obs nats.ObjectStore,
+	target *info.Response,
+	src string,
+	dst string,
+	mode os.FileMode,
+) (summary *copySummary, err error) {
+	var (
+		f    *os.File
+		stat os.FileInfo
+		m    *files.Manifest
+		resp files.PutResponse
+	)
+
+	if src, err = filepath.Abs(src); err != nil {
+		return
+	} else if f, err = os.Open(src); err != nil {
+		return
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if stat, err = f.Stat(); err != nil {
+		return
+	}
+
+	// copying into a directory
+	if strings.HasSuffix(dst, "/") {
+		dst += filepath.Base(src)
+	}
+
+	id := files.TransferId(target.NKey, "put", src, dst, strconv.FormatInt(stat.Size(), 10), stat.ModTime().String())
+
+	if m, err = files.NewManifest(id, f); err != nil {
+		return
+	}
+
+	log.Info("uploading file", "id", m.Id, "size", humanize.IBytes(uint64(m.Size)), "parts", len(m.Parts))
+
+	if err = files.Upload(ctx, obs, m, f, c.progress(m.Size)); err != nil {
+		return
+	}
+
+	log.Info("requesting agent download the file", "name", target.Name, "path", dst)
+
+	req := files.PutRequest{
+		Id:    id,
+		Path:  dst,
+		Mode:  mode,
+		Owner: c.Owner,
+		Group: c.Group,
+	}
+
+	if resp, err = files.PutWithContext(ctx, conn, target.NKey, req); err != nil {
+		return
+	}
+
+	if err := files.Remove(obs, m); err != nil {
+		log.Warn("failed to remove transfer from the object store", "id", m.Id, "error", err)
+	}
+
+	return &copySummary{
+		Source:      src,
+		Destination: target.Name + ":" + resp.Path,
+		Size:        resp.Size,
+		Digest:      m.Digest,
+	}, nil
+}
+
+// progress returns a function which logs the progress of a transfer as each part completes.
+func (c *agentCopy) progress(total int64) func(n int64) {
+	var done int64
+	return func(n int64) {
+		done += n
+		log.Info("transfer progress", "done", humanize.IBytes(uint64(done)), "total", humanize.IBytes(uint64(total)))
+	}
+}
+
+// filesBucket returns the files object store for the agent with the given nkey, creating it if it does not exist. Its
+// limits are those of the template, until they are next applied by cluster update.
+func filesBucket(conn *nats.Conn, nkey string) (obs nats.ObjectStore, err error) {
+	if obs, err = files.Bucket(conn, nkey); !errors.Is(err, nats.ErrStreamNotFound) {
+		return
+	}
+
+	var (
+		js     nats.JetStreamContext
+		config *nats.StreamConfig
+	)
+
+	if js, err = conn.JetStream(); err != nil {
+		return
+	} else if config, err = filesStreamConfig(nkey); err != nil {
+		return
+	}
+
+	log.Debug("creating files object store", "name", config.Name)
+	if _, err = js.AddStream(config); err != nil {
+		return nil, errors.Annotate(err, "failed to create files object store")
+	}
+	return files.Bucket(conn, nkey)
+}
@@ -27,13 +27,15 @@ import (
 )
 
 type agentDeploy struct {
-	Nats nnats.CliOptions `embed:"" prefix:"nats-"`
+	Nats    nnats.CliOptions `embed:"" prefix:"nats-"`
+	Targets agentTargets     `embed:""`
 
 	Action  string `enum:"switch,boot,test,dry-activate" default:"switch" help:"action to perform on the agent" `
 	Closure string `arg:"" help:"store path of the NixOS closure to deploy"`
 
-	Output bool   `help:"output agent's stdout and stderr"`
-	Name   string `required:"" help:"the name given to the agent"`
+	IncludeOutput            bool   `help:"include the agent's stdout and stderr"`
+	IgnoreMaintenanceWindows bool   `help:"activate the configuration even if the agent is outside its maintenance windows"`
+	Name                     string `help:"the name, nkey or nkey prefix of the agent"`
 }
 
 func (d *agentDeploy) Run() error {
@@ -73,8 +75,9 @@ func (d *agentDeploy) Run() error {
 		}
 
 		req := nixos.DeployRequest{
-			Action:  action,
-			Closure: path,
+			Action:                   action,
+			Closure:                  path,
+			IgnoreMaintenanceWindows: d.IgnoreMaintenanceWindows,
 		}
 
 		var (
@@ -82,7 +85,7 @@ func (d *agentDeploy) Run() error {
 			js      nats.JetStreamContext
 			conn    *nats.Conn
 			encoded *nats.EncodedConn
-			sub     *nats.Subscription
+			reader  *nlog.RecordReader
 		)
 
 		if opts, _, _, err = d.Nats.ToNatsOptions(); err != nil {
@@ -95,13 +98,12 @@ func (d *agentDeploy) Run() error {
 			return
 		}
 
-		log.Info("resolving agent", "name", d.Name)
+		log.Info("resolving agents", "name", d.Name, "group", d.Targets.Group, "selector", d.Targets.Selector)
 		listCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 		defer cancel()
 
 		var (
-			ok             bool
-			target         *info.Response
+			targets        []*info.Response
 			byName, byNKey map[string]*info.Response
 		)
 
@@ -116,27 +118,61 @@ func (d *agentDeploy) Run() error {
 			return
 		} else if byNKey, err = agent.IndexByNKey(agents); err != nil {
 			return
-		}
-
-		if target, ok = byName[d.Name]; ok {
-			log.Info("agent found", "name", d.Name, "nkey", target.NKey)
-		} else {
-			return errors.Errorf("could not find an agent named %s", d.Name)
+		} else if targets, err = d.Targets.resolve(agents, d.Name); err != nil {
+			return
+		} else if targets == nil {
+			return errors.New("an agent name, group or selector is required")
 		}
 
 		// set agent indices in the context for the log writer
 		ctx = nlog.SetAgentsByName(ctx, byName)
 		ctx = nlog.SetAgentsByNKey(ctx, byNKey)
 
-		var resp nixos.DeployResponse
-		if resp, err = nixos.DeployWithContext(ctx, encoded, target.NKey, req); err != nil {
-			return
-		} else if sub, err = js.SubscribeSync(resp.Logs+".>", nats.DeliverAll(), nats.AckNone()); err != nil {
+		// the system log subjects of the deployments we are waiting on
+		pending := make(map[string]*info.Response)
+		var failed []string
+
+		var subjects []string
+		for _, target := range targets {
+			log.Info("deploying to agent", "name", target.Name, "nkey", target.NKey)
+
+			var resp nixos.DeployResponse
+			if resp, err = nixos.DeployWithContext(ctx, encoded, target.NKey, req); err != nil {
+				if len(targets) == 1 {
+					return
+				}
+				// carry on with the remaining agents
+				log.Error("failed to start deployment", "name", target.Name, "nkey", target.NKey, "error", err)
+				failed = append(failed, target.Name)
+				err = nil
+				continue
+			}
+
+			pending[resp.Logs+".SYS"] = target
+			subjects = append(subjects, resp.Logs+".>")
+			// agents which predate the output stream publish their output beneath the logs subject instead
+			if d.IncludeOutput && resp.Output != "" {
+				subjects = append(subjects, resp.Output+".>")
+			}
+		}
+
+		if len(pending) == 0 {
+			return errors.New("failed to start any deployments")
+		}
+
+		defer func() {
+			if err == nil && len(failed) > 0 {
+				err = errors.Errorf("failed to deploy to: %s", strings.Join(failed, ", "))
+			}
+		}()
+
+		if reader, err = subscribeRecords(ctx, js, subjects, nats.DeliverAll(), nats.AckNone()); err != nil {
 			return
 		}
 
-		log.Debug("listening for logs", "subject", resp.Logs)
-		reader := nlog.RecordReader{Sub: sub, Context: ctx}
+		log.Debug("listening for logs", "subjects", subjects)
+
+		writer := newRecordWriter()
 
 		var record nlog.Record
 		for {
@@ -144,22 +180,34 @@ func (d *agentDeploy) Run() error {
 			case <-ctx.Done():
 				return
 			default:
+				var eos nnats.EndOfStreamErr
+
 				record, err = reader.Read()
 				if errors.Is(err, nats.ErrTimeout) {
 					err = nil
 					continue
-				} else if nnats.IsEndOfStreamErr(err) {
+				} else if errors.As(err, &eos) {
 					err = nil
-					return
+					// a deployment is complete once its system log has finished, output may finish sooner
+					if target, ok := pending[eos.Subject]; ok {
+						log.Info("deployment finished", "name", target.Name)
+						delete(pending, eos.Subject)
+					}
+					if len(pending) == 0 {
+						return
+					}
+					continue
 				} else if err != nil {
 					return
 				}
 
-				if !d.Output && record.Type() == nlog.RecordTerm {
+				if !d.IncludeOutput && record.Type() == nlog.RecordTerm {
 					continue
 				}
 
-				_, _ = record.Write(os.Stderr)
+				if err = writer.Write(record); err != nil {
+					return
+				}
 			}
 		}
 	})
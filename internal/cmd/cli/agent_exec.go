@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/internal/cmd"
+	"github.com/numtide/nits/pkg/agent/command"
+	"github.com/numtide/nits/pkg/agent/info"
+	nnats "github.com/numtide/nits/pkg/nats"
+)
+
+// resultGrace is how long we wait for a result after the command should have been terminated.
+const resultGrace = 30 * time.Second
+
+type agentExec struct {
+	Nats    nnats.CliOptions `embed:"" prefix:"nats-"`
+	Name    string           `arg:"" help:"Name, nkey or nkey prefix of the agent"`
+	Command []string         `arg:"" passthrough:"" help:"Command to run followed by its arguments."`
+
+	Dir     string        `help:"Working directory for the command."`
+	Timeout time.Duration `help:"Terminate the command if it runs for longer than this. Limited by the agent's own timeout."`
+	Admin   bool          `help:"Run the command through the admin endpoint, bypassing the agent's allow-list."`
+}
+
+// execOutput is the result of a command along with its output, used for structured output.
+type execOutput struct {
+	command.Result
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+}
+
+func (e *agentExec) Run() error {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	return cmd.Run(func(ctx context.Context) (err error) {
+		var (
+			conn    *nats.Conn
+			encoded *nats.EncodedConn
+			js      nats.JetStreamContext
+			target  *info.Response
+			resp    command.Response
+			sub     *nats.Subscription
+		)
+
+		if conn, err = e.Nats.Connect(); err != nil {
+			return
+		} else if encoded, err = nats.NewEncodedConn(conn, nats.JSON_ENCODER); err != nil {
+			return
+		} else if js, err = conn.JetStream(); err != nil {
+			return
+		}
+
+		if target, err = resolveOnline(ctx, conn, e.Name); err != nil {
+			return
+		}
+
+		req := command.Request{
+			Command: e.Command,
+			Dir:     e.Dir,
+			Timeout: e.Timeout,
+		}
+
+		reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		if resp, err = command.RunWithContext(reqCtx, encoded, target.NKey, e.Admin, req); err != nil {
+			return
+		}
+
+		log.Debug("command started", "id", resp.Id, "output", resp.Output)
+
+		// output is captured by the output stream, so we don't miss anything published before we subscribe
+		msgs := make(chan *nats.Msg, 64)
+		if sub, err = js.ChanSubscribe(resp.Output+".>", msgs, nats.OrderedConsumer(), nats.DeliverAll()); err != nil {
+			return
+		}
+		defer func() {
+			_ = sub.Unsubscribe()
+		}()
+
+		var (
+			stdout, stderr strings.Builder
+			deadline       <-chan time.Time
+			done           = ctx.Done()
+		)
+
+		if e.Timeout > 0 {
+			deadline = time.After(e.Timeout + resultGrace)
+		}
+
+		for {
+			select {
+			case <-done:
+				// ask the agent to terminate the command, and wait for its result
+				log.Info("canceling command", "id", resp.Id)
+				done = nil
+				deadline = time.After(resultGrace)
+
+				cancelCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				err = command.CancelWithContext(cancelCtx, encoded, target.NKey, resp.Id)
+				cancel()
+
+				var reqErr *nnats.RequestError
+				if errors.As(err, &reqErr) && reqErr.Code == "404" {
+					// the command has already finished
+					err = nil
+				} else if err != nil {
+					return errors.Annotate(err, "failed to cancel command")
+				}
+
+			case <-deadline:
+				return errors.Errorf("timed out waiting for command %s to finish", resp.Id)
+
+			case msg := <-msgs:
+				switch {
+				case strings.HasSuffix(msg.Subject, ".STDOUT"):
+					if structuredOutput() {
+						stdout.Write(msg.Data)
+					} else {
+						_, _ = os.Stdout.Write(msg.Data)
+					}
+
+				case strings.HasSuffix(msg.Subject, ".STDERR"):
+					if structuredOutput() {
+						stderr.Write(msg.Data)
+					} else {
+						_, _ = os.Stderr.Write(msg.Data)
+					}
+
+				case strings.HasSuffix(msg.Subject, ".RESULT"):
+					var result command.Result
+					if err = json.Unmarshal(msg.Data, &result); err != nil {
+						return errors.Annotate(err, "failed to unmarshal result")
+					}
+					return e.finish(result, stdout.String(), stderr.String())
+				}
+			}
+		}
+	})
+}
+
+func (e *agentExec) finish(result command.Result, stdout string, stderr string) error {
+	if structuredOutput() {
+		if err := render(execOutput{Result: result, Stdout: stdout, Stderr: stderr}, nil); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case result.Error != "":
+		return errors.Errorf("command failed: %s", result.Error)
+	case result.TimedOut:
+		log.Warn("command timed out", "id", result.Id)
+	case result.Canceled:
+		log.Warn("command was canceled", "id", result.Id)
+	}
+
+	if result.ExitCode != 0 {
+		code := result.ExitCode
+		if code < 0 {
+			// terminated by a signal
+			code = 1
+		}
+		return &cmd.ExitCodeError{Code: code}
+	}
+	return nil
+}
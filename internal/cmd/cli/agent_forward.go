@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+	"github.com/numtide/nits/internal/cmd"
+	"github.com/numtide/nits/pkg/agent/forward"
+	"github.com/numtide/nits/pkg/agent/info"
+	nnats "github.com/numtide/nits/pkg/nats"
+)
+
+type agentForward struct {
+	Nats  nnats.CliOptions `embed:"" prefix:"nats-"`
+	Name  string           `arg:"" help:"Name, nkey or nkey prefix of the agent"`
+	Specs []forwardSpec    `arg:"" help:"Ports to forward in the form [bind_address:]port:host:hostport, with host resolved by the agent."`
+}
+
+// forwardSpec is a local address on which to listen and the address the agent should connect to for each connection.
+type forwardSpec struct {
+	Local  string
+	Remote string
+}
+
+func (f *forwardSpec) UnmarshalText(text []byte) error {
+	parts := strings.Split(string(text), ":")
+
+	switch len(parts) {
+	case 3:
+		// like ssh, we only listen on the loopback interface unless told otherwise
+		f.Local = net.JoinHostPort("localhost", parts[0])
+		f.Remote = net.JoinHostPort(parts[1], parts[2])
+	case 4:
+		f.Local = net.JoinHostPort(parts[0], parts[1])
+		f.Remote = net.JoinHostPort(parts[2], parts[3])
+	default:
+		return errors.NotValidf("forward %q, expected [bind_address:]port:host:hostport", string(text))
+	}
+	return nil
+}
+
+func (f *agentForward) Run() error {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	return cmd.Run(func(ctx context.Context) (err error) {
+		var (
+			conn    *nats.Conn
+			encoded *nats.EncodedConn
+			target  *info.Response
+		)
+
+		if conn, err = f.Nats.Connect(); err != nil {
+			return
+		} else if encoded, err = nats.NewEncodedConn(conn, nats.JSON_ENCODER); err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if target, err = resolveOnline(ctx, conn, f.Name); err != nil {
+			return
+		}
+
+		var listeners []net.Listener
+		defer func() {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+		}()
+
+		for _, spec := range f.Specs {
+			var l net.Listener
+			if l, err = net.Listen("tcp", spec.Local); err != nil {
+				return errors.Annotatef(err, "failed to listen on %s", spec.Local)
+			}
+			listeners = append(listeners, l)
+			println(fmt.Sprintf("Forwarding %s to %s via %s", l.Addr(), spec.Remote, target.Name))
+		}
+
+		// active tracks the connections being forwarded, each of which closes its pipe once the context is done
+		var wg, active sync.WaitGroup
+		for idx, l := range listeners {
+			wg.Add(1)
+			go func(l net.Listener, spec forwardSpec) {
+				defer wg.Done()
+				for {
+					local, err := l.Accept()
+					if err != nil {
+						if ctx.Err() == nil {
+							log.Error("failed to accept connection", "address", spec.Local, "error", err)
+						}
+						return
+					}
+					active.Add(1)
+					go func() {
+						defer active.Done()
+						f.forward(ctx, conn, encoded, target, spec, local)
+					}()
+				}
+			}(l, f.Specs[idx])
+		}
+
+		<-ctx.Done()
+
+		// closing the listeners causes the accept loops to return
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+		wg.Wait()
+
+		// wait for the agent to be told each connection has closed before we disconnect
+		active.Wait()
+		return nil
+	})
+}
+
+func (f *agentForward) forward(
+	ctx context.Context,
+	conn *nats.Conn,
+	encoded *nats.EncodedConn,
+	target *info.Response,
+	spec forwardSpec,
+	local net.Conn,
+) {
+	id := nuid.Next()
+
+	// subscribe before dialing so we don't miss any data
+	pipe, err := nnats.NewPipe(conn, forward.ClientSubject(target.NKey, id), forward.AgentSubject(target.NKey, id), nnats.DefaultPipeWindow)
+	if err != nil {
+		log.Error("failed to create pipe", "error", err)
+		_ = local.Close()
+		return
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	resp, err := forward.DialWithContext(dialCtx, encoded, target.NKey, forward.DialRequest{Id: id, Address: spec.Remote})
+	if err != nil {
+		log.Error("failed to forward connection", "remote", spec.Remote, "error", err)
+		_ = local.Close()
+		_ = pipe.Close()
+		return
+	}
+
+	log.Info("forwarding connection", "id", id, "local", local.RemoteAddr(), "remote", resp.RemoteAddress)
+
+	go keepalive(ctx, pipe)
+	forward.Join(local, pipe)
+	log.Info("connection closed", "id", id)
+}
+
+// keepalive lets the agent know we are still present whilst the connection is quiet, closing the pipe once ctx is done.
+func keepalive(ctx context.Context, pipe *nnats.Pipe) {
+	ticker := time.NewTicker(forward.KeepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			_ = pipe.Close()
+			return
+		case <-pipe.Done():
+			return
+		case <-ticker.C:
+			if err := pipe.Keepalive(); err != nil {
+				log.Debug("failed to send keepalive", "error", err)
+			}
+		}
+	}
+}
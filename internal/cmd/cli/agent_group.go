@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"slices"
+
+	"github.com/numtide/nits/pkg/agent"
+	nnats "github.com/numtide/nits/pkg/nats"
+)
+
+type agentGroupAdd struct {
+	Nats nnats.CliOptions `embed:"" prefix:"nats-"`
+
+	Name   string   `arg:"" help:"Name, nkey or nkey prefix of the agent"`
+	Groups []string `arg:"" help:"Groups to add the agent to"`
+}
+
+func (a *agentGroupAdd) Run() error {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	return updateMembership(&a.Nats, a.Name, func(membership *agent.Membership) {
+		membership.Groups = append(membership.Groups, a.Groups...)
+	})
+}
+
+type agentGroupRemove struct {
+	Nats nnats.CliOptions `embed:"" prefix:"nats-"`
+
+	Name   string   `arg:"" help:"Name, nkey or nkey prefix of the agent"`
+	Groups []string `arg:"" help:"Groups to remove the agent from"`
+}
+
+func (r *agentGroupRemove) Run() error {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	return updateMembership(&r.Nats, r.Name, func(membership *agent.Membership) {
+		membership.Groups = slices.DeleteFunc(membership.Groups, func(group string) bool {
+			return slices.Contains(r.Groups, group)
+		})
+	})
+}
@@ -4,26 +4,39 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/juju/errors"
 	"github.com/nats-io/nats.go"
 	"github.com/numtide/nits/internal/cmd"
 	"github.com/numtide/nits/pkg/agent"
+	"github.com/numtide/nits/pkg/agent/config"
 	"github.com/numtide/nits/pkg/agent/info"
 	nutil "github.com/numtide/nits/pkg/nats"
+	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/host"
 )
 
 type agentInfo struct {
-	Nats nutil.CliOptions `embed:"" prefix:"nats-"`
-	Name string           `arg:""`
-
-	All   bool `help:"Include all available agent info"`
-	Host  bool `help:"Include information about the host machine"`
-	Nix   bool `help:"Include information about the version of Nix installed on the host machine"`
-	NixOS bool `name:"nixos" help:"Include information about the host machine's NixOS config'"`
-	Load  bool `help:"Include load information about the host machine"`
+	Nats    nutil.CliOptions `embed:"" prefix:"nats-"`
+	Targets agentTargets     `embed:""`
+	Name    string           `arg:"" optional:"" help:"Name, nkey or nkey prefix of the agent"`
+
+	All    bool `help:"Include all available agent info"`
+	Host   bool `help:"Include information about the host machine"`
+	Nix    bool `help:"Include information about the version of Nix installed on the host machine"`
+	NixOS  bool `name:"nixos" help:"Include information about the host machine's NixOS config'"`
+	Load   bool `help:"Include load information about the host machine"`
+	Cpus   bool `help:"Include information about the host machine's CPUs"`
+	Memory bool `help:"Include memory and swap usage of the host machine"`
+	Disk   bool `help:"Include disk partitions and usage of the host machine"`
+	Config bool `help:"Include the settings in effect after applying remote configuration"`
+
+	AllAgents   bool          `help:"Collect info from every agent, comparing them in a table."`
+	Concurrency int           `default:"16" help:"Maximum number of agents to query at once."`
+	Timeout     time.Duration `default:"10s" help:"How long to wait for each agent to respond."`
 }
 
 func (c *agentInfo) Run() error {
@@ -43,50 +56,70 @@ func (c *agentInfo) Run() error {
 			return
 		}
 
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 10*time.Second)
+		listCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 		defer cancel()
 
 		var agents []*info.Response
-		if agents, err = agent.List(ctx, conn); err != nil {
+		if agents, err = agent.List(listCtx, conn); err != nil {
 			return err
 		}
 
-		var nkey string
-		for _, a := range agents {
-			if a.Name == c.Name {
-				elapsed := time.Now().Sub(a.LastSeen)
-				if elapsed > 10*time.Second {
-					return errors.Errorf("agent has not been seen in %v", elapsed)
-				}
-				nkey = a.NKey
-				break
+		var targets []*info.Response
+		if c.AllAgents {
+			if c.Name != "" || c.Targets.isSet() {
+				return errors.New("--all-agents cannot be combined with an agent name, group or selector")
 			}
+			targets = agents
+		} else if targets, err = c.Targets.resolve(agents, c.Name); err != nil {
+			return
+		} else if targets == nil {
+			return errors.New("an agent name, group or selector is required")
+		}
+
+		req := info.Request{
+			Host:   c.All || c.Host,
+			Load:   c.All || c.Load,
+			Nix:    c.All || c.Nix,
+			NixOS:  c.All || c.NixOS,
+			Cpus:   c.All || c.Cpus,
+			Memory: c.All || c.Memory,
+			Disk:   c.All || c.Disk,
+			Config: c.All || c.Config,
 		}
 
-		if nkey == "" {
-			return errors.Errorf("no agent with the name '%s' has ever reported in", c.Name)
+		if c.Name == "" {
+			// we are comparing a set of agents
+			return c.runFleet(ctx, encoded, targets, req)
 		}
 
-		req := info.Request{
-			Host:  c.All || c.Host,
-			Load:  c.All || c.Load,
-			Nix:   c.All || c.Nix,
-			NixOS: c.All || c.NixOS,
+		target := targets[0]
+		if !target.Online {
+			return errors.Errorf("agent %s is offline, it was last seen %v ago", target.Name, time.Since(target.LastSeen).Round(time.Second))
 		}
 
-		var resp info.Response
-		if err = info.Get(encoded, nkey, req, &resp, 10*time.Second); err != nil {
+		getCtx, cancel := context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+
+		resp := &info.Response{}
+		if err = info.GetWithContext(getCtx, encoded, target.NKey, req, resp); err != nil {
 			return err
 		}
 
-		printAgentSummary(&resp)
-		printNix(resp.Nix)
-		printNixos(resp.NixOS)
-		printAgentHost(resp.Host)
-		printAgentLoad(resp.Load)
+		// groups are held centrally, with labels merged over those of the agent
+		resp.Groups = target.Groups
+		resp.Labels = target.Labels
 
-		return
+		return render(resp, func() {
+			printAgentSummary(resp)
+			printNix(resp.Nix)
+			printNixos(resp.NixOS)
+			printAgentHost(resp.Host)
+			printAgentLoad(resp.Load)
+			printAgentCpus(resp.Cpus)
+			printAgentMemory(resp.Memory)
+			printAgentDisk(resp.Disk)
+			printAgentConfig(resp.Config)
+		})
 	})
 }
 
@@ -96,6 +129,19 @@ func printAgentSummary(agent *info.Response) {
 	kvPrintln("Name:", agent.Name)
 	kvPrintln("NKey:", agent.NKey)
 	kvPrintln("Subject:", agent.Subject)
+	if len(agent.Groups) > 0 {
+		kvPrintln("Groups:", strings.Join(agent.Groups, ", "))
+	}
+	if len(agent.Labels) > 0 {
+		kvPrintln("Labels:", formatLabels(agent.Labels))
+	}
+	for _, check := range agent.Health {
+		status := "passing"
+		if !check.Passing {
+			status = "failing: " + check.Error
+		}
+		kvPrintln("Health "+check.Name+":", fmt.Sprintf("%s (since %s)", status, check.Since.Local().Format(time.RFC1123Z)))
+	}
 }
 
 func printAgentHost(host *host.InfoStat) {
@@ -174,3 +220,80 @@ func printAgentLoad(load *info.Load) {
 		kvPrintln("Ctxt:", strconv.Itoa(load.Misc.Ctxt)) // todo what does this measure?
 	}
 }
+
+func printAgentCpus(cpus []cpu.InfoStat) {
+	if len(cpus) == 0 {
+		return
+	}
+
+	println()
+	println(sectionHeaderStyle.Render("CPUs:"))
+	println()
+
+	for _, c := range cpus {
+		kvPrintln(fmt.Sprintf("CPU %d:", c.CPU), fmt.Sprintf("%s (%d cores, %.0f MHz)", c.ModelName, c.Cores, c.Mhz))
+	}
+}
+
+func printAgentMemory(memory *info.Memory) {
+	if memory == nil {
+		return
+	}
+
+	println()
+	println(sectionHeaderStyle.Render("Memory:"))
+	println()
+
+	if v := memory.Virtual; v != nil {
+		kvPrintln("Total:", humanize.IBytes(v.Total))
+		kvPrintln("Used:", fmt.Sprintf("%s (%.1f%%)", humanize.IBytes(v.Used), v.UsedPercent))
+		kvPrintln("Available:", humanize.IBytes(v.Available))
+		kvPrintln("Buffers:", humanize.IBytes(v.Buffers))
+		kvPrintln("Cached:", humanize.IBytes(v.Cached))
+	}
+
+	if s := memory.Swap; s != nil {
+		kvPrintln("Swap Total:", humanize.IBytes(s.Total))
+		kvPrintln("Swap Used:", fmt.Sprintf("%s (%.1f%%)", humanize.IBytes(s.Used), s.UsedPercent))
+	}
+
+	for _, d := range memory.SwapDevices {
+		kvPrintln("Swap Device:", fmt.Sprintf("%s %s / %s", d.Name, humanize.IBytes(d.UsedBytes), humanize.IBytes(d.FreeBytes+d.UsedBytes)))
+	}
+}
+
+func printAgentDisk(d *info.Disk) {
+	if d == nil {
+		return
+	}
+
+	println()
+	println(sectionHeaderStyle.Render("Disk Usage:"))
+	println()
+
+	for _, usage := range d.Usage {
+		kvPrintln(usage.Path+":", fmt.Sprintf("%s / %s (%.1f%%) %s, inodes %.1f%%",
+			humanize.IBytes(usage.Used), humanize.IBytes(usage.Total), usage.UsedPercent, usage.Fstype, usage.InodesUsedPercent,
+		))
+	}
+
+	println()
+	println(sectionHeaderStyle.Render("Partitions:"))
+	println()
+
+	for _, partition := range d.Partitions {
+		kvPrintln(partition.Mountpoint+":", fmt.Sprintf("%s %s %s", partition.Device, partition.Fstype, strings.Join(partition.Opts, ",")))
+	}
+}
+
+func printAgentConfig(settings *config.Settings) {
+	if settings == nil {
+		return
+	}
+
+	println()
+	println(sectionHeaderStyle.Render("Config:"))
+	println()
+
+	printSettings(settings)
+}
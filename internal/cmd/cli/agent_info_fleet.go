@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/dustin/go-humanize"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/pkg/agent/info"
+	"github.com/xeonx/timeago"
+)
+
+// fleetResult is the outcome of requesting info from one of many agents. Agents which could not be reached have an
+// error rather than causing the whole command to fail.
+type fleetResult struct {
+	Name  string         `json:"name"`
+	NKey  string         `json:"nkey"`
+	Info  *info.Response `json:"info,omitempty"`
+	Error string         `json:"error,omitempty"`
+}
+
+func (c *agentInfo) runFleet(ctx context.Context, conn *nats.EncodedConn, targets []*info.Response, req info.Request) error {
+	// always include what is needed for the comparison table
+	req.Host = true
+	req.NixOS = true
+	req.Load = true
+	req.Memory = true
+
+	results := collectInfo(ctx, conn, targets, req, c.Concurrency, c.Timeout)
+
+	return render(results, func() {
+		printFleetTable(results)
+	})
+}
+
+// collectInfo requests info from each target using a bounded pool of workers, returning the results in the same order
+// as the targets.
+func collectInfo(
+	ctx context.Context,
+	conn *nats.EncodedConn,
+	targets []*info.Response,
+	req info.Request,
+	concurrency int,
+	timeout time.Duration,
+) []*fleetResult {
+	results := make([]*fleetResult, len(targets))
+	indices := make(chan int)
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indices {
+				results[idx] = getInfo(ctx, conn, targets[idx], req, timeout)
+			}
+		}()
+	}
+
+	for idx := range targets {
+		indices <- idx
+	}
+	close(indices)
+
+	wg.Wait()
+	return results
+}
+
+func getInfo(ctx context.Context, conn *nats.EncodedConn, target *info.Response, req info.Request, timeout time.Duration) *fleetResult {
+	result := &fleetResult{Name: target.Name, NKey: target.NKey}
+
+	if !target.Online {
+		result.Error = fmt.Sprintf("offline, last seen %s", timeago.English.Format(target.LastSeen))
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp := &info.Response{}
+	if err := info.GetWithContext(ctx, conn, target.NKey, req, resp); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	// groups and labels are held centrally rather than by the agent
+	resp.Groups = target.Groups
+	resp.Labels = target.Labels
+
+	result.Info = resp
+	return result
+}
+
+func printFleetTable(results []*fleetResult) {
+	columns := []table.Column{
+		{Title: "Name", Width: 32},
+		{Title: "Hostname", Width: 24},
+		{Title: "NixOS", Width: 32},
+		{Title: "System", Width: 80},
+		{Title: "Load", Width: 18},
+		{Title: "Memory", Width: 24},
+		{Title: "Error", Width: 40},
+	}
+
+	var rows []table.Row
+	for _, result := range results {
+		var hostname, nixosVersion, system, load, memory string
+
+		if resp := result.Info; resp != nil {
+			if resp.Host != nil {
+				hostname = resp.Host.Hostname
+			}
+			if resp.NixOS != nil {
+				nixosVersion = resp.NixOS.Version
+				system = resp.NixOS.CurrentSystem
+			}
+			if resp.Load != nil && resp.Load.Avg != nil {
+				load = fmt.Sprintf("%.2f %.2f %.2f", resp.Load.Avg.Load1, resp.Load.Avg.Load5, resp.Load.Avg.Load15)
+			}
+			if resp.Memory != nil && resp.Memory.Virtual != nil {
+				virtual := resp.Memory.Virtual
+				memory = fmt.Sprintf("%s / %s (%.0f%%)", humanize.IBytes(virtual.Used), humanize.IBytes(virtual.Total), virtual.UsedPercent)
+			}
+		}
+
+		rows = append(rows, table.Row{result.Name, hostname, nixosVersion, system, load, memory, result.Error})
+	}
+
+	t := table.New(
+		table.WithColumns(columns),
+		table.WithRows(rows),
+		table.WithFocused(false),
+		table.WithHeight(len(rows)),
+	)
+
+	t.SetStyles(tableStyle)
+
+	println(t.View())
+}
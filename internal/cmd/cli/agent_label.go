@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"context"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/internal/cmd"
+	"github.com/numtide/nits/pkg/agent"
+	nnats "github.com/numtide/nits/pkg/nats"
+)
+
+type agentLabelSet struct {
+	Nats nnats.CliOptions `embed:"" prefix:"nats-"`
+
+	Name   string   `arg:"" help:"Name, nkey or nkey prefix of the agent"`
+	Labels []string `arg:"" help:"Labels to set in the form key=value"`
+}
+
+func (s *agentLabelSet) Run() error {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	labels := make(map[string]string, len(s.Labels))
+	for _, label := range s.Labels {
+		key, value, ok := strings.Cut(label, "=")
+		if !ok {
+			return errors.Errorf("label '%s' must be in the form key=value", label)
+		} else if err := agent.ValidateLabelKey(key); err != nil {
+			return err
+		}
+		labels[key] = value
+	}
+
+	return updateMembership(&s.Nats, s.Name, func(membership *agent.Membership) {
+		if membership.Labels == nil {
+			membership.Labels = make(map[string]string)
+		}
+		for k, v := range labels {
+			membership.Labels[k] = v
+		}
+	})
+}
+
+type agentLabelUnset struct {
+	Nats nnats.CliOptions `embed:"" prefix:"nats-"`
+
+	Name string   `arg:"" help:"Name, nkey or nkey prefix of the agent"`
+	Keys []string `arg:"" help:"Keys of the labels to remove"`
+}
+
+func (u *agentLabelUnset) Run() error {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	return updateMembership(&u.Nats, u.Name, func(membership *agent.Membership) {
+		for _, key := range u.Keys {
+			delete(membership.Labels, key)
+		}
+	})
+}
+
+func updateMembership(opts *nnats.CliOptions, name string, fn func(membership *agent.Membership)) error {
+	return cmd.Run(func(ctx context.Context) (err error) {
+		var (
+			conn       *nats.Conn
+			nkey       string
+			membership *agent.Membership
+		)
+
+		if conn, err = opts.Connect(); err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if nkey, err = resolveNKey(ctx, conn, name); err != nil {
+			return
+		} else if membership, err = agent.UpdateMembership(conn, nkey, fn); err != nil {
+			return
+		}
+
+		log.Info("updated agent membership", "nkey", nkey, "groups", membership.Groups, "labels", membership.Labels)
+
+		return render(struct {
+			NKey string `json:"nkey"`
+			*agent.Membership
+		}{nkey, membership}, nil)
+	})
+}
@@ -2,6 +2,8 @@ package cli
 
 import (
 	"context"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/table"
@@ -14,7 +16,10 @@ import (
 )
 
 type agentList struct {
-	Nats nutil.CliOptions `embed:"" prefix:"nats-"`
+	Nats    nutil.CliOptions `embed:"" prefix:"nats-"`
+	Targets agentTargets     `embed:""`
+
+	Wide bool `help:"Include additional columns such as the current system and uptime."`
 }
 
 func (l *agentList) Run() error {
@@ -37,29 +42,96 @@ func (l *agentList) Run() error {
 			return err
 		}
 
-		columns := []table.Column{
-			{Title: "Name", Width: 32},
-			{Title: "NKey", Width: 57},
-			{Title: "Last Seen", Width: 24},
+		if agents, err = l.Targets.filter(agents); err != nil {
+			return err
+		} else if agents == nil {
+			agents = []*info.Response{}
 		}
 
-		var rows []table.Row
-		for _, v := range agents {
-			row := table.Row{v.Name, v.NKey, timeago.English.Format(v.LastSeen)}
-			rows = append(rows, row)
-		}
+		return render(agents, func() {
+			l.printTable(agents)
+		})
+	})
+}
+
+func (l *agentList) printTable(agents []*info.Response) {
+	columns := []table.Column{
+		{Title: "Name", Width: 32},
+		{Title: "NKey", Width: 57},
+		{Title: "Status", Width: 8},
+		{Title: "Version", Width: 16},
+		{Title: "Deployment", Width: 12},
+		{Title: "Health", Width: 8},
+		{Title: "Last Seen", Width: 24},
+	}
 
-		t := table.New(
-			table.WithColumns(columns),
-			table.WithRows(rows),
-			table.WithFocused(false),
-			table.WithHeight(len(rows)),
+	if l.Wide {
+		columns = append(columns,
+			table.Column{Title: "Deployment Id", Width: 24},
+			table.Column{Title: "NixOS", Width: 32},
+			table.Column{Title: "System", Width: 80},
+			table.Column{Title: "Uptime", Width: 16},
+			table.Column{Title: "Groups", Width: 24},
+			table.Column{Title: "Labels", Width: 32},
 		)
+	}
 
-		t.SetStyles(tableStyle)
+	var rows []table.Row
+	for _, v := range agents {
+		status := "offline"
+		if v.Online {
+			status = "online"
+		}
 
-		println(t.View())
+		var deploymentId, deploymentOutcome string
+		if v.Deployment != nil {
+			deploymentId = v.Deployment.Id
+			deploymentOutcome = string(v.Deployment.Outcome)
+		}
 
-		return
-	})
+		var health string
+		if len(v.Health) > 0 && info.Healthy(v.Health) {
+			health = "passing"
+		} else if len(v.Health) > 0 {
+			health = "failing"
+		}
+
+		row := table.Row{v.Name, v.NKey, status, v.Version, deploymentOutcome, health, timeago.English.Format(v.LastSeen)}
+
+		if l.Wide {
+			var nixosVersion, system, uptime string
+			if v.NixOS != nil {
+				nixosVersion = v.NixOS.Version
+				system = v.NixOS.CurrentSystem
+			}
+			if v.Online && !v.BootTime.IsZero() {
+				uptime = time.Since(v.BootTime).Round(time.Minute).String()
+			}
+			row = append(row, deploymentId, nixosVersion, system, uptime,
+				strings.Join(v.Groups, ","), formatLabels(v.Labels),
+			)
+		}
+
+		rows = append(rows, row)
+	}
+
+	t := table.New(
+		table.WithColumns(columns),
+		table.WithRows(rows),
+		table.WithFocused(false),
+		table.WithHeight(len(rows)),
+	)
+
+	t.SetStyles(tableStyle)
+
+	println(t.View())
+}
+
+func formatLabels(labels map[string]string) string {
+	var pairs []string
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
 }
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/internal/cmd"
+	"github.com/numtide/nits/pkg/agent/info"
+	"github.com/numtide/nits/pkg/agent/loglevel"
+	nutil "github.com/numtide/nits/pkg/nats"
+)
+
+type agentLogLevel struct {
+	Nats  nutil.CliOptions `embed:"" prefix:"nats-"`
+	Name  string           `arg:"" help:"Name, nkey or nkey prefix of the agent"`
+	Level string           `arg:"" optional:"" help:"Level to use, one of debug, info, warn, error or fatal. Reports the current level when omitted."`
+
+	For     time.Duration `default:"30m" help:"How long before reverting to the configured level."`
+	Reset   bool          `help:"Revert to the configured level immediately."`
+	Timeout time.Duration `default:"10s" help:"How long to wait for the agent to respond."`
+}
+
+func (l *agentLogLevel) Run() error {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	if l.Reset && l.Level != "" {
+		return errors.New("a level cannot be combined with --reset")
+	} else if l.Level != "" {
+		if _, err := log.ParseLevel(l.Level); err != nil {
+			return errors.NotValidf("log level %q", l.Level)
+		}
+	}
+
+	return cmd.Run(func(ctx context.Context) (err error) {
+		var (
+			conn    *nats.Conn
+			encoded *nats.EncodedConn
+			target  *info.Response
+		)
+
+		if conn, err = l.Nats.Connect(); err != nil {
+			return
+		} else if encoded, err = nats.NewEncodedConn(conn, nats.JSON_ENCODER); err != nil {
+			return
+		}
+
+		if target, err = resolveOnline(ctx, conn, l.Name); err != nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, l.Timeout)
+		defer cancel()
+
+		req := loglevel.Request{Reset: l.Reset}
+		if l.Level != "" {
+			req.Level = l.Level
+			req.For = l.For
+		}
+
+		var resp loglevel.Response
+		if err = loglevel.SetWithContext(ctx, encoded, target.NKey, req, &resp); err != nil {
+			return
+		}
+
+		return render(resp, func() {
+			kvPrintln("Level:", resp.Level)
+			kvPrintln("Configured:", resp.Configured)
+			if resp.Until != nil {
+				kvPrintln("Reverts:", resp.Until.Local().Format(time.RFC1123Z))
+			}
+		})
+	})
+}
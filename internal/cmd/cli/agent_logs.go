@@ -2,7 +2,6 @@ package cli
 
 import (
 	"context"
-	"os"
 	"time"
 
 	"github.com/charmbracelet/log"
@@ -19,13 +18,15 @@ import (
 )
 
 type agentLogs struct {
-	Nats nnats.CliOptions `embed:"" prefix:"nats-"`
+	Nats    nnats.CliOptions `embed:"" prefix:"nats-"`
+	Targets agentTargets     `embed:""`
 
 	Since     *time.Duration `help:"Time ago from which to start replaying logs." default:"5m" xor:"start"`
 	StartTime *time.Time     `help:"Time from which to start replaying logs." xor:"start"`
 
-	Output bool   `help:"output agent's stdout and stderr"`
-	Name   string `arg:"" optional:""`
+	IncludeOutput bool   `help:"include the agent's stdout and stderr"`
+	Tui           bool   `name:"tui" help:"Show logs in an interactive viewer"`
+	Name          string `arg:"" optional:"" help:"Name, nkey or nkey prefix of the agent. Shows logs for all agents when empty."`
 }
 
 func (c *agentLogs) Run() error {
@@ -33,12 +34,16 @@ func (c *agentLogs) Run() error {
 		return err
 	}
 
+	if c.Tui && structuredOutput() {
+		return errors.New("the interactive viewer cannot be combined with json or yaml output")
+	}
+
 	return cmd.Run(func(ctx context.Context) (err error) {
 		var (
-			conn *nats.Conn
-			js   nats.JetStreamContext
-			subj string
-			sub  *nats.Subscription
+			conn     *nats.Conn
+			js       nats.JetStreamContext
+			subjects []string
+			reader   *nlog.RecordReader
 		)
 
 		subOpts := []nats.SubOpt{
@@ -84,28 +89,42 @@ func (c *agentLogs) Run() error {
 
 		// decide whether we are listening for a specific agents logs or all agents
 
-		if c.Name != "" {
-			if agentInfo, ok := byName[c.Name]; ok {
-				subj = subject.AgentLogs(agentInfo.NKey) + ".>"
-			} else {
-				return errors.Errorf("could not find an agent with name = %s", c.Name)
+		var targets []*info.Response
+		if targets, err = c.Targets.resolve(agents, c.Name); err != nil {
+			return
+		}
+
+		if targets != nil {
+			for _, target := range targets {
+				subjects = append(subjects, subject.AgentLogs(target.NKey)+".>")
+				if c.IncludeOutput {
+					subjects = append(subjects, subject.AgentOutput(target.NKey)+".>")
+				}
 			}
 		} else {
-			subj = subject.AgentLogsAll()
+			subjects = append(subjects, subject.AgentLogsAll())
+			if c.IncludeOutput {
+				subjects = append(subjects, subject.AgentOutputAll())
+			}
 		}
 
 		// start the subscription
 
-		if sub, err = js.SubscribeSync(subj, subOpts...); err != nil {
+		if reader, err = subscribeRecords(ctx, js, subjects, subOpts...); err != nil {
 			return
 		}
 
-		log.Debug("listening for logs", "subject", subj)
+		log.Debug("listening for logs", "subjects", subjects)
 
 		// start reading the log records
 
 		var record nlog.Record
-		reader := nlog.RecordReader{Sub: sub, Context: ctx}
+
+		if c.Tui {
+			return runLogsTui(ctx, reader, byNKey, c.IncludeOutput)
+		}
+
+		writer := newRecordWriter()
 
 		for {
 			select {
@@ -120,11 +139,13 @@ func (c *agentLogs) Run() error {
 					return
 				}
 
-				if !c.Output && record.Type() == nlog.RecordTerm {
+				if !c.IncludeOutput && record.Type() == nlog.RecordTerm {
 					continue
 				}
 
-				_, _ = record.Write(os.Stderr)
+				if err = writer.Write(record); err != nil {
+					return
+				}
 			}
 		}
 	})
@@ -0,0 +1,463 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	nlog "github.com/numtide/nits/pkg/logging"
+	nnats "github.com/numtide/nits/pkg/nats"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+const (
+	// maxLogEntries limits how many records the viewer keeps in memory, the oldest are dropped first.
+	maxLogEntries = 10000
+
+	sidebarWidth = 32
+	allEntries   = "All"
+)
+
+type logsPane int
+
+const (
+	paneAgents logsPane = iota
+	paneSubjects
+	paneLogs
+)
+
+type logRecordMsg struct {
+	record nlog.Record
+}
+
+type logErrMsg struct {
+	err error
+}
+
+type logEntry struct {
+	agent   string
+	subject string
+	// level is nil for records without a level, such as terminal output
+	level  *log.Level
+	output bool
+	text   string
+	search string
+}
+
+type logsModel struct {
+	byNKey nlog.AgentIndex
+
+	entries  []logEntry
+	subjects map[string]map[string]bool
+	// snapshot holds the entries as they were when the view was paused, so that changing filters does not reveal
+	// records which have arrived since
+	snapshot []logEntry
+
+	agentIdx   int
+	subjectIdx int
+	focus      logsPane
+
+	hiddenLevels map[log.Level]bool
+	output       bool
+	paused       bool
+	pending      int
+	searching    bool
+	err          error
+
+	search   textinput.Model
+	viewport viewport.Model
+	width    int
+	height   int
+}
+
+var (
+	paneStyle = lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("240"))
+
+	focusedPaneStyle = paneStyle.Copy().
+				BorderForeground(lipgloss.Color("214"))
+
+	paneTitleStyle = lipgloss.NewStyle().
+			Bold(true)
+
+	selectedStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("214")).
+			Bold(true)
+
+	statusStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("240"))
+)
+
+// runLogsTui displays records read from reader in an interactive viewer until the user quits or ctx is cancelled.
+func runLogsTui(ctx context.Context, reader *nlog.RecordReader, byNKey nlog.AgentIndex, output bool) (err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	search := textinput.New()
+	search.Prompt = "/"
+	search.Placeholder = "search"
+
+	model := &logsModel{
+		byNKey:       byNKey,
+		subjects:     make(map[string]map[string]bool),
+		focus:        paneLogs,
+		hiddenLevels: make(map[log.Level]bool),
+		output:       output,
+		search:       search,
+	}
+
+	program := tea.NewProgram(model, tea.WithAltScreen(), tea.WithContext(ctx))
+
+	go func() {
+		for {
+			record, err := reader.Read()
+			if nnats.IsEndOfStreamErr(err) || errors.Is(err, nats.ErrTimeout) {
+				continue
+			} else if err != nil {
+				program.Send(logErrMsg{err: err})
+				return
+			}
+			program.Send(logRecordMsg{record: record})
+		}
+	}()
+
+	if _, err = program.Run(); errors.Is(err, tea.ErrProgramKilled) {
+		// the context was cancelled
+		err = nil
+	}
+
+	if err == nil && model.err != nil && !errors.Is(model.err, context.Canceled) {
+		err = model.err
+	}
+
+	return
+}
+
+func (m *logsModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m *logsModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		// leave room for the borders and the status line
+		m.viewport = viewport.New(max(m.width-sidebarWidth-2, 0), max(m.height-3, 0))
+		m.refresh()
+
+	case logRecordMsg:
+		m.add(msg.record)
+		if m.paused {
+			m.pending++
+		} else {
+			m.refresh()
+		}
+
+	case logErrMsg:
+		m.err = msg.err
+		return m, tea.Quit
+
+	case tea.KeyMsg:
+		if m.searching {
+			return m, m.updateSearch(msg)
+		}
+
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "tab":
+			m.focus = (m.focus + 1) % 3
+		case "shift+tab":
+			m.focus = (m.focus + 2) % 3
+		case " ":
+			m.paused = !m.paused
+			m.pending = 0
+			m.snapshot = nil
+			if m.paused {
+				m.snapshot = m.entries
+			}
+			m.refresh()
+		case "/":
+			m.searching = true
+			return m, m.search.Focus()
+		case "d", "i", "w", "e", "f":
+			level, _ := log.ParseLevel(map[string]string{
+				"d": "debug", "i": "info", "w": "warn", "e": "error", "f": "fatal",
+			}[msg.String()])
+			m.hiddenLevels[level] = !m.hiddenLevels[level]
+			m.refresh()
+		case "o":
+			m.output = !m.output
+			m.refresh()
+		case "up", "k", "down", "j":
+			delta := 1
+			if msg.String() == "up" || msg.String() == "k" {
+				delta = -1
+			}
+			switch m.focus {
+			case paneAgents:
+				m.agentIdx = clampIndex(m.agentIdx+delta, len(m.agentNames()))
+				m.subjectIdx = 0
+				m.refresh()
+			case paneSubjects:
+				m.subjectIdx = clampIndex(m.subjectIdx+delta, len(m.subjectNames()))
+				m.refresh()
+			default:
+				m.viewport, cmd = m.viewport.Update(msg)
+			}
+		case "g":
+			m.viewport.GotoTop()
+		case "G":
+			m.viewport.GotoBottom()
+		default:
+			m.viewport, cmd = m.viewport.Update(msg)
+		}
+
+	default:
+		m.viewport, cmd = m.viewport.Update(msg)
+	}
+
+	return m, cmd
+}
+
+func (m *logsModel) updateSearch(msg tea.KeyMsg) (cmd tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		m.searching = false
+		m.search.Blur()
+	case "esc":
+		m.searching = false
+		m.search.Blur()
+		m.search.SetValue("")
+	default:
+		m.search, cmd = m.search.Update(msg)
+	}
+	m.refresh()
+	return
+}
+
+func (m *logsModel) View() string {
+	if m.width == 0 {
+		return "loading..."
+	}
+
+	paneHeight := max((m.height-1)/2-2, 1)
+
+	agents := m.renderList("Agents", m.agentNames(), m.agentIdx, paneHeight, m.focus == paneAgents)
+	subjects := m.renderList("Subjects", m.subjectNames(), m.subjectIdx, paneHeight, m.focus == paneSubjects)
+
+	logsStyle := paneStyle
+	if m.focus == paneLogs {
+		logsStyle = focusedPaneStyle
+	}
+
+	body := lipgloss.JoinHorizontal(lipgloss.Top,
+		lipgloss.JoinVertical(lipgloss.Left, agents, subjects),
+		logsStyle.Render(m.viewport.View()),
+	)
+
+	return lipgloss.JoinVertical(lipgloss.Left, body, m.statusLine())
+}
+
+func (m *logsModel) renderList(title string, items []string, selected int, height int, focused bool) string {
+	style := paneStyle
+	if focused {
+		style = focusedPaneStyle
+	}
+
+	// keep the selected item in view
+	offset := 0
+	if selected >= height-1 {
+		offset = selected - height + 2
+	}
+
+	lines := []string{paneTitleStyle.Render(title)}
+	for idx := offset; idx < len(items) && len(lines) < height; idx++ {
+		item := truncate(items[idx], sidebarWidth-4)
+		if idx == selected {
+			item = selectedStyle.Render("> " + item)
+		} else {
+			item = "  " + item
+		}
+		lines = append(lines, item)
+	}
+
+	return style.Copy().Width(sidebarWidth - 2).Height(height).Render(strings.Join(lines, "\n"))
+}
+
+func (m *logsModel) statusLine() string {
+	if m.searching {
+		return m.search.View()
+	}
+
+	var levels []string
+	for _, level := range []log.Level{log.DebugLevel, log.InfoLevel, log.WarnLevel, log.ErrorLevel, log.FatalLevel} {
+		name := level.String()
+		if m.hiddenLevels[level] {
+			name = statusStyle.Copy().Strikethrough(true).Render(name)
+		} else {
+			name = levelStyle(level).Render(name)
+		}
+		levels = append(levels, name)
+	}
+
+	status := []string{strings.Join(levels, " ")}
+	if m.output {
+		status = append(status, "output")
+	}
+	if m.search.Value() != "" {
+		status = append(status, fmt.Sprintf("search: %q", m.search.Value()))
+	}
+	if m.paused {
+		status = append(status, selectedStyle.Render(fmt.Sprintf("paused (%d new)", m.pending)))
+	}
+
+	help := statusStyle.Render("tab: pane • space: pause • /: search • d/i/w/e/f: levels • o: output • q: quit")
+	return strings.Join(status, " | ") + "  " + help
+}
+
+func (m *logsModel) add(record nlog.Record) {
+	msg := record.Msg()
+	nkey := subject.AgentNKeyForSubject(msg.Subject)
+
+	entry := logEntry{
+		agent:   nkey,
+		subject: strings.TrimPrefix(strings.TrimPrefix(msg.Subject, subject.AgentLogs(nkey)+"."), subject.AgentOutput(nkey)+"."),
+		output:  record.Type() == nlog.RecordTerm,
+	}
+
+	if agentInfo, ok := m.byNKey[nkey]; ok {
+		entry.agent = agentInfo.Name
+	}
+
+	switch r := record.(type) {
+	case *nlog.LogFmtRecord:
+		entry.level = &r.Level
+	case *nlog.JournalRecord:
+		level := r.Level()
+		entry.level = &level
+	}
+
+	b := bytes.NewBuffer(nil)
+	if _, err := record.Write(b); err != nil {
+		_, _ = fmt.Fprintf(b, "failed to render record: %v\n", err)
+	}
+	entry.text = strings.TrimSuffix(b.String(), "\n")
+	entry.search = strings.ToLower(entry.agent + " " + entry.subject + " " + string(msg.Data))
+
+	if m.subjects[entry.agent] == nil {
+		m.subjects[entry.agent] = make(map[string]bool)
+	}
+	m.subjects[entry.agent][entry.subject] = true
+
+	m.entries = append(m.entries, entry)
+	if len(m.entries) > maxLogEntries {
+		m.entries = m.entries[len(m.entries)-maxLogEntries:]
+	}
+}
+
+func (m *logsModel) refresh() {
+	if m.width == 0 {
+		return
+	}
+
+	agents := m.agentNames()
+	subjects := m.subjectNames()
+	agent := agents[clampIndex(m.agentIdx, len(agents))]
+	subj := subjects[clampIndex(m.subjectIdx, len(subjects))]
+	search := strings.ToLower(m.search.Value())
+
+	entries := m.entries
+	if m.paused {
+		entries = m.snapshot
+	}
+
+	var lines []string
+	for _, entry := range entries {
+		if agent != allEntries && entry.agent != agent {
+			continue
+		} else if subj != allEntries && entry.subject != subj {
+			continue
+		} else if entry.output && !m.output {
+			continue
+		} else if entry.level != nil && m.hiddenLevels[*entry.level] {
+			continue
+		} else if search != "" && !strings.Contains(entry.search, search) {
+			continue
+		}
+		lines = append(lines, entry.text)
+	}
+
+	atBottom := m.viewport.AtBottom() || m.viewport.TotalLineCount() <= m.viewport.Height
+	m.viewport.SetContent(strings.Join(lines, "\n"))
+	if atBottom {
+		m.viewport.GotoBottom()
+	}
+}
+
+func (m *logsModel) agentNames() []string {
+	var names []string
+	for name := range m.subjects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{allEntries}, names...)
+}
+
+func (m *logsModel) subjectNames() []string {
+	agents := m.agentNames()
+	agent := agents[clampIndex(m.agentIdx, len(agents))]
+
+	set := make(map[string]bool)
+	for name, subjects := range m.subjects {
+		if agent != allEntries && name != agent {
+			continue
+		}
+		for subj := range subjects {
+			set[subj] = true
+		}
+	}
+
+	var names []string
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{allEntries}, names...)
+}
+
+func levelStyle(level log.Level) lipgloss.Style {
+	return log.DefaultStyles().Levels[level]
+}
+
+func clampIndex(idx int, length int) int {
+	if idx < 0 || length == 0 {
+		return 0
+	} else if idx >= length {
+		return length - 1
+	}
+	return idx
+}
+
+func truncate(str string, width int) string {
+	if lipgloss.Width(str) <= width {
+		return str
+	}
+	runes := []rune(str)
+	if len(runes) > width-1 {
+		runes = runes[:width-1]
+	}
+	return string(runes) + "…"
+}
@@ -0,0 +1,242 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/internal/cmd"
+	"github.com/numtide/nits/pkg/agent"
+	"github.com/numtide/nits/pkg/agent/config"
+	"github.com/numtide/nits/pkg/agent/info"
+	"github.com/numtide/nits/pkg/agent/secrets"
+	nexec "github.com/numtide/nits/pkg/exec"
+	nutil "github.com/numtide/nits/pkg/nats"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+type agentRemove struct {
+	Nats nutil.CliOptions `embed:"" prefix:"nats-"`
+
+	Cluster   string `required:"" help:"Name of the account under which the agent runs"`
+	PurgeLogs bool   `help:"Also purge the agent's logs and command output."`
+
+	Name string `arg:"" help:"Name, nkey or nkey prefix of the agent to remove"`
+}
+
+func (r *agentRemove) Run() (err error) {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	// agent users are named within the account, so resolve nkeys to names where possible
+	r.Name = r.resolveName()
+
+	var claims *jwt.UserClaims
+	if claims, err = describeUser(r.Cluster, r.Name); err != nil {
+		return
+	}
+	nkey := claims.Subject
+
+	log.Info("revoking agent user", "account", r.Cluster, "name", r.Name, "nkey", nkey)
+
+	nsc := cmd.LogExec(nexec.Nsc("revocations", "add-user", "-a", r.Cluster, "-u", nkey))
+	if _, err = nsc.Output(); err != nil {
+		nexec.LogError("failed to revoke agent user", err)
+		return
+	}
+
+	agentByName := subject.AgentWithName(r.Name)
+	log.Info("deleting subject mapping", "from", agentByName)
+
+	nsc = cmd.LogExec(nexec.Nsc("delete", "mapping", "-a", r.Cluster, "--from", agentByName))
+	if _, err = nsc.Output(); err != nil {
+		nexec.LogError("failed to delete subject mapping", err)
+		return
+	}
+
+	log.Info("deleting agent user", "name", r.Name)
+
+	nsc = cmd.LogExec(nexec.Nsc("delete", "user", "-a", r.Cluster, "-n", r.Name))
+	if _, err = nsc.Output(); err != nil {
+		nexec.LogError("failed to delete agent user", err)
+		return
+	}
+
+	log.Info("pushing account to server", "name", r.Cluster)
+
+	nsc = cmd.LogExec(nexec.Nsc("push", "-a", r.Cluster))
+	if _, err = nsc.Output(); err != nil {
+		nexec.LogError("failed to push account to server", err)
+		return
+	}
+
+	// now the agent can no longer connect, remove any trace of it from the cluster
+	if err = r.purge(nkey); err != nil {
+		return
+	}
+
+	return render(struct {
+		Name       string `json:"name"`
+		NKey       string `json:"nkey"`
+		Cluster    string `json:"cluster"`
+		PurgedLogs bool   `json:"purged-logs"`
+	}{r.Name, nkey, r.Cluster, r.PurgeLogs}, nil)
+}
+
+// resolveName looks up the agent within the registry, returning its name. Since an agent may have never connected, or
+// the registry may be unavailable, it falls back to treating the argument as a name.
+func (r *agentRemove) resolveName() string {
+	conn, err := r.Nats.Connect()
+	if err != nil {
+		log.Debug("unable to connect to resolve agent, assuming a name was provided", "error", err)
+		return r.Name
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var (
+		agents   []*info.Response
+		resolved *info.Response
+	)
+
+	if agents, err = agent.List(ctx, conn); err != nil {
+		log.Debug("unable to list agents, assuming a name was provided", "error", err)
+		return r.Name
+	} else if resolved, err = agent.Resolve(agents, r.Name); err != nil {
+		log.Debug("unable to resolve agent, assuming a name was provided", "error", err)
+		return r.Name
+	}
+	return resolved.Name
+}
+
+func (r *agentRemove) purge(nkey string) (err error) {
+	var (
+		conn *nats.Conn
+		js   nats.JetStreamContext
+		kv   nats.KeyValue
+	)
+
+	if conn, err = r.Nats.Connect(); err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if kv, err = agent.Registry(conn); err != nil {
+		return
+	}
+
+	log.Info("purging registry entry", "nkey", nkey)
+	if err = kv.Purge(nkey); err != nil {
+		return errors.Annotate(err, "failed to purge registry entry")
+	}
+
+	if kv, err = agent.Groups(conn); err != nil {
+		return
+	}
+
+	log.Info("purging groups and labels", "nkey", nkey)
+	if err = kv.Purge(nkey); err != nil {
+		return errors.Annotate(err, "failed to purge groups and labels")
+	}
+
+	if err = purgeSecrets(conn, nkey); err != nil {
+		return
+	}
+
+	if err = purgeSettings(conn, nkey); err != nil {
+		return
+	}
+
+	if js, err = conn.JetStream(); err != nil {
+		return
+	} else if err = purgeStream(js, streamAgentMetrics, subject.AgentMetrics(nkey)); err != nil {
+		return
+	} else if err = deleteFiles(js, nkey); err != nil {
+		return
+	}
+
+	if !r.PurgeLogs {
+		return
+	}
+
+	// the logs stream captures both the bare subject and those beneath it
+	for _, purge := range []struct{ stream, subject string }{
+		{streamAgentLogs, subject.AgentLogs(nkey)},
+		{streamAgentLogs, subject.AgentLogs(nkey) + ".>"},
+		{streamAgentOutput, subject.AgentOutput(nkey) + ".>"},
+	} {
+		if err = purgeStream(js, purge.stream, purge.subject); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// purgeSecrets removes every secret held for the agent. A missing bucket, e.g. for a cluster which has not been updated
+// since secrets were introduced, is treated as there being no secrets.
+func purgeSecrets(conn *nats.Conn, nkey string) error {
+	kv, err := secrets.Bucket(conn)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	held, err := secrets.List(ctx, conn, nkey)
+	if err != nil {
+		return errors.Annotate(err, "failed to list secrets")
+	}
+
+	for name := range held {
+		log.Info("purging secret", "nkey", nkey, "name", name)
+		if err = kv.Purge(secrets.Key(nkey, name)); err != nil {
+			return errors.Annotatef(err, "failed to purge secret %s", name)
+		}
+	}
+	return nil
+}
+
+// purgeSettings removes the remote settings for the agent. As with secrets, a missing bucket is treated as there being
+// no settings.
+func purgeSettings(conn *nats.Conn, nkey string) error {
+	kv, err := config.Bucket(conn)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	log.Info("purging settings", "nkey", nkey)
+	if err = kv.Purge(nkey); err != nil {
+		return errors.Annotate(err, "failed to purge settings")
+	}
+	return nil
+}
+
+// deleteFiles removes the agent's files object store, which only exists if files have been copied to or from it.
+func deleteFiles(js nats.JetStreamContext, nkey string) error {
+	log.Info("deleting files object store", "nkey", nkey)
+	err := js.DeleteObjectStore(subject.AgentFilesBucket(nkey))
+	if err != nil && !errors.Is(err, nats.ErrStreamNotFound) {
+		return errors.Annotate(err, "failed to delete files object store")
+	}
+	return nil
+}
+
+func purgeStream(js nats.JetStreamContext, stream string, subj string) error {
+	log.Info("purging stream", "stream", stream, "subject", subj)
+	if err := js.PurgeStream(stream, &nats.StreamPurgeRequest{Subject: subj}); err != nil {
+		return errors.Annotatef(err, "failed to purge %s", stream)
+	}
+	return nil
+}
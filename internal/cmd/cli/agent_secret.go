@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/internal/cmd"
+	"github.com/numtide/nits/pkg/agent/secrets"
+	nnats "github.com/numtide/nits/pkg/nats"
+	"github.com/xeonx/timeago"
+)
+
+type agentSecretSet struct {
+	Nats nnats.CliOptions `embed:"" prefix:"nats-"`
+
+	Name   string `arg:"" help:"Name, nkey or nkey prefix of the agent"`
+	Secret string `arg:"" help:"Name of the secret, which is also its file name on the agent"`
+
+	File  string `type:"existingfile" help:"File from which to read the secret. Read from stdin when not specified."`
+	Mode  string `default:"0400" help:"Octal mode of the secret file on the agent."`
+	Owner string `help:"Owner of the secret file on the agent."`
+	Group string `help:"Group of the secret file on the agent."`
+}
+
+func (s *agentSecretSet) Run() error {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	} else if err = secrets.ValidateName(s.Secret); err != nil {
+		return err
+	}
+
+	mode, err := strconv.ParseUint(s.Mode, 8, 32)
+	if err != nil {
+		return errors.Annotatef(err, "invalid mode %q", s.Mode)
+	}
+
+	var data []byte
+	if s.File != "" {
+		data, err = os.ReadFile(s.File)
+	} else {
+		data, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return errors.Annotate(err, "failed to read secret")
+	}
+
+	return cmd.Run(func(ctx context.Context) (err error) {
+		var (
+			conn   *nats.Conn
+			nkey   string
+			secret *secrets.Secret
+		)
+
+		if conn, err = s.Nats.Connect(); err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if nkey, err = resolveNKey(ctx, conn, s.Name); err != nil {
+			return
+		} else if secret, err = secrets.Seal(nkey, data); err != nil {
+			return
+		}
+
+		secret.Owner = s.Owner
+		secret.Group = s.Group
+		secret.Mode = os.FileMode(mode)
+
+		if err = secrets.Put(conn, nkey, s.Secret, secret); err != nil {
+			return
+		}
+
+		log.Info("secret set", "nkey", nkey, "name", s.Secret)
+		return nil
+	})
+}
+
+type agentSecretRemove struct {
+	Nats nnats.CliOptions `embed:"" prefix:"nats-"`
+
+	Name    string   `arg:"" help:"Name, nkey or nkey prefix of the agent"`
+	Secrets []string `arg:"" help:"Names of the secrets to remove"`
+}
+
+func (r *agentSecretRemove) Run() error {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	return cmd.Run(func(ctx context.Context) (err error) {
+		var (
+			conn *nats.Conn
+			nkey string
+		)
+
+		if conn, err = r.Nats.Connect(); err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if nkey, err = resolveNKey(ctx, conn, r.Name); err != nil {
+			return
+		}
+
+		for _, name := range r.Secrets {
+			if err = secrets.Delete(conn, nkey, name); err != nil {
+				return
+			}
+			log.Info("secret removed", "nkey", nkey, "name", name)
+		}
+		return nil
+	})
+}
+
+type agentSecretList struct {
+	Nats nnats.CliOptions `embed:"" prefix:"nats-"`
+
+	Name string `arg:"" help:"Name, nkey or nkey prefix of the agent"`
+}
+
+// secretSummary describes a secret without its sealed contents, which cannot be opened outside the agent.
+type secretSummary struct {
+	Name    string      `json:"name"`
+	Owner   string      `json:"owner,omitempty"`
+	Group   string      `json:"group,omitempty"`
+	Mode    os.FileMode `json:"mode"`
+	Updated time.Time   `json:"updated"`
+}
+
+func (l *agentSecretList) Run() error {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	return cmd.Run(func(ctx context.Context) (err error) {
+		var (
+			conn   *nats.Conn
+			nkey   string
+			values map[string]*secrets.Secret
+		)
+
+		if conn, err = l.Nats.Connect(); err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if nkey, err = resolveNKey(ctx, conn, l.Name); err != nil {
+			return
+		} else if values, err = secrets.List(ctx, conn, nkey); err != nil {
+			return
+		}
+
+		var summaries []secretSummary
+		for name, secret := range values {
+			mode := secret.Mode.Perm()
+			if mode == 0 {
+				mode = secrets.DefaultMode
+			}
+			summaries = append(summaries, secretSummary{
+				Name:    name,
+				Owner:   secret.Owner,
+				Group:   secret.Group,
+				Mode:    mode,
+				Updated: secret.Updated,
+			})
+		}
+
+		sort.Slice(summaries, func(i, j int) bool {
+			return summaries[i].Name < summaries[j].Name
+		})
+
+		return render(summaries, func() {
+			var rows []table.Row
+			for _, s := range summaries {
+				rows = append(rows, table.Row{
+					s.Name, s.Owner, s.Group, s.Mode.String(), timeago.English.Format(s.Updated),
+				})
+			}
+
+			t := table.New(
+				table.WithColumns([]table.Column{
+					{Title: "Name", Width: 32},
+					{Title: "Owner", Width: 16},
+					{Title: "Group", Width: 16},
+					{Title: "Mode", Width: 12},
+					{Title: "Updated", Width: 24},
+				}),
+				table.WithRows(rows),
+				table.WithFocused(false),
+				table.WithHeight(len(rows)),
+			)
+
+			t.SetStyles(tableStyle)
+
+			println(t.View())
+		})
+	})
+}
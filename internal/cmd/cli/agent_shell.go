@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+	"github.com/numtide/nits/internal/cmd"
+	"github.com/numtide/nits/pkg/agent/info"
+	"github.com/numtide/nits/pkg/agent/shell"
+	nnats "github.com/numtide/nits/pkg/nats"
+	"golang.org/x/term"
+)
+
+type agentShell struct {
+	Nats nnats.CliOptions `embed:"" prefix:"nats-"`
+	Name string           `arg:"" help:"Name, nkey or nkey prefix of the agent"`
+}
+
+func (s *agentShell) Run() error {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	return cmd.Run(func(ctx context.Context) (err error) {
+		var (
+			conn    *nats.Conn
+			encoded *nats.EncodedConn
+			target  *info.Response
+			pipe    *nnats.Pipe
+			exitSub *nats.Subscription
+			resp    shell.Response
+		)
+
+		if conn, err = s.Nats.Connect(); err != nil {
+			return
+		} else if encoded, err = nats.NewEncodedConn(conn, nats.JSON_ENCODER); err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if target, err = resolveOnline(ctx, conn, s.Name); err != nil {
+			return
+		}
+
+		id := nuid.Next()
+
+		// subscribe before opening the session so we don't miss any output
+		if pipe, err = nnats.NewPipe(conn, shell.ClientSubject(target.NKey, id), shell.AgentSubject(target.NKey, id), nnats.DefaultPipeWindow); err != nil {
+			return
+		}
+		defer func() {
+			_ = pipe.Close()
+		}()
+
+		if exitSub, err = conn.SubscribeSync(shell.ExitSubject(target.NKey, id)); err != nil {
+			return
+		}
+
+		stdin := int(os.Stdin.Fd())
+		interactive := term.IsTerminal(stdin)
+
+		req := shell.Request{Id: id, Term: os.Getenv("TERM")}
+		if interactive {
+			var cols, rows int
+			if cols, rows, err = term.GetSize(stdin); err != nil {
+				return errors.Annotate(err, "failed to get terminal size")
+			}
+			req.Rows, req.Cols = uint16(rows), uint16(cols)
+		}
+
+		openCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		if resp, err = shell.OpenWithContext(openCtx, encoded, target.NKey, req); err != nil {
+			return
+		}
+
+		log.Info("shell session opened", "name", target.Name, "id", resp.Id, "recording", resp.Recording)
+
+		if interactive {
+			var state *term.State
+			if state, err = term.MakeRaw(stdin); err != nil {
+				return errors.Annotate(err, "failed to put terminal into raw mode")
+			}
+			defer func() {
+				_ = term.Restore(stdin, state)
+			}()
+
+			go s.forwardResize(ctx, conn, target.NKey, id)
+		}
+
+		go func() {
+			if _, err := io.Copy(pipe, os.Stdin); err == nil {
+				// the pty only treats the EOF character as end of input, e.g. when stdin is redirected from a file
+				_, _ = pipe.Write([]byte{shell.EOF})
+			}
+		}()
+
+		go func() {
+			// e.g. SIGTERM, closing the pipe causes the agent to hang up
+			<-ctx.Done()
+			_ = pipe.Close()
+		}()
+
+		if _, err = io.Copy(os.Stdout, pipe); err != nil && !errors.Is(err, nnats.ErrPipeClosed) {
+			return
+		}
+		err = nil
+
+		// the exit code is published just after the session closes
+		msg, exitErr := exitSub.NextMsg(2 * time.Second)
+		if exitErr != nil {
+			return nil
+		}
+
+		var exit shell.Exit
+		if err = json.Unmarshal(msg.Data, &exit); err != nil {
+			return errors.Annotate(err, "failed to unmarshal exit")
+		} else if exit.ExitCode > 0 {
+			return &cmd.ExitCodeError{Code: exit.ExitCode}
+		}
+		return nil
+	})
+}
+
+// forwardResize publishes changes to the size of the local terminal.
+func (s *agentShell) forwardResize(ctx context.Context, conn *nats.Conn, nkey string, id string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGWINCH)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			cols, rows, err := term.GetSize(int(os.Stdin.Fd()))
+			if err != nil {
+				continue
+			}
+			data, _ := json.Marshal(shell.Resize{Rows: uint16(rows), Cols: uint16(cols)})
+			if err = conn.Publish(shell.ResizeSubject(nkey, id), data); err != nil {
+				log.Debug("failed to publish resize", "error", err)
+			}
+		}
+	}
+}
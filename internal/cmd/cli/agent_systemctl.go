@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/dustin/go-humanize"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/internal/cmd"
+	"github.com/numtide/nits/pkg/agent/info"
+	"github.com/numtide/nits/pkg/agent/systemd"
+	nutil "github.com/numtide/nits/pkg/nats"
+)
+
+type agentSystemctl struct {
+	Nats   nutil.CliOptions `embed:"" prefix:"nats-"`
+	Name   string           `arg:"" help:"Name, nkey or nkey prefix of the agent"`
+	Action string           `arg:"" enum:"list,status,start,stop,restart" help:"One of list, status, start, stop or restart."`
+	Units  []string         `arg:"" optional:"" help:"Units to act upon. When listing, glob patterns used to filter the units."`
+
+	All     bool          `help:"When listing, include units which are inactive or have not been loaded."`
+	Timeout time.Duration `default:"2m" help:"How long to wait for the agent to respond."`
+}
+
+func (s *agentSystemctl) Run() error {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	if s.Action != "list" && len(s.Units) == 0 {
+		return errors.Errorf("at least one unit is required for %s", s.Action)
+	}
+
+	return cmd.Run(func(ctx context.Context) (err error) {
+		var (
+			conn    *nats.Conn
+			encoded *nats.EncodedConn
+			target  *info.Response
+		)
+
+		if conn, err = s.Nats.Connect(); err != nil {
+			return
+		} else if encoded, err = nats.NewEncodedConn(conn, nats.JSON_ENCODER); err != nil {
+			return
+		}
+
+		if target, err = resolveOnline(ctx, conn, s.Name); err != nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+
+		if s.Action == "list" {
+			var resp systemd.ListResponse
+			if err = systemd.ListWithContext(ctx, encoded, target.NKey, systemd.ListRequest{Patterns: s.Units, All: s.All}, &resp); err != nil {
+				return
+			}
+			return render(resp.Units, func() {
+				printUnits(resp.Units)
+			})
+		}
+
+		var statuses []*systemd.Status
+		for _, unit := range s.Units {
+			status := &systemd.Status{}
+
+			switch s.Action {
+			case "status":
+				err = systemd.StatusWithContext(ctx, encoded, target.NKey, systemd.StatusRequest{Unit: unit}, status)
+			default:
+				req := systemd.ControlRequest{Action: systemd.ControlAction(s.Action), Unit: unit}
+				err = systemd.ControlWithContext(ctx, encoded, target.NKey, req, status)
+			}
+
+			if err != nil {
+				return errors.Annotatef(err, "failed to %s %s", s.Action, unit)
+			}
+			statuses = append(statuses, status)
+		}
+
+		return render(statuses, func() {
+			for i, status := range statuses {
+				if i > 0 {
+					println()
+				}
+				printUnitStatus(status)
+			}
+		})
+	})
+}
+
+func printUnits(units []systemd.Unit) {
+	columns := []table.Column{
+		{Title: "Unit", Width: 48},
+		{Title: "Load", Width: 10},
+		{Title: "Active", Width: 10},
+		{Title: "Sub", Width: 10},
+		{Title: "Description", Width: 64},
+	}
+
+	var rows []table.Row
+	for _, u := range units {
+		rows = append(rows, table.Row{u.Name, u.Load, u.Active, u.Sub, u.Description})
+	}
+
+	t := table.New(
+		table.WithColumns(columns),
+		table.WithRows(rows),
+		table.WithFocused(false),
+		table.WithHeight(len(rows)),
+	)
+
+	t.SetStyles(tableStyle)
+
+	println(t.View())
+}
+
+func printUnitStatus(status *systemd.Status) {
+	println(sectionHeaderStyle.Render(status.Name + ":"))
+	println()
+
+	kvPrintln("Description:", status.Description)
+	kvPrintln("Loaded:", status.LoadState)
+	if status.UnitFileState != "" {
+		kvPrintln("Unit File State:", status.UnitFileState)
+	}
+	if status.FragmentPath != "" {
+		kvPrintln("Fragment Path:", status.FragmentPath)
+	}
+	kvPrintln("Active:", status.ActiveState+" ("+status.SubState+")")
+	if status.ActiveSince != nil {
+		kvPrintln("Active Since:", status.ActiveSince.Format(time.RFC1123Z))
+	}
+	if status.MainPID > 0 {
+		kvPrintln("Main PID:", strconv.Itoa(status.MainPID))
+	}
+	kvPrintln("Exit Status:", strconv.Itoa(status.ExitStatus))
+	kvPrintln("Restarts:", strconv.Itoa(status.Restarts))
+	if status.MemoryCurrent > 0 {
+		kvPrintln("Memory:", humanize.IBytes(status.MemoryCurrent))
+	}
+	kvPrintln("Controllable:", strconv.FormatBool(status.Controllable))
+}
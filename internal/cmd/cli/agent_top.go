@@ -0,0 +1,377 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+	"github.com/dustin/go-humanize"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/internal/cmd"
+	"github.com/numtide/nits/pkg/agent"
+	"github.com/numtide/nits/pkg/agent/info"
+	"github.com/numtide/nits/pkg/agent/metrics"
+	nnats "github.com/numtide/nits/pkg/nats"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+type agentTop struct {
+	Nats    nnats.CliOptions `embed:"" prefix:"nats-"`
+	Targets agentTargets     `embed:""`
+}
+
+func (t *agentTop) Run() error {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	if structuredOutput() {
+		return errors.New("agent top is interactive and cannot be combined with json or yaml output")
+	}
+
+	return cmd.Run(func(ctx context.Context) (err error) {
+		var (
+			conn   *nats.Conn
+			js     nats.JetStreamContext
+			agents []*info.Response
+			events <-chan agent.Event
+		)
+
+		if conn, err = t.Nats.Connect(); err != nil {
+			return
+		} else if js, err = conn.JetStream(); err != nil {
+			return
+		}
+
+		listCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		if agents, err = agent.List(listCtx, conn); err != nil {
+			return
+		} else if agents, err = t.Targets.filter(agents); err != nil {
+			return
+		}
+
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+
+		model := newTopModel(agents, t.Targets.isSet())
+		program := tea.NewProgram(model, tea.WithAltScreen(), tea.WithContext(ctx))
+
+		// the most recent metrics for each agent, followed by any which are published from now on
+		msgs := make(chan *nats.Msg, 1024)
+		if _, err = js.ChanSubscribe(subject.AgentMetricsAll(), msgs, nats.DeliverLastPerSubject(), nats.AckNone()); err != nil {
+			return errors.Annotate(err, "failed to subscribe to agent metrics")
+		}
+
+		if events, err = agent.Watch(ctx, conn); err != nil {
+			return
+		}
+
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case msg := <-msgs:
+					var m metrics.Metrics
+					if err := json.Unmarshal(msg.Data, &m); err != nil {
+						log.Debug("failed to unmarshal metrics", "subject", msg.Subject, "error", err)
+						continue
+					}
+					program.Send(topMetricsMsg{nkey: subject.AgentNKeyForSubject(msg.Subject), metrics: &m})
+				case event, ok := <-events:
+					if !ok {
+						return
+					}
+					program.Send(topEventMsg(event))
+				}
+			}
+		}()
+
+		if _, err = program.Run(); errors.Is(err, tea.ErrProgramKilled) {
+			// the context was cancelled
+			err = nil
+		}
+		return
+	})
+}
+
+type topMetricsMsg struct {
+	nkey    string
+	metrics *metrics.Metrics
+}
+
+type topEventMsg agent.Event
+
+type topTickMsg time.Time
+
+type topSort int
+
+const (
+	sortByName topSort = iota
+	sortByLoad
+	sortByMemory
+	sortByDisk
+	sortByNetwork
+)
+
+var topSortNames = []string{"name", "load", "memory", "disk", "network"}
+
+type topRow struct {
+	agent   *info.Response
+	current *metrics.Metrics
+
+	// network throughput in bytes per second, derived from consecutive samples
+	rxRate float64
+	txRate float64
+}
+
+func (r *topRow) memoryPercent() float64 {
+	if r.current == nil || r.current.Memory == nil || r.current.Memory.Total == 0 {
+		return 0
+	}
+	return 100 * float64(r.current.Memory.Used) / float64(r.current.Memory.Total)
+}
+
+// diskPercent returns the usage of the fullest mount, which is usually what matters.
+func (r *topRow) diskPercent() (mount string, percent float64) {
+	if r.current == nil {
+		return
+	}
+	for _, d := range r.current.Disks {
+		if d.Total == 0 {
+			continue
+		}
+		if p := 100 * float64(d.Used) / float64(d.Total); p > percent {
+			mount, percent = d.Mountpoint, p
+		}
+	}
+	return
+}
+
+func (r *topRow) load() float64 {
+	if r.current == nil || r.current.Load == nil {
+		return 0
+	}
+	return r.current.Load.Load1
+}
+
+type topModel struct {
+	rows map[string]*topRow
+	// when filtering by group or selector, agents which join later are ignored
+	fixed bool
+
+	sort    topSort
+	reverse bool
+
+	table  table.Model
+	width  int
+	height int
+}
+
+func newTopModel(agents []*info.Response, fixed bool) *topModel {
+	m := &topModel{
+		rows:  make(map[string]*topRow),
+		fixed: fixed,
+		table: table.New(
+			table.WithColumns([]table.Column{
+				{Title: "Name", Width: 24},
+				{Title: "Status", Width: 8},
+				{Title: "Load", Width: 16},
+				{Title: "Memory", Width: 8},
+				{Title: "Swap", Width: 8},
+				{Title: "Disk", Width: 20},
+				{Title: "Rx/s", Width: 10},
+				{Title: "Tx/s", Width: 10},
+				{Title: "Nix Store", Width: 10},
+				{Title: "Updated", Width: 10},
+			}),
+			table.WithFocused(true),
+		),
+	}
+
+	styles := tableStyle
+	styles.Selected = selectedStyle
+	m.table.SetStyles(styles)
+
+	for _, a := range agents {
+		m.rows[a.NKey] = &topRow{agent: a}
+	}
+	m.refresh()
+
+	return m
+}
+
+func topTick() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
+		return topTickMsg(t)
+	})
+}
+
+func (m *topModel) Init() tea.Cmd {
+	return topTick()
+}
+
+func (m *topModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.table.SetHeight(msg.Height - 2)
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c", "esc":
+			return m, tea.Quit
+		case "s":
+			m.sort = (m.sort + 1) % topSort(len(topSortNames))
+			m.refresh()
+			return m, nil
+		case "r":
+			m.reverse = !m.reverse
+			m.refresh()
+			return m, nil
+		}
+
+	case topTickMsg:
+		// keeps the updated column current
+		m.refresh()
+		return m, topTick()
+
+	case topEventMsg:
+		row, ok := m.rows[msg.Agent.NKey]
+		if !ok && m.fixed {
+			return m, nil
+		} else if !ok {
+			row = &topRow{}
+			m.rows[msg.Agent.NKey] = row
+		}
+		row.agent = msg.Agent
+		m.refresh()
+		return m, nil
+
+	case topMetricsMsg:
+		row, ok := m.rows[msg.nkey]
+		if !ok {
+			// metrics from an agent we are not interested in, or which has not registered
+			return m, nil
+		}
+		row.rxRate, row.txRate = networkRates(row.current, msg.metrics)
+		row.current = msg.metrics
+		m.refresh()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.table, cmd = m.table.Update(msg)
+	return m, cmd
+}
+
+func (m *topModel) View() string {
+	status := statusStyle.Render(fmt.Sprintf(
+		"%d agents • sort: %s (s) • reverse (r) • quit (q)", len(m.rows), topSortNames[m.sort],
+	))
+	return m.table.View() + "\n" + status
+}
+
+// refresh rebuilds the table rows in the selected order.
+func (m *topModel) refresh() {
+	rows := make([]*topRow, 0, len(m.rows))
+	for _, row := range m.rows {
+		rows = append(rows, row)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if m.reverse {
+			a, b = b, a
+		}
+
+		var less bool
+		switch m.sort {
+		case sortByLoad:
+			less = a.load() > b.load()
+		case sortByMemory:
+			less = a.memoryPercent() > b.memoryPercent()
+		case sortByDisk:
+			_, pa := a.diskPercent()
+			_, pb := b.diskPercent()
+			less = pa > pb
+		case sortByNetwork:
+			less = a.rxRate+a.txRate > b.rxRate+b.txRate
+		default:
+			less = strings.ToLower(a.agent.Name) < strings.ToLower(b.agent.Name)
+		}
+		return less
+	})
+
+	var tableRows []table.Row
+	for _, row := range rows {
+		status := "offline"
+		if row.agent.Online {
+			status = "online"
+		}
+
+		cells := table.Row{row.agent.Name, status, "", "", "", "", "", "", "", ""}
+
+		if current := row.current; current != nil {
+			if current.Load != nil {
+				cells[2] = fmt.Sprintf("%.2f %.2f %.2f", current.Load.Load1, current.Load.Load5, current.Load.Load15)
+			}
+			if current.Memory != nil {
+				cells[3] = fmt.Sprintf("%.0f%%", row.memoryPercent())
+				if current.Memory.SwapTotal > 0 {
+					cells[4] = fmt.Sprintf("%.0f%%", 100*float64(current.Memory.SwapUsed)/float64(current.Memory.SwapTotal))
+				}
+			}
+			if mount, percent := row.diskPercent(); mount != "" {
+				cells[5] = fmt.Sprintf("%.0f%% %s", percent, mount)
+			}
+			cells[6] = humanize.IBytes(uint64(row.rxRate))
+			cells[7] = humanize.IBytes(uint64(row.txRate))
+			if current.NixStore != nil {
+				cells[8] = humanize.IBytes(current.NixStore.Size)
+			}
+			cells[9] = time.Since(current.Timestamp).Round(time.Second).String()
+		}
+
+		tableRows = append(tableRows, cells)
+	}
+
+	m.table.SetRows(tableRows)
+}
+
+// networkRates computes the combined receive and transmit rates across all interfaces between two samples.
+func networkRates(prev *metrics.Metrics, current *metrics.Metrics) (rx float64, tx float64) {
+	if prev == nil || current == nil {
+		return
+	}
+
+	elapsed := current.Timestamp.Sub(prev.Timestamp).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+
+	previous := make(map[string]metrics.Network, len(prev.Network))
+	for _, n := range prev.Network {
+		previous[n.Name] = n
+	}
+
+	for _, n := range current.Network {
+		p, ok := previous[n.Name]
+		// counters reset when an interface is recreated or the host reboots
+		if !ok || n.BytesRecv < p.BytesRecv || n.BytesSent < p.BytesSent {
+			continue
+		}
+		rx += float64(n.BytesRecv-p.BytesRecv) / elapsed
+		tx += float64(n.BytesSent-p.BytesSent) / elapsed
+	}
+	return
+}
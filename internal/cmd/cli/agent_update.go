@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/jwt/v2"
+	"github.com/numtide/nits/internal/cmd"
+	nexec "github.com/numtide/nits/pkg/exec"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+type agentUpdate struct {
+	Cluster string `required:"" help:"Name of the account under which the agents run"`
+	JwtDir  string `type:"existingdir" help:"Write the updated JWT for each agent to this directory, as <name>.jwt."`
+
+	Names []string `arg:"" help:"Names of the agent users to update, as listed by nsc list users"`
+}
+
+// Run grants existing agent users the permissions which agent add would grant today, removing any they no longer need.
+// Agents which were added by an earlier version cannot otherwise reach subjects introduced since, such as the registry
+// bucket, file transfers, secrets and remote settings. Each agent must then be given its updated JWT.
+func (u *agentUpdate) Run() (err error) {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	type updated struct {
+		Name    string `json:"name"`
+		NKey    string `json:"nkey"`
+		JwtFile string `json:"jwt-file,omitempty"`
+	}
+
+	var result []updated
+
+	for _, name := range u.Names {
+		var claims *jwt.UserClaims
+		if claims, err = describeUser(u.Cluster, name); err != nil {
+			return
+		}
+
+		nkey := claims.Subject
+		if !slices.Contains(claims.Pub.Allow, subject.AgentWithNKey(nkey)+".>") {
+			return errors.Errorf("user %s is not an agent", name)
+		}
+
+		grants := agentPermissions(nkey)
+		args := append([]string{"edit", "user", "-a", u.Cluster, "-n", name}, grants...)
+
+		// drop anything granted by an earlier version which is no longer required
+		var stale []string
+		for _, subj := range append(claims.Pub.Allow, claims.Sub.Allow...) {
+			if !slices.Contains(grants, subj) && !slices.Contains(stale, subj) {
+				stale = append(stale, subj)
+				args = append(args, "--rm", subj)
+			}
+		}
+
+		log.Info("updating agent user permissions", "account", u.Cluster, "name", name, "nkey", nkey)
+
+		if _, err = cmd.LogExec(nexec.Nsc(args...)).Output(); err != nil {
+			nexec.LogError("failed to update agent user", err)
+			return
+		}
+
+		entry := updated{Name: name, NKey: nkey}
+
+		if u.JwtDir != "" {
+			var b []byte
+			if b, err = cmd.LogExec(nexec.Nsc("describe", "user", "-a", u.Cluster, "-n", name, "-R")).Output(); err != nil {
+				nexec.LogError("failed to export agent user", err)
+				return
+			}
+
+			entry.JwtFile = filepath.Join(u.JwtDir, name+".jwt")
+			if err = os.WriteFile(entry.JwtFile, b, 0o600); err != nil {
+				return errors.Annotate(err, "failed to write agent user jwt")
+			}
+			log.Info("wrote agent user jwt", "name", name, "path", entry.JwtFile)
+		}
+
+		result = append(result, entry)
+	}
+
+	return render(result, nil)
+}
+
+// describeUser looks up a user within the cluster account, returning its claims.
+func describeUser(cluster string, name string) (claims *jwt.UserClaims, err error) {
+	var b []byte
+	if b, err = cmd.LogExec(nexec.Nsc("describe", "user", "-a", cluster, "-n", name, "-J")).Output(); err != nil {
+		nexec.LogError("failed to describe agent user", err)
+		return
+	}
+
+	claims = &jwt.UserClaims{}
+	if err = json.Unmarshal(b, claims); err != nil {
+		return nil, errors.Annotate(err, "failed to parse agent user")
+	} else if claims.Subject == "" {
+		return nil, errors.Errorf("agent user %s has no public key", name)
+	}
+
+	return claims, nil
+}
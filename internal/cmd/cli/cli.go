@@ -1,19 +1,75 @@
 package cli
 
-import "github.com/numtide/nits/internal/cmd"
+import (
+	"time"
+
+	"github.com/numtide/nits/internal/cmd"
+	"github.com/numtide/nits/pkg/agent"
+)
 
 var Cmd struct {
-	Log cmd.LogOptions `embed:""`
+	Log        cmd.LogOptions `embed:""`
+	StaleAfter staleAfter     `default:"90s" help:"Consider an agent offline if it has not been seen for this long."`
+	Output     string         `short:"o" enum:"table,json,yaml" default:"table" help:"Output format, one of table, json or yaml."`
 
 	Agent struct {
-		Add    agentAdd    `cmd:"" help:"Add an agent to a cluster"`
-		List   agentList   `cmd:"" name:"ls" help:"List agents within a cluster"`
-		Info   agentInfo   `cmd:"" help:"Show info about an agent"`
-		Logs   agentLogs   `cmd:"" help:"Show logs for an agent"`
-		Deploy agentDeploy `cmd:"" help:"Deploy to an agent"`
+		Add       agentAdd       `cmd:"" help:"Add an agent to a cluster"`
+		Remove    agentRemove    `cmd:"" name:"rm" help:"Remove an agent from a cluster, revoking its access"`
+		Update    agentUpdate    `cmd:"" help:"Grant existing agents the permissions required by this version"`
+		List      agentList      `cmd:"" name:"ls" help:"List agents within a cluster"`
+		Info      agentInfo      `cmd:"" help:"Show info about an agent"`
+		Logs      agentLogs      `cmd:"" help:"Show logs for an agent"`
+		LogLevel  agentLogLevel  `cmd:"" name:"log-level" help:"Temporarily change the log level of an agent"`
+		Deploy    agentDeploy    `cmd:"" help:"Deploy to an agent"`
+		Top       agentTop       `cmd:"" help:"Show a live overview of agent metrics"`
+		Systemctl agentSystemctl `cmd:"" help:"Inspect and control systemd units on an agent"`
+		Exec      agentExec      `cmd:"" help:"Run a command on an agent"`
+		Shell     agentShell     `cmd:"" help:"Open an interactive shell on an agent"`
+		Forward   agentForward   `cmd:"" help:"Forward local TCP ports to addresses reachable from an agent"`
+		Copy      agentCopy      `cmd:"" name:"cp" help:"Copy a file to or from an agent"`
+
+		Label struct {
+			Set   agentLabelSet   `cmd:"" help:"Set labels on an agent"`
+			Unset agentLabelUnset `cmd:"" help:"Remove labels from an agent. Labels configured on the agent itself are unaffected."`
+		} `cmd:"" help:"Manage the labels assigned to agents"`
+
+		Group struct {
+			Add    agentGroupAdd    `cmd:"" help:"Add an agent to groups"`
+			Remove agentGroupRemove `cmd:"" name:"rm" help:"Remove an agent from groups"`
+		} `cmd:"" help:"Manage the groups agents belong to"`
+
+		Config struct {
+			Get   agentConfigGet   `cmd:"" help:"Show the settings stored for an agent"`
+			Set   agentConfigSet   `cmd:"" help:"Change settings on running agents"`
+			Unset agentConfigUnset `cmd:"" help:"Remove settings, reverting to the defaults or an agent's local configuration"`
+		} `cmd:"" help:"Manage settings applied to agents whilst they are running"`
+
+		Secret struct {
+			Set    agentSecretSet    `cmd:"" help:"Set a secret for an agent, read from a file or stdin"`
+			Remove agentSecretRemove `cmd:"" name:"rm" help:"Remove secrets from an agent"`
+			List   agentSecretList   `cmd:"" name:"ls" help:"List the secrets held for an agent"`
+		} `cmd:"" help:"Manage the secrets delivered to agents"`
 	} `cmd:"" help:"Agent related functions"`
 
+	LogForwarder logForwarder `cmd:"" name:"log-forwarder" help:"Forward agent logs to external sinks. Records are delivered at least once."`
+	Exporter     exporter     `cmd:"" help:"Serve fleet metrics and deployment state for Prometheus"`
+
 	Cluster struct {
-		Add clusterAdd `cmd:""`
+		Add    clusterAdd    `cmd:""`
+		Update clusterUpdate `cmd:"" help:"Update the streams within a cluster, applying any changes to their limits"`
 	} `cmd:"" help:"Cluster related functions"`
 }
+
+// staleAfter applies the threshold used when determining whether an agent in the registry is still online.
+type staleAfter time.Duration
+
+func (s *staleAfter) UnmarshalText(text []byte) error {
+	d, err := time.ParseDuration(string(text))
+	*s = staleAfter(d)
+	return err
+}
+
+func (s *staleAfter) AfterApply() error {
+	agent.StaleAfter = time.Duration(*s)
+	return nil
+}
@@ -3,7 +3,6 @@ package cli
 import (
 	"errors"
 	"fmt"
-	"os"
 	"os/exec"
 
 	nsccmd "github.com/nats-io/nsc/v2/cmd"
@@ -14,6 +13,8 @@ import (
 )
 
 type clusterAdd struct {
+	Limits streamLimits `embed:""`
+
 	Name string `arg:"" help:"Name of the account under which Agents will run"`
 }
 
@@ -70,7 +71,7 @@ func (c *clusterAdd) Run() (err error) {
 		}
 	}
 
-	adminContext := fmt.Sprintf("%s-%s-%s", op.Name, c.Name, "Admin")
+	adminContext := adminContextName(op, c.Name)
 	log.Info("generating an admin context", "name", adminContext)
 
 	nsc = cmd.LogExec(nexec.Nsc("generate", "context", "-a", c.Name, "-u", "Admin", "--context", adminContext))
@@ -88,31 +89,26 @@ func (c *clusterAdd) Run() (err error) {
 		return
 	}
 
-	var logsConfig, registryConfig *os.File
-	if logsConfig, err = openResourceLocally(streamConfig, "streams/agent-logs.json"); err != nil {
-		return err
-	}
-	if registryConfig, err = openResourceLocally(streamConfig, "streams/agent-registry.json"); err != nil {
-		return err
-	}
-
 	log.Info("adding streams")
 
-	nats := cmd.LogExec(nexec.Nats("--context", adminContext, "stream", "add", "--config", logsConfig.Name()))
-
-	if _, err = nats.Output(); err != nil {
-		nexec.LogError("failed to add logs stream", err)
-		return
+	for _, name := range clusterStreams {
+		if err = applyStream(adminContext, name, &c.Limits); err != nil {
+			return
+		}
 	}
 
-	nats = cmd.LogExec(nexec.Nats("--context", adminContext, "stream", "add", "--config", registryConfig.Name()))
+	log.Info("setup complete")
 
-	if _, err = nats.Output(); err != nil {
-		nexec.LogError("failed to add logs stream", err)
-		return
-	}
+	return render(clusterSummary{Name: c.Name, Context: adminContext, Streams: clusterStreams}, nil)
+}
 
-	log.Info("setup complete")
+type clusterSummary struct {
+	Name    string   `json:"name"`
+	Context string   `json:"context"`
+	Streams []string `json:"streams"`
+}
 
-	return nil
+// adminContextName returns the name of the nats cli context which is generated for the admin user of a cluster.
+func adminContextName(op nsccmd.OperatorDescriber, cluster string) string {
+	return fmt.Sprintf("%s-%s-%s", op.Name, cluster, "Admin")
 }
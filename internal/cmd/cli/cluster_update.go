@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"github.com/charmbracelet/log"
+	nsccmd "github.com/nats-io/nsc/v2/cmd"
+	nexec "github.com/numtide/nits/pkg/exec"
+)
+
+type clusterUpdate struct {
+	Limits streamLimits `embed:""`
+
+	Name string `arg:"" help:"Name of the account under which Agents will run"`
+}
+
+func (c *clusterUpdate) Run() (err error) {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	var op nsccmd.OperatorDescriber
+	if op, err = nexec.DescribeOperator(); err != nil {
+		return
+	}
+
+	adminContext := adminContextName(op, c.Name)
+
+	log.Info("updating streams", "cluster", c.Name, "context", adminContext)
+
+	// streams which are missing, e.g. those introduced after the cluster was created, will be added
+	for _, name := range clusterStreams {
+		if err = applyStream(adminContext, name, &c.Limits); err != nil {
+			return
+		}
+	}
+
+	// each agent's files object store is created on first use, so we only update those which exist
+	if err = applyFilesStreams(adminContext, &c.Limits); err != nil {
+		return
+	}
+
+	log.Info("update complete")
+
+	return render(clusterSummary{Name: c.Name, Context: adminContext, Streams: clusterStreams}, nil)
+}
@@ -0,0 +1,412 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/internal/cmd"
+	"github.com/numtide/nits/pkg/agent"
+	"github.com/numtide/nits/pkg/agent/info"
+	"github.com/numtide/nits/pkg/agent/metrics"
+	nnats "github.com/numtide/nits/pkg/nats"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+type exporter struct {
+	Nats nnats.CliOptions `embed:"" prefix:"nats-"`
+
+	Listen string `default:":9464" help:"Address on which to serve metrics."`
+}
+
+// exporterState is the latest view of the fleet, built from the agent registry, published metrics and deployment
+// events.
+type exporterState struct {
+	lock sync.RWMutex
+
+	agents  map[string]*info.Response
+	metrics map[string]*metrics.Metrics
+	// number of deployments by nkey and then outcome, observed since the exporter started
+	deployments map[string]map[info.DeploymentOutcome]uint64
+}
+
+func (e *exporter) Run() error {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	return cmd.Run(func(ctx context.Context) (err error) {
+		var (
+			conn    *nats.Conn
+			js      nats.JetStreamContext
+			kv      nats.KeyValue
+			watcher nats.KeyWatcher
+		)
+
+		state := &exporterState{
+			agents:      make(map[string]*info.Response),
+			metrics:     make(map[string]*metrics.Metrics),
+			deployments: make(map[string]map[info.DeploymentOutcome]uint64),
+		}
+
+		if conn, err = e.Nats.Connect(); err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if js, err = conn.JetStream(); err != nil {
+			return
+		} else if kv, err = agent.Registry(conn); err != nil {
+			return
+		} else if watcher, err = kv.WatchAll(nats.Context(ctx)); err != nil {
+			return
+		}
+
+		go func() {
+			for entry := range watcher.Updates() {
+				if entry != nil {
+					state.onRegistration(entry)
+				}
+			}
+		}()
+
+		// agents which stop publishing leave no trace in the registry, so we rely on the watch to expire them
+		var events <-chan agent.Event
+		if events, err = agent.Watch(ctx, conn); err != nil {
+			return
+		}
+
+		go func() {
+			for event := range events {
+				if event.Type == agent.EventLeave {
+					state.onLeave(event.Agent)
+				}
+			}
+		}()
+
+		if _, err = js.Subscribe(subject.AgentMetricsAll(), state.onMetrics, nats.DeliverLastPerSubject(), nats.AckNone()); err != nil {
+			return errors.Annotate(err, "failed to subscribe to agent metrics")
+		} else if _, err = conn.Subscribe(subject.AgentDeploymentAll(), state.onDeployment); err != nil {
+			return errors.Annotate(err, "failed to subscribe to deployment events")
+		}
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+			if err := state.write(w); err != nil {
+				log.Error("failed to write metrics", "error", err)
+			}
+		})
+
+		server := &http.Server{
+			Addr:              e.Listen,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = server.Shutdown(shutdownCtx)
+		}()
+
+		log.Info("serving metrics", "address", e.Listen)
+
+		if err = server.ListenAndServe(); errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		return
+	})
+}
+
+func (s *exporterState) onRegistration(entry nats.KeyValueEntry) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if entry.Operation() != nats.KeyValuePut {
+		// the agent has been removed
+		delete(s.agents, entry.Key())
+		delete(s.metrics, entry.Key())
+		delete(s.deployments, entry.Key())
+		return
+	}
+
+	resp, err := agent.UnmarshalRegistration(entry)
+	if err != nil {
+		log.Warn("failed to unmarshal agent registration", "key", entry.Key(), "error", err)
+		return
+	}
+	s.agents[entry.Key()] = resp
+}
+
+// onLeave marks an agent as offline, provided it has not re-registered since the event was emitted.
+func (s *exporterState) onLeave(left *info.Response) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if a, ok := s.agents[left.NKey]; ok && !a.LastSeen.After(left.LastSeen) {
+		a.Online = false
+	}
+}
+
+func (s *exporterState) onMetrics(msg *nats.Msg) {
+	var m metrics.Metrics
+	if err := json.Unmarshal(msg.Data, &m); err != nil {
+		log.Warn("failed to unmarshal metrics", "subject", msg.Subject, "error", err)
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.metrics[subject.AgentNKeyForSubject(msg.Subject)] = &m
+}
+
+func (s *exporterState) onDeployment(msg *nats.Msg) {
+	var deployment info.Deployment
+	if err := json.Unmarshal(msg.Data, &deployment); err != nil {
+		log.Warn("failed to unmarshal deployment event", "subject", msg.Subject, "error", err)
+		return
+	}
+
+	nkey := subject.AgentNKeyForSubject(msg.Subject)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	counts, ok := s.deployments[nkey]
+	if !ok {
+		counts = make(map[info.DeploymentOutcome]uint64)
+		s.deployments[nkey] = counts
+	}
+	counts[deployment.Outcome]++
+}
+
+// write renders the current state in the Prometheus text exposition format.
+func (s *exporterState) write(w io.Writer) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	nkeys := make([]string, 0, len(s.agents))
+	for nkey := range s.agents {
+		nkeys = append(nkeys, nkey)
+	}
+	sort.Strings(nkeys)
+
+	p := &promWriter{w: w}
+
+	// each metric family must be written contiguously, so we iterate the agents once per family
+	forEach := func(name string, kind string, help string, fn func(a *info.Response, labels []string)) {
+		p.family(name, kind, help)
+		for _, nkey := range nkeys {
+			a := s.agents[nkey]
+			fn(a, []string{"nkey", a.NKey, "name", a.Name})
+		}
+	}
+
+	forEach("nits_agent_info", "gauge", "Information about the agent, always 1.", func(a *info.Response, labels []string) {
+		var nixosVersion, system string
+		if a.NixOS != nil {
+			nixosVersion, system = a.NixOS.Version, a.NixOS.CurrentSystem
+		}
+		p.sample("nits_agent_info", append(labels, "version", a.Version, "nixos_version", nixosVersion, "system", system), 1)
+	})
+
+	forEach("nits_agent_online", "gauge", "Whether the agent is online.", func(a *info.Response, labels []string) {
+		p.sample("nits_agent_online", labels, boolValue(a.Online))
+	})
+
+	forEach("nits_agent_last_seen_timestamp_seconds", "gauge", "When the agent last updated its registration.", func(a *info.Response, labels []string) {
+		p.sample("nits_agent_last_seen_timestamp_seconds", labels, unixSeconds(a.LastSeen))
+	})
+
+	forEach("nits_agent_boot_timestamp_seconds", "gauge", "When the agent's host last booted.", func(a *info.Response, labels []string) {
+		if !a.BootTime.IsZero() {
+			p.sample("nits_agent_boot_timestamp_seconds", labels, unixSeconds(a.BootTime))
+		}
+	})
+
+	forEach("nits_agent_deployment_info", "gauge", "The most recent deployment to the agent, always 1.", func(a *info.Response, labels []string) {
+		if d := a.Deployment; d != nil {
+			p.sample("nits_agent_deployment_info", append(labels, "id", d.Id, "action", d.Action, "outcome", string(d.Outcome), "closure", d.Closure), 1)
+		}
+	})
+
+	forEach("nits_agent_deployment_success", "gauge", "Whether the most recent deployment to the agent succeeded.", func(a *info.Response, labels []string) {
+		if d := a.Deployment; d != nil && d.Outcome != info.DeploymentInProgress {
+			p.sample("nits_agent_deployment_success", labels, boolValue(d.Outcome == info.DeploymentSuccess))
+		}
+	})
+
+	forEach("nits_agent_health_check_passing", "gauge", "Whether each health check configured on the agent is passing.", func(a *info.Response, labels []string) {
+		for _, check := range a.Health {
+			p.sample("nits_agent_health_check_passing", append(labels, "check", check.Name), boolValue(check.Passing))
+		}
+	})
+
+	forEach("nits_agent_deployments_total", "counter", "Deployments observed since the exporter started, by outcome.", func(a *info.Response, labels []string) {
+		counts := s.deployments[a.NKey]
+		for _, outcome := range []info.DeploymentOutcome{info.DeploymentSuccess, info.DeploymentFailure} {
+			p.sample("nits_agent_deployments_total", append(labels, "outcome", string(outcome)), float64(counts[outcome]))
+		}
+	})
+
+	// metrics published periodically by the agents
+
+	withMetrics := func(name string, kind string, help string, fn func(m *metrics.Metrics, labels []string)) {
+		forEach(name, kind, help, func(a *info.Response, labels []string) {
+			if m, ok := s.metrics[a.NKey]; ok {
+				fn(m, labels)
+			}
+		})
+	}
+
+	withMetrics("nits_agent_metrics_timestamp_seconds", "gauge", "When the agent last published metrics.", func(m *metrics.Metrics, labels []string) {
+		p.sample("nits_agent_metrics_timestamp_seconds", labels, unixSeconds(m.Timestamp))
+	})
+
+	for _, period := range []string{"1", "5", "15"} {
+		name := "nits_agent_load" + period
+		withMetrics(name, "gauge", fmt.Sprintf("%s minute load average.", period), func(m *metrics.Metrics, labels []string) {
+			if m.Load == nil {
+				return
+			}
+			value := map[string]float64{"1": m.Load.Load1, "5": m.Load.Load5, "15": m.Load.Load15}[period]
+			p.sample(name, labels, value)
+		})
+	}
+
+	memory := []struct {
+		name  string
+		help  string
+		value func(m *metrics.Memory) uint64
+	}{
+		{"nits_agent_memory_total_bytes", "Total memory.", func(m *metrics.Memory) uint64 { return m.Total }},
+		{"nits_agent_memory_used_bytes", "Used memory.", func(m *metrics.Memory) uint64 { return m.Used }},
+		{"nits_agent_memory_available_bytes", "Available memory.", func(m *metrics.Memory) uint64 { return m.Available }},
+		{"nits_agent_swap_total_bytes", "Total swap.", func(m *metrics.Memory) uint64 { return m.SwapTotal }},
+		{"nits_agent_swap_used_bytes", "Used swap.", func(m *metrics.Memory) uint64 { return m.SwapUsed }},
+	}
+
+	for _, mem := range memory {
+		mem := mem
+		withMetrics(mem.name, "gauge", mem.help, func(m *metrics.Metrics, labels []string) {
+			if m.Memory != nil {
+				p.sample(mem.name, labels, float64(mem.value(m.Memory)))
+			}
+		})
+	}
+
+	withMetrics("nits_agent_disk_total_bytes", "gauge", "Size of each mounted filesystem.", func(m *metrics.Metrics, labels []string) {
+		for _, d := range m.Disks {
+			p.sample("nits_agent_disk_total_bytes", append(labels, "mountpoint", d.Mountpoint), float64(d.Total))
+		}
+	})
+
+	withMetrics("nits_agent_disk_used_bytes", "gauge", "Used space of each mounted filesystem.", func(m *metrics.Metrics, labels []string) {
+		for _, d := range m.Disks {
+			p.sample("nits_agent_disk_used_bytes", append(labels, "mountpoint", d.Mountpoint), float64(d.Used))
+		}
+	})
+
+	withMetrics("nits_agent_network_receive_bytes_total", "counter", "Bytes received by each interface.", func(m *metrics.Metrics, labels []string) {
+		for _, n := range m.Network {
+			p.sample("nits_agent_network_receive_bytes_total", append(labels, "interface", n.Name), float64(n.BytesRecv))
+		}
+	})
+
+	withMetrics("nits_agent_network_transmit_bytes_total", "counter", "Bytes transmitted by each interface.", func(m *metrics.Metrics, labels []string) {
+		for _, n := range m.Network {
+			p.sample("nits_agent_network_transmit_bytes_total", append(labels, "interface", n.Name), float64(n.BytesSent))
+		}
+	})
+
+	withMetrics("nits_agent_nix_store_size_bytes", "gauge", "Combined nar size of the paths in the nix store.", func(m *metrics.Metrics, labels []string) {
+		if m.NixStore != nil {
+			p.sample("nits_agent_nix_store_size_bytes", labels, float64(m.NixStore.Size))
+		}
+	})
+
+	withMetrics("nits_agent_nix_store_paths", "gauge", "Number of paths in the nix store.", func(m *metrics.Metrics, labels []string) {
+		if m.NixStore != nil {
+			p.sample("nits_agent_nix_store_paths", labels, float64(m.NixStore.Paths))
+		}
+	})
+
+	return p.err
+}
+
+// promWriter writes metrics in the Prometheus text exposition format, retaining the first error encountered.
+type promWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *promWriter) family(name string, kind string, help string) {
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes a single sample, with labels given as alternating names and values.
+func (p *promWriter) sample(name string, labels []string, value float64) {
+	var b strings.Builder
+	b.WriteString(name)
+
+	if len(labels) > 0 {
+		b.WriteString("{")
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(labels[i])
+			b.WriteString(`="`)
+			b.WriteString(promLabelEscaper.Replace(labels[i+1]))
+			b.WriteString(`"`)
+		}
+		b.WriteString("}")
+	}
+
+	p.printf("%s %s\n", b.String(), formatPromValue(value))
+}
+
+func (p *promWriter) printf(format string, args ...any) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatPromValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return fmt.Sprintf("%g", value)
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
@@ -0,0 +1,230 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/internal/cmd"
+	"github.com/numtide/nits/pkg/agent"
+	"github.com/numtide/nits/pkg/agent/info"
+	nlog "github.com/numtide/nits/pkg/logging"
+	"github.com/numtide/nits/pkg/logging/sink"
+	nnats "github.com/numtide/nits/pkg/nats"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+type logForwarder struct {
+	Nats nnats.CliOptions `embed:"" prefix:"nats-"`
+
+	Durable   string        `default:"nits-log-forwarder" help:"Name of the durable consumer, which tracks the position of the forwarder within the stream."`
+	BatchSize int           `default:"100" help:"Maximum number of records to forward at a time."`
+	Refresh   time.Duration `default:"1m" help:"How often to refresh the list of agents used to resolve agent names."`
+
+	File struct {
+		Path       string       `help:"Forward records to a file, encoded as json lines."`
+		MaxSize    cmd.ByteSize `default:"100MiB" help:"Size at which the file is rotated."`
+		MaxBackups int          `default:"5" help:"Number of rotated files to retain."`
+	} `embed:"" prefix:"file-"`
+
+	Syslog struct {
+		Address  string `help:"Forward records to a syslog server at this address e.g. localhost:514."`
+		Network  string `enum:"udp,tcp" default:"udp" help:"Network with which to connect to the syslog server."`
+		Facility int    `default:"16" help:"Syslog facility to use, defaults to local0."`
+	} `embed:"" prefix:"syslog-"`
+
+	Loki struct {
+		Url    string `help:"Forward records to a Loki compatible push endpoint e.g. http://localhost:3100."`
+		Tenant string `help:"Tenant id to send with each push request."`
+	} `embed:"" prefix:"loki-"`
+}
+
+func (f *logForwarder) Run() error {
+	if err := Cmd.Log.ConfigureLog(); err != nil {
+		return err
+	}
+
+	return cmd.Run(func(ctx context.Context) (err error) {
+		var sinks sink.Multi
+		if sinks, err = f.sinks(); err != nil {
+			return
+		} else if len(sinks) == 0 {
+			return errors.New("at least one sink must be configured")
+		}
+
+		defer func() {
+			if err := sinks.Close(); err != nil {
+				log.Error("failed to close sinks", "error", err)
+			}
+		}()
+
+		var (
+			conn *nats.Conn
+			js   nats.JetStreamContext
+			sub  *nats.Subscription
+		)
+
+		if conn, err = f.Nats.Connect(); err != nil {
+			return
+		} else if js, err = conn.JetStream(); err != nil {
+			return
+		} else if sub, err = js.PullSubscribe(
+			subject.AgentLogsAll(), f.Durable,
+			nats.BindStream(streamAgentLogs),
+			nats.AckExplicit(),
+			nats.DeliverAll(),
+		); err != nil {
+			return errors.Annotate(err, "failed to create durable consumer")
+		}
+
+		log.Info("forwarding logs", "durable", f.Durable, "sinks", len(sinks))
+
+		var (
+			msgs        []*nats.Msg
+			lastRefresh time.Time
+			// records are decoded with a context containing the agent index
+			recordCtx context.Context
+		)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			default:
+			}
+
+			// periodically refresh the agent index used to resolve agent names
+			if time.Since(lastRefresh) > f.Refresh {
+				var indexCtx context.Context
+				if indexCtx, err = f.indexAgents(ctx, conn); err != nil {
+					// keep forwarding with the previous index, names are resolved again on the next refresh
+					log.Warn("failed to refresh agent index, will retry", "error", err)
+					if recordCtx == nil {
+						recordCtx = nlog.SetAgentsByNKey(ctx, nil)
+					}
+				} else {
+					recordCtx = indexCtx
+				}
+				lastRefresh = time.Now()
+			}
+
+			fetchCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			msgs, err = sub.Fetch(f.BatchSize, nats.Context(fetchCtx))
+			cancel()
+
+			if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, nats.ErrTimeout) {
+				continue
+			} else if errors.Is(err, context.Canceled) {
+				return nil
+			} else if err != nil {
+				return
+			}
+
+			if err = f.forward(recordCtx, sinks, msgs); err != nil {
+				// the records will be redelivered once the ack wait has elapsed
+				log.Error("failed to acknowledge forwarded records", "error", err)
+				err = nil
+			}
+		}
+	})
+}
+
+// forward delivers a batch of messages to every sink, acknowledging them once all have accepted it. Should any sink
+// fail, the batch is retried for the sinks which failed alone until it succeeds, so that the others do not receive it
+// again. If ctx is cancelled whilst retrying the messages are left unacknowledged, to be redelivered to every sink when
+// the forwarder next runs, making delivery at-least-once.
+func (f *logForwarder) forward(ctx context.Context, sinks sink.Multi, msgs []*nats.Msg) (err error) {
+	var entries []nlog.Entry
+
+	for _, msg := range msgs {
+		var (
+			isEOS  bool
+			record nlog.Record
+			entry  nlog.Entry
+		)
+
+		if isEOS, err = nnats.IsEndOfStream(msg); err == nil && isEOS {
+			continue
+		} else if record, err = nlog.UnmarshalRecord(ctx, msg); err != nil {
+			log.Warn("skipping malformed record", "subject", msg.Subject, "error", err)
+			continue
+		} else if entry, err = record.Entry(); err != nil {
+			log.Warn("skipping malformed record", "subject", msg.Subject, "error", err)
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	pending := sinks
+	for len(entries) > 0 {
+		if pending, err = pending.SendEach(ctx, entries); err == nil {
+			break
+		}
+
+		log.Error("failed to forward records, will retry", "sinks", len(pending), "error", err)
+
+		// prevent the batch from being redelivered whilst we are still retrying it
+		for _, msg := range msgs {
+			_ = msg.InProgress()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(5 * time.Second):
+		}
+	}
+
+	for _, msg := range msgs {
+		if err = msg.Ack(); err != nil {
+			return
+		}
+	}
+
+	log.Debug("forwarded records", "count", len(entries))
+	return nil
+}
+
+func (f *logForwarder) sinks() (sinks sink.Multi, err error) {
+	if f.File.Path != "" {
+		var file *sink.File
+		if file, err = sink.NewFile(f.File.Path, int64(f.File.MaxSize), f.File.MaxBackups); err != nil {
+			return
+		}
+		sinks = append(sinks, file)
+	}
+
+	if f.Syslog.Address != "" {
+		var syslog *sink.Syslog
+		if syslog, err = sink.NewSyslog(f.Syslog.Network, f.Syslog.Address, f.Syslog.Facility); err != nil {
+			return
+		}
+		sinks = append(sinks, syslog)
+	}
+
+	if f.Loki.Url != "" {
+		sinks = append(sinks, sink.NewLoki(f.Loki.Url, f.Loki.Tenant))
+	}
+
+	return
+}
+
+func (f *logForwarder) indexAgents(ctx context.Context, conn *nats.Conn) (context.Context, error) {
+	listCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	agents, err := agent.List(listCtx, conn)
+	if err != nil {
+		return ctx, err
+	}
+
+	var byNKey map[string]*info.Response
+	if byNKey, err = agent.IndexByNKey(agents); err != nil {
+		return ctx, err
+	}
+
+	return nlog.SetAgentsByNKey(ctx, byNKey), nil
+}
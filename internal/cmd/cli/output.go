@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/charmbracelet/log"
+	nlog "github.com/numtide/nits/pkg/logging"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputTable = "table"
+	outputJson  = "json"
+	outputYaml  = "yaml"
+)
+
+// structuredOutput returns true if a machine-readable output format has been requested.
+func structuredOutput() bool {
+	return Cmd.Output != outputTable
+}
+
+// render writes v to stdout in the requested output format, falling back to table for human-readable output.
+func render(v any, table func()) error {
+	if !structuredOutput() {
+		if table != nil {
+			table()
+		}
+		return nil
+	}
+	return newEncoder(os.Stdout).Encode(v)
+}
+
+// encoder writes a sequence of values in the requested output format: one json document per line, or a stream of
+// yaml documents.
+type encoder struct {
+	lock sync.Mutex
+	json *json.Encoder
+	yaml *yaml.Encoder
+}
+
+func newEncoder(w io.Writer) *encoder {
+	e := &encoder{}
+	if Cmd.Output == outputYaml {
+		e.yaml = yaml.NewEncoder(w)
+		e.yaml.SetIndent(2)
+	} else {
+		e.json = json.NewEncoder(w)
+		e.json.SetIndent("", "  ")
+	}
+	return e
+}
+
+func (e *encoder) Encode(v any) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.json != nil {
+		return e.json.Encode(v)
+	}
+
+	// most of our types, and those we embed from gopsutil, only carry json tags, so we go via json to ensure the yaml
+	// output uses the same field names and ordering
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var node yaml.Node
+	if err = yaml.Unmarshal(b, &node); err != nil {
+		return err
+	}
+	blockStyle(&node)
+
+	return e.yaml.Encode(&node)
+}
+
+// blockStyle clears the flow and quoting styles which result from parsing json, so the yaml is rendered in the usual
+// block style with quoting only where required.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// recordWriter writes log records to stderr when using table output, otherwise it writes their entries to stdout in
+// the requested output format.
+type recordWriter struct {
+	enc *encoder
+}
+
+func newRecordWriter() *recordWriter {
+	w := &recordWriter{}
+	if structuredOutput() {
+		w.enc = newEncoder(os.Stdout)
+		if w.enc.json != nil {
+			// one entry per line so the output can be processed as it is streamed
+			w.enc.json.SetIndent("", "")
+		}
+	}
+	return w
+}
+
+func (w *recordWriter) Write(record nlog.Record) error {
+	if w.enc == nil {
+		_, err := record.Write(os.Stderr)
+		return err
+	}
+
+	entry, err := record.Entry()
+	if err != nil {
+		log.Warn("skipping malformed record", "error", err)
+		return nil
+	}
+	return w.enc.Encode(entry)
+}
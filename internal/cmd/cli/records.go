@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+	nlog "github.com/numtide/nits/pkg/logging"
+)
+
+// subscribeRecords creates a record reader over one or more subjects. Subjects may be captured by different streams,
+// in which case the messages from each subscription are interleaved in the order they are received.
+func subscribeRecords(ctx context.Context, js nats.JetStreamContext, subjects []string, opts ...nats.SubOpt) (reader *nlog.RecordReader, err error) {
+	reader = &nlog.RecordReader{Context: ctx}
+
+	if len(subjects) == 1 {
+		reader.Sub, err = js.SubscribeSync(subjects[0], opts...)
+		return
+	}
+
+	msgs := make(chan *nats.Msg, 1024)
+	for _, subj := range subjects {
+		if _, err = js.ChanSubscribe(subj, msgs, opts...); err != nil {
+			return
+		}
+	}
+
+	reader.Msgs = msgs
+	return
+}
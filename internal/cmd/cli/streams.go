@@ -0,0 +1,226 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/internal/cmd"
+	nexec "github.com/numtide/nits/pkg/exec"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+const (
+	streamAgentLogs    = "agent-logs"
+	streamAgentOutput  = "agent-output"
+	streamAgentMetrics = "agent-metrics"
+	// streamAgentRegistry keeps the last registration of each agent for 28 days, so that agents which have been away
+	// for a while can still be listed. This is retention rather than presence, see agent.StaleAfter for the latter.
+	streamAgentRegistry = "KV_" + subject.AgentRegistryBucket
+	streamAgentGroups   = "KV_" + subject.AgentGroupsBucket
+	streamAgentConfig   = "KV_" + subject.AgentConfigBucket
+	streamAgentSecrets  = "KV_" + subject.AgentSecretsBucket
+
+	// streamAgentFilesPrefix prefixes the object store each agent uses for file transfers, which is created on demand
+	streamAgentFilesPrefix = "OBJ_" + subject.AgentFilesBucketPrefix
+	// streamAgentFilesLegacy is the object store which was shared by every agent before each had its own
+	streamAgentFilesLegacy = "OBJ_agent-files"
+)
+
+// clusterStreams are the streams which are created within each cluster account, in order of creation.
+var clusterStreams = []string{
+	streamAgentLogs, streamAgentOutput, streamAgentMetrics, streamAgentRegistry, streamAgentGroups, streamAgentConfig,
+	streamAgentSecrets,
+}
+
+// streamLimits allows the retention of agent logs to be configured. Logs and the stdout/stderr output of commands run
+// on the agent are captured by separate streams, so that noisy output does not cause system logs to be discarded.
+type streamLimits struct {
+	LogRetention     *cmd.Duration `help:"How long to retain agent logs for e.g. 30d."`
+	LogMaxBytes      *cmd.ByteSize `help:"Maximum size of the agent logs stream e.g. 10GiB."`
+	OutputRetention  *cmd.Duration `help:"How long to retain the stdout and stderr of commands run on agents e.g. 7d."`
+	OutputMaxBytes   *cmd.ByteSize `help:"Maximum size of the agent output stream e.g. 10GiB."`
+	MetricsRetention *cmd.Duration `help:"How long to retain agent metrics for e.g. 1d."`
+	MetricsMaxBytes  *cmd.ByteSize `help:"Maximum size of the agent metrics stream e.g. 1GiB."`
+	FilesRetention   *cmd.Duration `help:"How long to retain files being transferred to and from agents e.g. 1d."`
+	FilesMaxBytes    *cmd.ByteSize `help:"Maximum size of the files object store of each agent e.g. 10GiB."`
+}
+
+func (l *streamLimits) apply(config *nats.StreamConfig) {
+	var (
+		retention *cmd.Duration
+		maxBytes  *cmd.ByteSize
+	)
+
+	switch {
+	case config.Name == streamAgentLogs:
+		retention, maxBytes = l.LogRetention, l.LogMaxBytes
+	case config.Name == streamAgentOutput:
+		retention, maxBytes = l.OutputRetention, l.OutputMaxBytes
+	case config.Name == streamAgentMetrics:
+		retention, maxBytes = l.MetricsRetention, l.MetricsMaxBytes
+	case strings.HasPrefix(config.Name, streamAgentFilesPrefix):
+		retention, maxBytes = l.FilesRetention, l.FilesMaxBytes
+	}
+
+	if retention != nil {
+		config.MaxAge = time.Duration(*retention)
+	}
+	if maxBytes != nil {
+		config.MaxBytes = int64(*maxBytes)
+	}
+}
+
+// defaultStreamConfig returns the embedded configuration for the named stream.
+func defaultStreamConfig(name string) (config *nats.StreamConfig, err error) {
+	if strings.HasPrefix(name, streamAgentFilesPrefix) {
+		return filesStreamConfig(strings.TrimPrefix(name, streamAgentFilesPrefix))
+	}
+
+	var b []byte
+	if b, err = streamConfig.ReadFile(fmt.Sprintf("streams/%s.json", name)); err != nil {
+		return
+	}
+	config = &nats.StreamConfig{}
+	err = json.Unmarshal(b, config)
+	return
+}
+
+// filesStreamConfig returns the configuration for the files object store of the agent with the given nkey, based upon
+// an embedded template.
+func filesStreamConfig(nkey string) (config *nats.StreamConfig, err error) {
+	var b []byte
+	if b, err = streamConfig.ReadFile("streams/OBJ_agent-files-NKEY.json"); err != nil {
+		return
+	}
+	config = &nats.StreamConfig{}
+	if err = json.Unmarshal(b, config); err != nil {
+		return
+	}
+
+	bucket := subject.AgentFilesBucket(nkey)
+	config.Name = "OBJ_" + bucket
+	config.Subjects = []string{
+		fmt.Sprintf("$O.%s.C.>", bucket),
+		fmt.Sprintf("$O.%s.M.>", bucket),
+	}
+	return
+}
+
+// applyFilesStreams applies limits to the files object store of each agent, and removes the store which was shared by
+// every agent in earlier versions.
+func applyFilesStreams(natsContext string, limits *streamLimits) (err error) {
+	var names []string
+	if names, err = streamNames(natsContext); err != nil {
+		return
+	}
+
+	for _, name := range names {
+		if name == streamAgentFilesLegacy {
+			log.Info("removing shared files object store", "name", name)
+			if _, err = cmd.LogExec(nexec.Nats("--context", natsContext, "stream", "rm", name, "--force")).Output(); err != nil {
+				nexec.LogError("failed to remove stream", err)
+				return
+			}
+		} else if strings.HasPrefix(name, streamAgentFilesPrefix) {
+			if err = applyStream(natsContext, name, limits); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// currentStreamConfig retrieves the configuration of the named stream from the server, returning nil if it does not
+// exist.
+func currentStreamConfig(natsContext string, name string) (config *nats.StreamConfig, err error) {
+	var names []string
+	if names, err = streamNames(natsContext); err != nil {
+		return
+	} else if !slices.Contains(names, name) {
+		return
+	}
+
+	var b []byte
+	if b, err = cmd.LogExec(nexec.Nats("--context", natsContext, "stream", "info", name, "--json")).Output(); err != nil {
+		return
+	}
+
+	var info nats.StreamInfo
+	if err = json.Unmarshal(b, &info); err != nil {
+		return
+	}
+	return &info.Config, nil
+}
+
+func streamNames(natsContext string) (names []string, err error) {
+	var b []byte
+	if b, err = cmd.LogExec(nexec.Nats("--context", natsContext, "stream", "ls", "--names", "--json")).Output(); err != nil {
+		return
+	}
+	err = json.Unmarshal(b, &names)
+	return
+}
+
+// writeStreamConfig persists a stream config to a temporary file for use with the nats cli.
+func writeStreamConfig(config *nats.StreamConfig) (f *os.File, err error) {
+	if f, err = os.CreateTemp("", "nits-stream-"); err != nil {
+		return
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	err = json.NewEncoder(f).Encode(config)
+	return
+}
+
+// applyStream creates the named stream if it does not exist, or updates its subjects and limits if it does.
+func applyStream(natsContext string, name string, limits *streamLimits) (err error) {
+	var defaults, current *nats.StreamConfig
+	if defaults, err = defaultStreamConfig(name); err != nil {
+		return
+	} else if current, err = currentStreamConfig(natsContext, name); err != nil {
+		return
+	}
+
+	action := "add"
+	config := defaults
+
+	if current != nil {
+		// preserve any existing settings, but ensure the subjects match what the agents expect
+		action = "edit"
+		config = current
+		config.Subjects = defaults.Subjects
+	}
+
+	limits.apply(config)
+
+	var file *os.File
+	if file, err = writeStreamConfig(config); err != nil {
+		return
+	}
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+
+	log.Info("applying stream config", "name", name, "action", action, "maxAge", config.MaxAge, "maxBytes", config.MaxBytes)
+
+	args := []string{"--context", natsContext, "stream", action}
+	if action == "edit" {
+		args = append(args, name, "--force")
+	}
+	args = append(args, "--config", file.Name())
+
+	if _, err = cmd.LogExec(nexec.Nats(args...)).Output(); err != nil {
+		nexec.LogError(fmt.Sprintf("failed to %s stream", action), err)
+	}
+
+	return
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/numtide/nits/pkg/agent"
+	"github.com/numtide/nits/pkg/agent/info"
+)
+
+// agentTargets allows a command to operate on a set of agents, selected by group membership and/or labels, instead of
+// a single agent.
+type agentTargets struct {
+	Group    string `help:"Select agents which are members of this group."`
+	Selector string `short:"l" help:"Select agents whose labels match this selector e.g. env=prod,role!=db."`
+}
+
+func (t *agentTargets) isSet() bool {
+	return t.Group != "" || t.Selector != ""
+}
+
+// resolve returns the agents targeted by either name, which may also be an nkey or nkey prefix, or the group and
+// selector. It returns nil if no target was specified, leaving the caller to decide what that means.
+func (t *agentTargets) resolve(agents []*info.Response, name string) (targets []*info.Response, err error) {
+	if name != "" && t.isSet() {
+		return nil, errors.New("specify either an agent or a group and/or selector, not both")
+	}
+
+	if name != "" {
+		var target *info.Response
+		if target, err = agent.Resolve(agents, name); err != nil {
+			return
+		}
+		return []*info.Response{target}, nil
+	}
+
+	if !t.isSet() {
+		return nil, nil
+	}
+
+	if targets, err = t.filter(agents); err != nil {
+		return
+	} else if len(targets) == 0 {
+		return nil, errors.New("no agents matched the group and/or selector")
+	}
+	return
+}
+
+// filter returns the agents which match the group and selector.
+func (t *agentTargets) filter(agents []*info.Response) ([]*info.Response, error) {
+	selector, err := agent.ParseSelector(t.Selector)
+	if err != nil {
+		return nil, err
+	}
+	return agent.Select(agents, t.Group, selector), nil
+}
+
+// resolveNKey returns the nkey for the agent matching query. Unlike agent.ResolveNKey it accepts a full nkey for an
+// agent which has never registered, e.g. one which has been added but not yet deployed.
+func resolveNKey(ctx context.Context, conn *nats.Conn, query string) (nkey string, err error) {
+	listCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if nkey, err = agent.ResolveNKey(listCtx, conn, query); err == nil {
+		return
+	} else if nkeys.IsValidPublicUserKey(query) {
+		return query, nil
+	}
+	return
+}
+
+// resolveOnline returns the agent matching query, which may be a name, nkey or nkey prefix, failing if it is offline.
+func resolveOnline(ctx context.Context, conn *nats.Conn, query string) (target *info.Response, err error) {
+	listCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var agents []*info.Response
+	if agents, err = agent.List(listCtx, conn); err != nil {
+		return
+	} else if target, err = agent.Resolve(agents, query); err != nil {
+		return
+	} else if !target.Online {
+		return nil, errors.Errorf("agent %s is offline, it was last seen %v ago", target.Name, time.Since(target.LastSeen).Round(time.Second))
+	}
+	return
+}
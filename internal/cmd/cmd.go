@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"os/exec"
 	"syscall"
 	"time"
@@ -46,6 +47,16 @@ func Run(main func(ctx context.Context) error) (err error) {
 	return main(ctx)
 }
 
+// ExitCodeError is returned by a command which should exit with a specific code without reporting an error, e.g. to
+// propagate the exit code of a remote process.
+type ExitCodeError struct {
+	Code int
+}
+
+func (e *ExitCodeError) Error() string {
+	return fmt.Sprintf("exit code %d", e.Code)
+}
+
 func LogExec(cmd *exec.Cmd) *exec.Cmd {
 	log.Debug(cmd.String())
 	return cmd
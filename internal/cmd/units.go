@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+var daysRegex = regexp.MustCompile(`(\d+(?:\.\d+)?)d`)
+
+// ByteSize is a flag value which accepts human friendly sizes such as 64MiB or 10GB.
+type ByteSize int64
+
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	size, err := humanize.ParseBytes(string(text))
+	if err != nil {
+		return err
+	}
+	*b = ByteSize(size)
+	return nil
+}
+
+func (b ByteSize) String() string {
+	return humanize.IBytes(uint64(b))
+}
+
+// Duration is a flag value which extends time.Duration with support for days e.g. 30d or 1d12h.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) (err error) {
+	// convert days into hours, which time.ParseDuration understands
+	str := daysRegex.ReplaceAllStringFunc(string(text), func(days string) string {
+		var value float64
+		if value, err = strconv.ParseFloat(days[:len(days)-1], 64); err != nil {
+			return days
+		}
+		return strconv.FormatFloat(value*24, 'f', -1, 64) + "h"
+	})
+
+	if err != nil {
+		return
+	}
+
+	var duration time.Duration
+	if duration, err = time.ParseDuration(str); err != nil {
+		return
+	}
+
+	*d = Duration(duration)
+	return
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
@@ -12,6 +12,18 @@ in {
       defaultText = literalExpression "pkgs.nits";
       description = mdDoc "Package to use for nits.";
     };
+    configFile = mkOption {
+      type = types.nullOr types.path;
+      default = null;
+      example = "/etc/nits/agent.json";
+      description = mdDoc "JSON or TOML file (by `.toml` extension) from which the agent reads additional settings. Settings configured through this module take precedence.";
+    };
+    labels = mkOption {
+      type = types.attrsOf types.str;
+      default = {};
+      example = {role = "db";};
+      description = mdDoc "Labels describing the agent, by which it can be selected. Labels assigned with `nits agent label set` take precedence.";
+    };
     nats = {
       url = mkOption {
         type = types.str;
@@ -30,6 +42,161 @@ in {
         description = mdDoc "Path to an ed25519 host key file";
       };
     };
+    heartbeat = {
+      interval = mkOption {
+        type = types.str;
+        default = "5s";
+        description = mdDoc "How often the agent checks whether its registration has changed, publishing it if so.";
+      };
+      keepalive = mkOption {
+        type = types.str;
+        default = "30s";
+        description = mdDoc "Maximum time between registrations when nothing has changed.";
+      };
+      jitter = mkOption {
+        type = types.str;
+        default = "5s";
+        description = mdDoc "Random delay added to each keepalive.";
+      };
+    };
+    health = {
+      checks = mkOption {
+        type = types.attrsOf types.str;
+        default = {};
+        example = {nginx = "systemctl is-active nginx";};
+        description = mdDoc "Commands to run periodically by name, each with `/bin/sh` and the agent's path. A check passes when its command exits zero.";
+      };
+      interval = mkOption {
+        type = types.str;
+        default = "1m";
+        description = mdDoc "How often to run the health checks.";
+      };
+      timeout = mkOption {
+        type = types.str;
+        default = "30s";
+        description = mdDoc "How long a health check may run before it is considered to have failed.";
+      };
+    };
+    maintenanceWindows = mkOption {
+      type = types.listOf types.str;
+      default = [];
+      example = ["Sat,Sun 02:00-06:00" "Mon-Fri 22:00-02:00"];
+      description = mdDoc "Times at which deployments may activate a configuration, in the host's local time. Deployments are accepted at any time when empty.";
+    };
+    journal = {
+      enable = mkEnableOption (mdDoc "forwarding of systemd journal entries into NATS");
+      units = mkOption {
+        type = types.listOf types.str;
+        default = [];
+        example = ["nginx.service"];
+        description = mdDoc "Systemd units whose journal entries should be forwarded. All entries are forwarded when empty.";
+      };
+    };
+    metrics = {
+      interval = mkOption {
+        type = types.str;
+        default = "30s";
+        description = mdDoc "How often to publish metrics, set to `0` to disable.";
+      };
+      storeInterval = mkOption {
+        type = types.str;
+        default = "1h";
+        description = mdDoc "How often to measure the size of the nix store, set to `0` to disable.";
+      };
+    };
+    systemd = {
+      allowedUnits = mkOption {
+        type = types.listOf types.str;
+        default = [];
+        example = ["nginx.service" "*.timer"];
+        description = mdDoc "Glob patterns for the units which may be started, stopped or restarted remotely.";
+      };
+    };
+    exec = {
+      allowedCommands = mkOption {
+        type = types.listOf types.str;
+        default = [];
+        example = ["uptime" "df"];
+        description = mdDoc "Commands which may be run remotely, either by name or absolute path.";
+      };
+      admin = mkEnableOption (mdDoc "running any command through the admin endpoint, for users with permission to publish to it");
+      timeout = mkOption {
+        type = types.str;
+        default = "10m";
+        description = mdDoc "Maximum time a command may run for before it is terminated.";
+      };
+      packages = mkOption {
+        type = types.listOf types.package;
+        default = [];
+        example = literalExpression "[ pkgs.procps ]";
+        description = mdDoc "Packages added to the agent's path, providing commands which may be run remotely.";
+      };
+    };
+    shell = {
+      enable = mkEnableOption (mdDoc "interactive shell sessions opened remotely");
+      command = mkOption {
+        type = types.str;
+        default = "${pkgs.bashInteractive}/bin/bash";
+        defaultText = literalExpression ''"''${pkgs.bashInteractive}/bin/bash"'';
+        description = mdDoc "Shell to run for each session.";
+      };
+      idleTimeout = mkOption {
+        type = types.str;
+        default = "30m";
+        description = mdDoc "Close a session if no input has been received for this long.";
+      };
+      record = mkOption {
+        type = types.bool;
+        default = true;
+        description = mdDoc "Record the output of each session to the logs stream for auditing.";
+      };
+    };
+    forward = {
+      allow = mkOption {
+        type = types.listOf types.str;
+        default = [];
+        example = ["localhost:80" "192.168.1.*:*"];
+        description = mdDoc "Addresses which connections may be forwarded to, in the form host:port. Either may be a glob pattern.";
+      };
+      idleTimeout = mkOption {
+        type = types.str;
+        default = "5m";
+        description = mdDoc "Close a forwarded connection if neither data nor a keepalive has been received from the client for this long.";
+      };
+    };
+    files = {
+      readPaths = mkOption {
+        type = types.listOf types.str;
+        default = [];
+        example = ["/var/log" "/var/lib/systemd/coredump"];
+        description = mdDoc "Paths beneath which files may be copied from the agent.";
+      };
+      writePaths = mkOption {
+        type = types.listOf types.str;
+        default = [];
+        example = ["/var/lib/myapp"];
+        description = mdDoc "Paths beneath which files may be copied to the agent.";
+      };
+    };
+    secrets = {
+      dir = mkOption {
+        type = types.str;
+        default = "/run/nits/secrets";
+        description = mdDoc "Directory into which secrets sealed for this agent are written.";
+      };
+    };
+    spool = {
+      maxBytes = mkOption {
+        type = types.str;
+        default = "64MiB";
+        description = mdDoc "Maximum size of the spool in which logs are buffered whilst disconnected from NATS.";
+      };
+      maxAge = mkOption {
+        type = types.str;
+        default = "168h";
+        description = mdDoc "Maximum age of entries in the spool.";
+      };
+    };
     logLevel = mkOption {
       type = types.enum ["debug" "info" "warn" "error"];
       default = "info";
@@ -38,7 +205,13 @@ in {
     };
   };
 
-  config = {
+  config = let
+    # kong splits maps on ';', which may also appear within a value
+    toMap = attrs:
+      if attrs == {}
+      then null
+      else lib.concatStringsSep ";" (lib.mapAttrsToList (k: v: "${k}=${lib.replaceStrings [";"] ["\\;"] v}") attrs);
+  in {
     systemd.services.nits-agent = {
       after = ["network.target"];
       wantedBy = ["sysinit.target"];
@@ -52,13 +225,47 @@ in {
       path = [
         pkgs.nix
         pkgs.nixos-rebuild
-      ];
+        config.systemd.package
+      ] ++ cfg.exec.packages;
 
       environment = lib.filterAttrs (_: v: v != null) {
         NATS_URL = cfg.nats.url;
         NATS_HOST_KEY_FILE = cfg.nats.hostKeyFile;
         NATS_JWT_FILE = cfg.nats.jwtFile;
         LOG_LEVEL = cfg.logLevel;
+        HEARTBEAT_INTERVAL = cfg.heartbeat.interval;
+        HEARTBEAT_KEEPALIVE = cfg.heartbeat.keepalive;
+        HEARTBEAT_JITTER = cfg.heartbeat.jitter;
+        LABELS = toMap cfg.labels;
+        HEALTH_CHECKS = toMap cfg.health.checks;
+        HEALTH_INTERVAL = cfg.health.interval;
+        HEALTH_TIMEOUT = cfg.health.timeout;
+        JOURNAL_ENABLE = lib.boolToString cfg.journal.enable;
+        JOURNAL_UNITS = lib.concatStringsSep "," cfg.journal.units;
+        JOURNAL_CURSOR_FILE = "/var/lib/nits-agent/journal.cursor";
+        NIXOS_DEPLOYMENT_FILE = "/var/lib/nits-agent/deployment.json";
+        NIXOS_MAINTENANCE_WINDOWS =
+          if cfg.maintenanceWindows == []
+          then null
+          else lib.concatStringsSep ";" cfg.maintenanceWindows;
+        METRICS_INTERVAL = cfg.metrics.interval;
+        METRICS_STORE_INTERVAL = cfg.metrics.storeInterval;
+        SYSTEMD_ALLOWED_UNITS = lib.concatStringsSep "," cfg.systemd.allowedUnits;
+        EXEC_ALLOWED_COMMANDS = lib.concatStringsSep "," cfg.exec.allowedCommands;
+        EXEC_ADMIN = lib.boolToString cfg.exec.admin;
+        EXEC_TIMEOUT = cfg.exec.timeout;
+        SHELL_ENABLE = lib.boolToString cfg.shell.enable;
+        SHELL_COMMAND = cfg.shell.command;
+        SHELL_IDLE_TIMEOUT = cfg.shell.idleTimeout;
+        SHELL_RECORD = lib.boolToString cfg.shell.record;
+        FORWARD_ALLOW = lib.concatStringsSep "," cfg.forward.allow;
+        FORWARD_IDLE_TIMEOUT = cfg.forward.idleTimeout;
+        FILES_READ_PATHS = lib.concatStringsSep "," cfg.files.readPaths;
+        FILES_WRITE_PATHS = lib.concatStringsSep "," cfg.files.writePaths;
+        SECRETS_DIR = cfg.secrets.dir;
+        SPOOL_DIR = "/var/lib/nits-agent/spool";
+        SPOOL_MAX_BYTES = cfg.spool.maxBytes;
+        SPOOL_MAX_AGE = cfg.spool.maxAge;
       };
 
       serviceConfig = with lib; {
@@ -67,7 +274,7 @@ in {
 
         User = "root";
         StateDirectory = "nits-agent";
-        ExecStart = "${cfg.package}/bin/nits-agent";
+        ExecStart = "${cfg.package}/bin/nits-agent" + lib.optionalString (cfg.configFile != null) " --config ${cfg.configFile}";
       };
     };
   };
@@ -6,8 +6,19 @@ import (
 	"os"
 
 	"github.com/nats-io/jwt/v2"
+	"github.com/numtide/nits/pkg/agent/command"
+	"github.com/numtide/nits/pkg/agent/config"
+	"github.com/numtide/nits/pkg/agent/files"
+	"github.com/numtide/nits/pkg/agent/forward"
+	"github.com/numtide/nits/pkg/agent/health"
 	"github.com/numtide/nits/pkg/agent/info"
+	"github.com/numtide/nits/pkg/agent/journal"
+	"github.com/numtide/nits/pkg/agent/loglevel"
+	"github.com/numtide/nits/pkg/agent/metrics"
 	"github.com/numtide/nits/pkg/agent/nixos"
+	"github.com/numtide/nits/pkg/agent/secrets"
+	"github.com/numtide/nits/pkg/agent/shell"
+	"github.com/numtide/nits/pkg/agent/systemd"
 
 	"github.com/numtide/nits/pkg/agent/util"
 
@@ -21,10 +32,24 @@ import (
 )
 
 var (
-	NatsOptions *nnats.CliOptions
-	Conn        *nats.Conn
-	NKey        string
-	Claims      *jwt.UserClaims
+	LogLevel         string
+	Labels           map[string]string
+	NatsOptions      *nnats.CliOptions
+	HeartbeatOptions *info.HeartbeatOptions
+	HealthOptions    *health.Options
+	NixosOptions     *nixos.Options
+	JournalOptions   *journal.Options
+	MetricsOptions   *metrics.Options
+	SystemdOptions   *systemd.Options
+	ExecOptions      *command.Options
+	ShellOptions     *shell.Options
+	ForwardOptions   *forward.Options
+	FilesOptions     *files.Options
+	SecretsOptions   *secrets.Options
+	Spool            *nnats.Spool
+	Conn             *nats.Conn
+	NKey             string
+	Claims           *jwt.UserClaims
 )
 
 func Run(ctx context.Context) (err error) {
@@ -40,6 +65,7 @@ func Run(ctx context.Context) (err error) {
 		Headers: nats.Header{
 			nlog.HeaderFormat: []string{nlog.HeaderLogFmt},
 		},
+		Spool: Spool,
 	}
 	defer func() {
 		_ = writer.Close()
@@ -51,18 +77,71 @@ func Run(ctx context.Context) (err error) {
 	ctx = util.SetConn(ctx, Conn)
 	ctx = util.SetNKey(ctx, NKey)
 	ctx = util.SetClaims(ctx, Claims)
+	ctx = util.SetSpool(ctx, Spool)
 
 	log.Info("initialising services")
-	if err = info.Init(ctx); err != nil {
+	if err = info.Init(ctx, HeartbeatOptions, Labels); err != nil {
 		log.Error("failed to initialise info service", "error", err)
 		return
-	} else if err = nixos.Init(ctx); err != nil {
+	} else if err = nixos.Init(ctx, NixosOptions); err != nil {
 		log.Error("failed to initialise nixos service", "error", err)
 		return
+	} else if err = systemd.Init(ctx, SystemdOptions); err != nil {
+		log.Error("failed to initialise systemd service", "error", err)
+		return
+	} else if err = command.Init(ctx, ExecOptions); err != nil {
+		log.Error("failed to initialise exec service", "error", err)
+		return
+	} else if err = forward.Init(ctx, ForwardOptions); err != nil {
+		log.Error("failed to initialise forward service", "error", err)
+		return
+	} else if err = files.Init(ctx, FilesOptions); err != nil {
+		log.Error("failed to initialise files service", "error", err)
+		return
+	} else if err = loglevel.Init(ctx, LogLevel); err != nil {
+		log.Error("failed to initialise log level service", "error", err)
+		return
+	} else if err = secrets.Init(ctx, SecretsOptions, NatsOptions.HostKeyFile); err != nil {
+		log.Error("failed to initialise secrets delivery", "error", err)
+		return
+	} else if err = health.Init(ctx, HealthOptions); err != nil {
+		log.Error("failed to initialise health checks", "error", err)
+		return
+	}
+
+	if JournalOptions != nil && JournalOptions.Enable {
+		if err = journal.Init(ctx, JournalOptions); err != nil {
+			log.Error("failed to initialise journal forwarding", "error", err)
+			return
+		}
+	}
+	if ShellOptions != nil && ShellOptions.Enable {
+		if err = shell.Init(ctx, ShellOptions); err != nil {
+			log.Error("failed to initialise shell service", "error", err)
+			return
+		}
+	}
+	if MetricsOptions != nil && MetricsOptions.Interval > 0 {
+		if err = metrics.Init(ctx, MetricsOptions); err != nil {
+			log.Error("failed to initialise metrics publishing", "error", err)
+			return
+		}
+	}
+
+	// settings are applied to services, so we only begin watching for changes once they are running
+	if err = config.Init(ctx, localSettings(), applySettings); err != nil {
+		log.Error("failed to initialise remote config", "error", err)
+		return
 	}
 	log.Info("services initialised")
 
 	<-ctx.Done()
+
+	// let others know we are going away rather than waiting for our registration to go stale
+	if err = info.Offline(); err != nil {
+		log.Warn("failed to mark agent as offline", "error", err)
+	}
+
 	return nil
 }
 
@@ -72,12 +151,39 @@ func connectNats() (err error) {
 	if opts, NKey, Claims, err = NatsOptions.ToNatsOptions(); err != nil {
 		return
 	}
-	opts = append(opts, nats.CustomInboxPrefix(subject.AgentInbox(NKey)))
+	opts = append(opts,
+		nats.CustomInboxPrefix(subject.AgentInbox(NKey)),
+		// devices may be offline for long periods, so we keep trying to connect indefinitely
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ConnectHandler(onConnect),
+		nats.ReconnectHandler(onConnect),
+	)
 
 	if Conn, err = nats.Connect(NatsOptions.Url, opts...); err != nil {
 		return
 	}
-	log.Info("connected to nats", "nkey", NKey)
+
+	if !Conn.IsConnected() {
+		log.Warn("unable to connect to nats, will keep retrying", "url", NatsOptions.Url)
+	}
 
 	return
 }
+
+func onConnect(conn *nats.Conn) {
+	log.Info("connected to nats", "nkey", NKey, "url", conn.ConnectedUrl())
+
+	if Spool == nil {
+		return
+	}
+
+	// replay anything which was spooled whilst we were disconnected
+	go func() {
+		if count, err := Spool.Replay(conn); err != nil {
+			log.Error("failed to replay spool", "error", err)
+		} else if count > 0 {
+			log.Info("replayed spooled messages", "count", count)
+		}
+	}()
+}
@@ -0,0 +1,307 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/nats-io/nuid"
+	"github.com/numtide/nits/pkg/agent/util"
+	nlog "github.com/numtide/nits/pkg/logging"
+	nnats "github.com/numtide/nits/pkg/nats"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+// killDelay is how long a command has to exit after being sent SIGTERM before it is killed.
+const killDelay = 10 * time.Second
+
+type Options struct {
+	AllowedCommands []string      `env:"EXEC_ALLOWED_COMMANDS" help:"Commands which may be run remotely, either by name or absolute path. No commands may be run when empty."`
+	Admin           bool          `env:"EXEC_ADMIN" help:"Allow any command to be run by users with permission to publish to the admin endpoint."`
+	Timeout         time.Duration `env:"EXEC_TIMEOUT" default:"10m" help:"Maximum time a command may run for before it is terminated."`
+}
+
+// Validate ensures allowed commands are not empty and the timeout is positive.
+func (o *Options) Validate() error {
+	for _, command := range o.AllowedCommands {
+		if command == "" {
+			return errors.NotValidf("empty allowed command")
+		}
+	}
+	if o.Timeout <= 0 {
+		return errors.NotValidf("timeout %v", o.Timeout)
+	}
+	return nil
+}
+
+var (
+	NKey string
+	Conn *nats.Conn
+
+	AllowedCommands []string
+	Timeout         time.Duration
+
+	logger *log.Logger
+
+	// cancel functions for the commands currently running, keyed by id
+	running     = make(map[string]context.CancelFunc)
+	runningLock sync.Mutex
+)
+
+func Init(ctx context.Context, opts *Options) (err error) {
+	Conn = util.GetConn(ctx)
+	NKey = util.GetNKey(ctx)
+	AllowedCommands = opts.AllowedCommands
+	Timeout = opts.Timeout
+
+	logger = util.Logger("exec")
+
+	if Timeout <= 0 {
+		return errors.New("exec timeout must be greater than zero")
+	}
+
+	var srv micro.Service
+	if srv, err = micro.AddService(Conn, micro.Config{
+		Name:        "AgentExec",
+		Version:     "0.0.1",
+		Description: "Run commands on the agent's host.",
+	}); err != nil {
+		return
+	}
+
+	group := srv.AddGroup(subject.AgentService(NKey, "EXEC"))
+
+	if err = group.AddEndpoint("RUN", micro.HandlerFunc(onRun)); err != nil {
+		return
+	} else if err = group.AddEndpoint("CANCEL", micro.HandlerFunc(onCancel)); err != nil {
+		return
+	}
+
+	if opts.Admin {
+		// access to this endpoint is controlled through subject permissions rather than the allow-list
+		if err = group.AddEndpoint("ADMIN", micro.HandlerFunc(onAdmin)); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func onRun(req micro.Request) {
+	handle(req, false)
+}
+
+func onAdmin(req micro.Request) {
+	handle(req, true)
+}
+
+func handle(req micro.Request, admin bool) {
+	var (
+		err     error
+		request Request
+	)
+
+	if err = json.Unmarshal(req.Data(), &request); err != nil {
+		_ = req.Error("400", fmt.Sprintf("Failed to unmarshal request: %s", err), nil)
+		return
+	} else if len(request.Command) == 0 {
+		_ = req.Error("400", "A command is required.", nil)
+		return
+	}
+
+	if !admin && isRelativePath(request.Command[0]) {
+		// the allow-list is checked relative to the agent's working directory, but the command runs relative to Dir
+		logger.Warn("refused to run command with a relative path", "command", request.Command)
+		_ = req.Error("400", fmt.Sprintf("Command %s must be an absolute path or a name on the PATH", request.Command[0]), nil)
+		return
+	} else if !admin && !allowed(request.Command[0]) {
+		logger.Warn("refused to run command which is not allowed", "command", request.Command)
+		_ = req.Error("403", fmt.Sprintf("Command %s is not in the allow-list", request.Command[0]), nil)
+		return
+	}
+
+	timeout := Timeout
+	if request.Timeout > 0 && request.Timeout < timeout {
+		timeout = request.Timeout
+	}
+
+	id := nuid.Next()
+	output := fmt.Sprintf("%s.EXEC.%s", subject.AgentOutput(NKey), id)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+	cmd := exec.CommandContext(ctx, request.Command[0], request.Command[1:]...)
+	cmd.Dir = request.Dir
+	// give the command a chance to exit cleanly
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = killDelay
+
+	stdout := newWriter(output + ".STDOUT")
+	stderr := newWriter(output + ".STDERR")
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	// register before responding so a cancel request cannot arrive for an unknown id
+	runningLock.Lock()
+	running[id] = cancel
+	runningLock.Unlock()
+
+	if err = req.RespondJSON(Response{Id: id, Output: output}); err != nil {
+		logger.Error("failed to respond", "error", err)
+		cancel()
+		removeRunning(id)
+		return
+	}
+
+	logger.Info("running command", "id", id, "command", request.Command, "admin", admin, "timeout", timeout)
+
+	go func() {
+		defer cancel()
+		defer removeRunning(id)
+
+		result := Result{Id: id, Started: time.Now().UTC()}
+
+		err := cmd.Run()
+
+		result.Ended = time.Now().UTC()
+		result.ExitCode = cmd.ProcessState.ExitCode()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			result.TimedOut = true
+		} else if errors.Is(ctx.Err(), context.Canceled) {
+			result.Canceled = true
+		}
+
+		var exitErr *exec.ExitError
+		if err != nil && !errors.As(err, &exitErr) {
+			// the command could not be started or its output could not be copied
+			result.Error = err.Error()
+		}
+
+		if err := stderr.Close(); err != nil {
+			logger.Error("failed to close stderr", "id", id, "error", err)
+		}
+		if err := stdout.Close(); err != nil {
+			logger.Error("failed to close stdout", "id", id, "error", err)
+		}
+
+		logger.Info("command finished", "id", id, "exit_code", result.ExitCode, "error", result.Error,
+			"timed_out", result.TimedOut, "canceled", result.Canceled)
+
+		// published last so that a client has received all output once it sees the result
+		data, err := json.Marshal(result)
+		if err != nil {
+			logger.Error("failed to marshal result", "id", id, "error", err)
+			return
+		}
+		if err = Conn.Publish(output+".RESULT", data); err != nil {
+			logger.Error("failed to publish result", "id", id, "error", err)
+		}
+	}()
+}
+
+func onCancel(req micro.Request) {
+	var request CancelRequest
+	if err := json.Unmarshal(req.Data(), &request); err != nil {
+		_ = req.Error("400", fmt.Sprintf("Failed to unmarshal request: %s", err), nil)
+		return
+	}
+
+	runningLock.Lock()
+	cancel, ok := running[request.Id]
+	runningLock.Unlock()
+
+	if !ok {
+		_ = req.Error("404", fmt.Sprintf("No command is running with id %s", request.Id), nil)
+		return
+	}
+
+	logger.Info("canceling command", "id", request.Id)
+	cancel()
+
+	if err := req.Respond([]byte("{}")); err != nil {
+		logger.Error("failed to respond", "error", err)
+	}
+}
+
+func removeRunning(id string) {
+	runningLock.Lock()
+	defer runningLock.Unlock()
+	delete(running, id)
+}
+
+func newWriter(subject string) *nnats.Writer {
+	return &nnats.Writer{
+		Conn:    Conn,
+		Subject: subject,
+		Headers: nats.Header{
+			nlog.HeaderFormat: []string{nlog.HeaderTerm},
+		},
+	}
+}
+
+// allowed returns true if the command matches an entry in the allow-list, either by name or by the executable both
+// resolve to.
+func allowed(command string) bool {
+	resolved := resolve(command)
+
+	for _, entry := range AllowedCommands {
+		if entry == command {
+			return true
+		} else if resolved != "" && resolve(entry) == resolved {
+			return true
+		}
+	}
+	return false
+}
+
+// isRelativePath returns true if command is a path relative to the working directory, rather than an absolute path or a
+// name to be looked up on the PATH.
+func isRelativePath(command string) bool {
+	return !filepath.IsAbs(command) && strings.ContainsRune(command, filepath.Separator)
+}
+
+// resolve returns the absolute path of the executable for command, or empty if it cannot be found.
+//
+// Symlinks are only followed for the directory, e.g. /bin to /usr/bin. Following the executable itself would treat
+// every command provided by a multi-call binary such as busybox as the same command.
+func resolve(command string) string {
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return ""
+	} else if path, err = filepath.Abs(path); err != nil {
+		return ""
+	}
+
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, filepath.Base(path))
+}
+
+func RunWithContext(ctx context.Context, conn *nats.EncodedConn, nkey string, admin bool, req Request) (resp Response, err error) {
+	endpoint := "EXEC.RUN"
+	if admin {
+		endpoint = "EXEC.ADMIN"
+	}
+	err = nnats.RequestWithContext(ctx, conn, subject.AgentService(nkey, endpoint), req, &resp)
+	return
+}
+
+func CancelWithContext(ctx context.Context, conn *nats.EncodedConn, nkey string, id string) error {
+	var resp struct{}
+	return nnats.RequestWithContext(ctx, conn, subject.AgentService(nkey, "EXEC.CANCEL"), CancelRequest{Id: id}, &resp)
+}
@@ -0,0 +1,34 @@
+package command
+
+import "time"
+
+type Request struct {
+	// Command is the executable followed by its arguments. Unless run as admin, the executable must be an absolute path
+	// or a name to be looked up on the PATH.
+	Command []string `json:"command"`
+	// Dir is the working directory for the command, defaulting to that of the agent.
+	Dir string `json:"dir,omitempty"`
+	// Timeout after which the command is terminated. The agent's configured timeout is used if zero or greater than
+	// the agent's timeout.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+type Response struct {
+	Id string `json:"id"`
+	// Output is the subject prefix under which stdout, stderr and the result are published.
+	Output string `json:"output"`
+}
+
+type Result struct {
+	Id       string    `json:"id"`
+	ExitCode int       `json:"exit-code"`
+	Error    string    `json:"error,omitempty"`
+	TimedOut bool      `json:"timed-out,omitempty"`
+	Canceled bool      `json:"canceled,omitempty"`
+	Started  time.Time `json:"started"`
+	Ended    time.Time `json:"ended"`
+}
+
+type CancelRequest struct {
+	Id string `json:"id"`
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"encoding/json"
+
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+// DefaultKey is the key holding settings which apply to every agent in a cluster, before those for a specific agent.
+const DefaultKey = "default"
+
+// Bucket returns the key value bucket in which remote settings are stored, keyed by nkey or DefaultKey.
+func Bucket(conn *nats.Conn) (kv nats.KeyValue, err error) {
+	var js nats.JetStreamContext
+	if js, err = conn.JetStream(); err != nil {
+		return
+	}
+	if kv, err = js.KeyValue(subject.AgentConfigBucket); err != nil {
+		err = errors.Annotate(err, "failed to open agent config")
+	}
+	return
+}
+
+// Get returns the settings stored under key, which are empty if none have been stored.
+func Get(conn *nats.Conn, key string) (settings *Settings, err error) {
+	var (
+		kv    nats.KeyValue
+		entry nats.KeyValueEntry
+	)
+
+	if kv, err = Bucket(conn); err != nil {
+		return
+	}
+
+	settings = &Settings{}
+	if entry, err = kv.Get(key); errors.Is(err, nats.ErrKeyNotFound) {
+		return settings, nil
+	} else if err != nil {
+		return nil, err
+	} else if err = json.Unmarshal(entry.Value(), settings); err != nil {
+		return nil, errors.Annotatef(err, "failed to unmarshal settings for %s", key)
+	}
+	return
+}
+
+// Update applies fn to the settings stored under key. Updates are made against the revision which was read, and
+// retried should another update happen concurrently.
+func Update(conn *nats.Conn, key string, fn func(settings *Settings) error) (settings *Settings, err error) {
+	var kv nats.KeyValue
+	if kv, err = Bucket(conn); err != nil {
+		return
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		var (
+			entry    nats.KeyValueEntry
+			revision uint64
+		)
+
+		settings = &Settings{}
+		if entry, err = kv.Get(key); err == nil {
+			revision = entry.Revision()
+			if err = json.Unmarshal(entry.Value(), settings); err != nil {
+				return nil, errors.Annotatef(err, "failed to unmarshal settings for %s", key)
+			}
+		} else if !errors.Is(err, nats.ErrKeyNotFound) {
+			return
+		}
+
+		if err = fn(settings); err != nil {
+			return nil, err
+		} else if err = settings.Validate(); err != nil {
+			return nil, err
+		}
+
+		var b []byte
+		if b, err = json.Marshal(settings); err != nil {
+			return
+		}
+
+		if revision == 0 {
+			_, err = kv.Create(key, b)
+		} else {
+			_, err = kv.Update(key, b, revision)
+		}
+
+		if err == nil {
+			return
+		}
+
+		var apiErr *nats.APIError
+		if !(errors.Is(err, nats.ErrKeyExists) || (errors.As(err, &apiErr) && apiErr.ErrorCode == nats.JSErrCodeStreamWrongLastSequence)) {
+			return
+		}
+		// someone else updated the settings, try again
+	}
+
+	return nil, errors.Annotatef(err, "failed to update settings for %s", key)
+}
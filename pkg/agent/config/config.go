@@ -0,0 +1,168 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/pkg/agent/util"
+)
+
+var (
+	NKey string
+	Conn *nats.Conn
+
+	// local are the settings from flags, environment variables and the config file
+	local Settings
+	// remote are the settings from the bucket, indexed by key
+	remote = make(map[string]*Settings)
+	// effective are the local settings with those from the bucket applied
+	effective *Settings
+	lock      sync.RWMutex
+
+	// apply is called whenever the effective settings change
+	apply func(settings *Settings)
+
+	logger *log.Logger
+)
+
+// Init watches the settings in the bucket for this agent and the defaults for every agent, calling fn with the
+// effective settings whenever they change.
+func Init(ctx context.Context, settings *Settings, fn func(settings *Settings)) (err error) {
+	Conn = util.GetConn(ctx)
+	NKey = util.GetNKey(ctx)
+
+	logger = util.Logger("config")
+
+	lock.Lock()
+	local = *settings
+	effective = &local
+	apply = fn
+	lock.Unlock()
+
+	go func() {
+		for {
+			if err := follow(ctx); err != nil {
+				logger.Warn("failed to watch remote config, retrying", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Minute):
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Effective returns the settings currently in use, or nil if remote configuration has not been initialised.
+func Effective() *Settings {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	if effective == nil {
+		return nil
+	}
+	settings := *effective
+	return &settings
+}
+
+// follow applies the current settings for this agent, then any updates as they happen until ctx is cancelled or a
+// watcher fails.
+func follow(ctx context.Context) (err error) {
+	var (
+		kv       nats.KeyValue
+		defaults nats.KeyWatcher
+		own      nats.KeyWatcher
+	)
+
+	if kv, err = Bucket(Conn); err != nil {
+		return
+	}
+
+	// the agent may only read its own key and the defaults, so these are watched separately rather than using a
+	// wildcard
+	if defaults, err = kv.Watch(DefaultKey, nats.Context(ctx)); err != nil {
+		return
+	}
+	defer func() {
+		_ = defaults.Stop()
+	}()
+
+	if own, err = kv.Watch(NKey, nats.Context(ctx)); err != nil {
+		return
+	}
+	defer func() {
+		_ = own.Stop()
+	}()
+
+	// wait until we have the current value for both before applying anything
+	pending := 2
+
+	for {
+		var (
+			entry nats.KeyValueEntry
+			ok    bool
+		)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case entry, ok = <-defaults.Updates():
+		case entry, ok = <-own.Updates():
+		}
+
+		if !ok {
+			return errors.New("remote config watcher closed unexpectedly")
+		} else if entry == nil {
+			if pending--; pending == 0 {
+				update()
+			}
+			continue
+		}
+
+		settings := &Settings{}
+		if entry.Operation() == nats.KeyValuePut {
+			if err = json.Unmarshal(entry.Value(), settings); err != nil {
+				logger.Error("failed to unmarshal remote config", "key", entry.Key(), "error", err)
+				continue
+			} else if err = settings.Validate(); err != nil {
+				logger.Error("ignoring invalid remote config", "key", entry.Key(), "error", err)
+				continue
+			}
+		}
+
+		lock.Lock()
+		remote[entry.Key()] = settings
+		lock.Unlock()
+
+		if pending == 0 {
+			update()
+		}
+	}
+}
+
+// update recomputes the effective settings, applying them if they have changed.
+func update() {
+	lock.Lock()
+
+	settings := local
+	settings.Merge(remote[DefaultKey])
+	settings.Merge(remote[NKey])
+
+	changed := !reflect.DeepEqual(&settings, effective)
+	effective = &settings
+
+	lock.Unlock()
+
+	if changed {
+		logger.Info("applying remote config", "settings", &settings)
+		apply(&settings)
+	}
+}
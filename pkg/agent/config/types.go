@@ -0,0 +1,143 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+)
+
+// Duration is a time.Duration which is represented in JSON in its string form e.g. "30s".
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	*d = Duration(duration)
+	return err
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Settings are those agent settings which can be changed whilst it is running. When stored remotely, only the fields
+// which are set override the agent's local configuration.
+type Settings struct {
+	LogLevel           string    `json:"log-level,omitempty"`
+	HeartbeatInterval  *Duration `json:"heartbeat-interval,omitempty"`
+	HeartbeatKeepalive *Duration `json:"heartbeat-keepalive,omitempty"`
+	HeartbeatJitter    *Duration `json:"heartbeat-jitter,omitempty"`
+	MetricsInterval    *Duration `json:"metrics-interval,omitempty"`
+}
+
+func (s *Settings) String() string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// Merge overrides settings with any which are set in other.
+func (s *Settings) Merge(other *Settings) {
+	if other == nil {
+		return
+	}
+	if other.LogLevel != "" {
+		s.LogLevel = other.LogLevel
+	}
+	if other.HeartbeatInterval != nil {
+		s.HeartbeatInterval = other.HeartbeatInterval
+	}
+	if other.HeartbeatKeepalive != nil {
+		s.HeartbeatKeepalive = other.HeartbeatKeepalive
+	}
+	if other.HeartbeatJitter != nil {
+		s.HeartbeatJitter = other.HeartbeatJitter
+	}
+	if other.MetricsInterval != nil {
+		s.MetricsInterval = other.MetricsInterval
+	}
+}
+
+// Keys returns the names of each setting, as used in its json representation e.g. log-level.
+func Keys() (keys []string) {
+	t := reflect.TypeOf(Settings{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		keys = append(keys, name)
+	}
+	return
+}
+
+// Set changes the named setting, parsing value as it would be from json.
+func (s *Settings) Set(key string, value string) error {
+	return s.update(key, func(values map[string]any) {
+		values[key] = value
+	})
+}
+
+// Unset clears the named setting.
+func (s *Settings) Unset(key string) error {
+	return s.update(key, func(values map[string]any) {
+		delete(values, key)
+	})
+}
+
+// update applies fn to the json representation of the settings, which is simpler than handling each field in turn.
+func (s *Settings) update(key string, fn func(values map[string]any)) (err error) {
+	if !slices.Contains(Keys(), key) {
+		return errors.NotFoundf("setting %q", key)
+	}
+
+	var b []byte
+	if b, err = json.Marshal(s); err != nil {
+		return
+	}
+
+	values := make(map[string]any)
+	if err = json.Unmarshal(b, &values); err != nil {
+		return
+	}
+
+	fn(values)
+
+	if b, err = json.Marshal(values); err != nil {
+		return
+	}
+
+	var updated Settings
+	if err = json.Unmarshal(b, &updated); err != nil {
+		return errors.Annotatef(err, "invalid value for %s", key)
+	}
+
+	*s = updated
+	return nil
+}
+
+// Validate ensures that any settings which are set can be applied.
+func (s *Settings) Validate() error {
+	if s.LogLevel != "" {
+		if _, err := log.ParseLevel(s.LogLevel); err != nil {
+			return errors.NotValidf("log level %q", s.LogLevel)
+		}
+	}
+	for name, d := range map[string]*Duration{
+		"heartbeat interval":  s.HeartbeatInterval,
+		"heartbeat keepalive": s.HeartbeatKeepalive,
+		"metrics interval":    s.MetricsInterval,
+	} {
+		if d != nil && *d <= 0 {
+			return errors.NotValidf("%s %v", name, *d)
+		}
+	}
+	if s.HeartbeatJitter != nil && *s.HeartbeatJitter < 0 {
+		return errors.NotValidf("heartbeat jitter %v", *s.HeartbeatJitter)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"sort"
+	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/juju/errors"
@@ -12,80 +13,99 @@ import (
 	"github.com/numtide/nits/pkg/subject"
 )
 
-func ResolveNKey(ctx context.Context, conn *nats.Conn, name string) (nkey string, err error) {
+// ResolveNKey returns the nkey of the agent matching query, which may be a name, an nkey or an nkey prefix.
+func ResolveNKey(ctx context.Context, conn *nats.Conn, query string) (nkey string, err error) {
 	var agents []*info.Response
 	if agents, err = List(ctx, conn); err != nil {
 		return
 	}
 
-	for _, a := range agents {
-		if a.Name == name {
-			nkey = a.NKey
-			break
-		}
+	var agent *info.Response
+	if agent, err = Resolve(agents, query); err != nil {
+		return
 	}
+	return agent.NKey, nil
+}
 
-	if nkey == "" {
-		return nkey, errors.Errorf("no agent found with name: %s", name)
-	}
+// StaleAfter is how long an agent is considered online after its last heartbeat, unless it disconnected gracefully.
+// It should comfortably exceed the keepalive interval used by the agents. This is the presence TTL of a registration,
+// which is otherwise retained by the registry bucket long after the agent has gone away.
+var StaleAfter = 90 * time.Second
 
+// Registry returns the key value bucket in which agents register themselves.
+func Registry(conn *nats.Conn) (kv nats.KeyValue, err error) {
+	var js nats.JetStreamContext
+	if js, err = conn.JetStream(); err != nil {
+		return
+	}
+	if kv, err = js.KeyValue(subject.AgentRegistryBucket); err != nil {
+		err = errors.Annotate(err, "failed to open agent registry")
+	}
 	return
 }
 
+// List returns every agent in the registry, in descending order of when they were last seen, along with any groups and
+// labels which have been assigned to them.
 func List(ctx context.Context, conn *nats.Conn) (agents []*info.Response, err error) {
 	var (
-		js   nats.JetStreamContext
-		sub  *nats.Subscription
-		msg  *nats.Msg
-		meta *nats.MsgMetadata
+		kv      nats.KeyValue
+		watcher nats.KeyWatcher
 	)
 
-	if js, err = conn.JetStream(); err != nil {
+	if kv, err = Registry(conn); err != nil {
 		return
-	} else if sub, err = js.SubscribeSync(subject.AgentRegistry()+".>", nats.DeliverAll()); err != nil {
+	} else if watcher, err = kv.WatchAll(nats.Context(ctx), nats.IgnoreDeletes()); err != nil {
 		return
 	}
 
 	defer func() {
-		if agents != nil {
-			sort.SliceStable(agents, func(i, j int) bool {
-				// descending order by last seen
-				return agents[i].LastSeen.Compare(agents[j].LastSeen) >= 0
-			})
-		}
+		_ = watcher.Stop()
 	}()
 
 	for {
 		select {
 		case <-ctx.Done():
-			return
-		default:
-			if msg, err = sub.NextMsgWithContext(ctx); !(err == nil || errors.Is(err, nats.ErrTimeout)) {
-				return
-			} else if msg != nil {
-				var resp info.Response
-				if err = json.Unmarshal(msg.Data, &resp); err != nil {
-					// log the error but continue processing the remaining responses
-					log.Error("failed to unmarshal agent info", "error", err)
-				}
-
-				if meta, err = msg.Metadata(); err != nil {
-					return
-				}
-
-				resp.LastSeen = meta.Timestamp
-				agents = append(agents, &resp)
-
-				if meta.NumPending == 0 {
-					// we have read everything in the stream
-					return
+			return nil, ctx.Err()
+		case entry, ok := <-watcher.Updates():
+			if !ok {
+				return nil, errors.New("agent registry watcher closed unexpectedly")
+			} else if entry == nil {
+				// we have received the current value for every key
+				sort.SliceStable(agents, func(i, j int) bool {
+					// descending order by last seen
+					return agents[i].LastSeen.Compare(agents[j].LastSeen) >= 0
+				})
+				if err = mergeMemberships(ctx, conn, agents); err != nil {
+					return nil, err
 				}
+				return agents, nil
 			}
 
+			var resp *info.Response
+			if resp, err = UnmarshalRegistration(entry); err != nil {
+				// log the error but continue processing the remaining entries
+				log.Error("failed to unmarshal agent info", "key", entry.Key(), "error", err)
+				continue
+			}
+			agents = append(agents, resp)
 		}
 	}
 }
 
+// UnmarshalRegistration decodes an entry from the agent registry, marking the agent offline if it has gone stale.
+func UnmarshalRegistration(entry nats.KeyValueEntry) (resp *info.Response, err error) {
+	resp = &info.Response{}
+	if err = json.Unmarshal(entry.Value(), resp); err != nil {
+		return nil, err
+	}
+	resp.LastSeen = entry.Created()
+	// an agent which has not been heard from recently is considered offline, regardless of what it last reported
+	resp.Online = resp.Online && time.Since(resp.LastSeen) <= StaleAfter
+	return
+}
+
+// IndexByFunc indexes agents using keyFn. Where more than one agent shares a key, e.g. a name which has been re-used
+// by a new machine, the most recently seen agent is preferred.
 func IndexByFunc(agents []*info.Response, keyFn func(*info.Response) (string, error)) (indexed map[string]*info.Response, err error) {
 	var key string
 	indexed = make(map[string]*info.Response, len(agents))
@@ -93,6 +113,17 @@ func IndexByFunc(agents []*info.Response, keyFn func(*info.Response) (string, er
 		if key, err = keyFn(agent); err != nil {
 			return
 		}
+		if existing, ok := indexed[key]; ok {
+			preferred, other := existing, agent
+			if agent.LastSeen.After(existing.LastSeen) {
+				preferred, other = agent, existing
+			}
+			log.Debug("more than one agent shares a key, preferring the most recently seen",
+				"key", key, "nkey", preferred.NKey, "ignored", other.NKey,
+			)
+			indexed[key] = preferred
+			continue
+		}
 		indexed[key] = agent
 	}
 	return
@@ -122,14 +153,9 @@ func ListByFunc(ctx context.Context, conn *nats.Conn, keyFn func(*info.Response)
 		return
 	}
 
-	agents = make(map[string]*info.Response)
-	for _, agent := range list {
-		if _, ok := agents[agent.Name]; ok {
-			return nil, errors.Errorf("more than one agent shares this name: %s", agent.Name)
-		}
-		agents[keyFn(agent)] = agent
-	}
-	return
+	return IndexByFunc(list, func(agent *info.Response) (string, error) {
+		return keyFn(agent), nil
+	})
 }
 
 func ListBySubject(ctx context.Context, conn *nats.Conn) (agents map[string]*info.Response, err error) {
@@ -0,0 +1,235 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/numtide/nits/pkg/agent/util"
+	nnats "github.com/numtide/nits/pkg/nats"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+var idRegex = regexp.MustCompile("^[A-Za-z0-9]{1,64}$")
+
+type Options struct {
+	ReadPaths  []string `env:"FILES_READ_PATHS" help:"Paths beneath which files may be copied from the agent. No files may be read when empty."`
+	WritePaths []string `env:"FILES_WRITE_PATHS" help:"Paths beneath which files may be copied to the agent. No files may be written when empty."`
+}
+
+// Validate ensures the read and write paths are absolute.
+func (o *Options) Validate() error {
+	for _, path := range append(o.ReadPaths, o.WritePaths...) {
+		if !filepath.IsAbs(path) {
+			return errors.NotValidf("relative path %q", path)
+		}
+	}
+	return nil
+}
+
+var (
+	NKey string
+	Conn *nats.Conn
+
+	ReadPaths  []string
+	WritePaths []string
+
+	logger *log.Logger
+)
+
+func Init(ctx context.Context, opts *Options) (err error) {
+	Conn = util.GetConn(ctx)
+	NKey = util.GetNKey(ctx)
+	ReadPaths = opts.ReadPaths
+	WritePaths = opts.WritePaths
+
+	logger = util.Logger("files")
+
+	var srv micro.Service
+	if srv, err = micro.AddService(Conn, micro.Config{
+		Name:        "AgentFiles",
+		Version:     "0.0.1",
+		Description: "Copy files to and from the agent.",
+	}); err != nil {
+		return
+	}
+
+	group := srv.AddGroup(subject.AgentService(NKey, "FILES"))
+
+	if err = group.AddEndpoint("GET", micro.HandlerFunc(onGet)); err != nil {
+		return
+	}
+	return group.AddEndpoint("PUT", micro.HandlerFunc(onPut))
+}
+
+func onGet(req micro.Request) {
+	var request GetRequest
+	if err := json.Unmarshal(req.Data(), &request); err != nil {
+		_ = req.Error("400", fmt.Sprintf("Failed to unmarshal request: %s", err), nil)
+		return
+	}
+
+	// transfers can take some time, so we avoid blocking other requests
+	go func() {
+		m, err := get(&request)
+		if err != nil {
+			logger.Error("failed to upload file", "path", request.Path, "error", err)
+			_ = req.Error(errorCode(err), err.Error(), nil)
+			return
+		}
+
+		if err = req.RespondJSON(m); err != nil {
+			logger.Error("failed to respond", "error", err)
+		}
+	}()
+}
+
+func get(req *GetRequest) (m *Manifest, err error) {
+	var (
+		path string
+		f    *os.File
+		stat os.FileInfo
+		obs  nats.ObjectStore
+	)
+
+	if path, err = resolveRead(req.Path); err != nil {
+		return
+	} else if f, err = os.Open(path); err != nil {
+		return
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if stat, err = f.Stat(); err != nil {
+		return
+	}
+
+	id := TransferId(NKey, "get", path, strconv.FormatInt(stat.Size(), 10), stat.ModTime().String())
+
+	logger.Info("uploading file", "path", path, "id", id, "size", stat.Size())
+
+	if m, err = NewManifest(id, f); err != nil {
+		return
+	} else if obs, err = Bucket(Conn, NKey); err != nil {
+		return
+	}
+
+	err = Upload(context.Background(), obs, m, f, func(int64) {})
+	return
+}
+
+func onPut(req micro.Request) {
+	var request PutRequest
+	if err := json.Unmarshal(req.Data(), &request); err != nil {
+		_ = req.Error("400", fmt.Sprintf("Failed to unmarshal request: %s", err), nil)
+		return
+	} else if !idRegex.MatchString(request.Id) {
+		_ = req.Error("400", fmt.Sprintf("Invalid transfer id: %q", request.Id), nil)
+		return
+	}
+
+	// transfers can take some time, so we avoid blocking other requests
+	go func() {
+		resp, err := put(&request)
+		if err != nil {
+			logger.Error("failed to download file", "path", request.Path, "id", request.Id, "error", err)
+			_ = req.Error(errorCode(err), err.Error(), nil)
+			return
+		}
+
+		if err = req.RespondJSON(resp); err != nil {
+			logger.Error("failed to respond", "error", err)
+		}
+	}()
+}
+
+func put(req *PutRequest) (resp *PutResponse, err error) {
+	var (
+		path     string
+		uid, gid = -1, -1
+		obs      nats.ObjectStore
+		m        *Manifest
+		f        *os.File
+	)
+
+	if path, err = resolveWrite(req.Path); err != nil {
+		return
+	} else if uid, gid, err = util.LookupOwner(req.Owner, req.Group); err != nil {
+		return
+	} else if obs, err = Bucket(Conn, NKey); err != nil {
+		return
+	} else if m, err = GetManifest(context.Background(), obs, req.Id); err != nil {
+		return
+	}
+
+	logger.Info("downloading file", "path", path, "id", req.Id, "size", m.Size)
+
+	// write alongside the destination so the rename is atomic, keeping it between attempts so we can resume
+	partial := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.nits-%s", filepath.Base(path), req.Id))
+	if f, err = os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0o600); err != nil {
+		return
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if err = Download(context.Background(), obs, m, f, func(int64) {}); errors.Is(err, ErrCorrupt) {
+		// there is no point resuming from corrupt data
+		_ = os.Remove(partial)
+		return
+	} else if err != nil {
+		return
+	}
+
+	mode := req.Mode
+	if mode == 0 {
+		mode = m.Mode
+	}
+
+	if err = f.Chmod(mode.Perm()); err != nil {
+		return
+	} else if err = f.Chown(uid, gid); err != nil {
+		return
+	} else if err = f.Sync(); err != nil {
+		return
+	} else if err = os.Rename(partial, path); err != nil {
+		return
+	}
+
+	return &PutResponse{Path: path, Size: m.Size}, nil
+}
+
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, errors.Forbidden):
+		return "403"
+	case errors.Is(err, errors.NotFound), errors.Is(err, os.ErrNotExist):
+		return "404"
+	case errors.Is(err, errors.NotValid), errors.Is(err, errors.NotSupported):
+		return "400"
+	default:
+		return "500"
+	}
+}
+
+func GetWithContext(ctx context.Context, conn *nats.EncodedConn, nkey string, req GetRequest) (m *Manifest, err error) {
+	m = &Manifest{}
+	err = nnats.RequestWithContext(ctx, conn, subject.AgentService(nkey, "FILES.GET"), req, m)
+	return
+}
+
+func PutWithContext(ctx context.Context, conn *nats.EncodedConn, nkey string, req PutRequest) (resp PutResponse, err error) {
+	err = nnats.RequestWithContext(ctx, conn, subject.AgentService(nkey, "FILES.PUT"), req, &resp)
+	return
+}
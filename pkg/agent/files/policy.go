@@ -0,0 +1,64 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// resolveRead returns the real path of a file to be read, provided it is within one of the readable paths.
+func resolveRead(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", errors.NotValidf("relative path %s", path)
+	}
+
+	// resolve symlinks so they cannot be used to escape the policy
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	} else if !within(real, ReadPaths) {
+		return "", errors.Forbiddenf("reading %s is not permitted", path)
+	}
+	return real, nil
+}
+
+// resolveWrite returns the path to which a file should be written, provided it is within one of the writable paths.
+// Only the directory is resolved, as the file itself will be replaced.
+func resolveWrite(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", errors.NotValidf("relative path %s", path)
+	}
+
+	path = filepath.Clean(path)
+
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+
+	real := filepath.Join(dir, filepath.Base(path))
+	if !within(real, WritePaths) {
+		return "", errors.Forbiddenf("writing %s is not permitted", path)
+	}
+	return real, nil
+}
+
+// within returns true if path is one of roots or is beneath one of them.
+func within(path string, roots []string) bool {
+	for _, root := range roots {
+		root = filepath.Clean(root)
+		if real, err := filepath.EvalSymlinks(root); err == nil {
+			root = real
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			continue
+		} else if rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package files
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+// PartSize is the size of each part a file is split into.
+const PartSize = 8 * 1024 * 1024
+
+// ErrCorrupt is returned when downloaded data does not match the digests in its manifest.
+const ErrCorrupt = errors.ConstError("transfer is corrupt")
+
+// Bucket returns the object store used for file transfers with the agent with the given nkey.
+func Bucket(conn *nats.Conn, nkey string) (nats.ObjectStore, error) {
+	js, err := conn.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	return js.ObjectStore(subject.AgentFilesBucket(nkey))
+}
+
+// TransferId derives an id for a transfer from values which identify it, such that repeating an interrupted transfer
+// re-uses the parts which have already been stored.
+func TransferId(values ...string) string {
+	h := sha256.New()
+	for _, v := range values {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+func manifestName(id string) string {
+	return id + "/manifest"
+}
+
+func partName(id string, index int) string {
+	return fmt.Sprintf("%s/part-%d", id, index)
+}
+
+// NewManifest reads f, computing a digest for each part and the file as a whole.
+func NewManifest(id string, f *os.File) (m *Manifest, err error) {
+	var stat os.FileInfo
+	if stat, err = f.Stat(); err != nil {
+		return
+	} else if !stat.Mode().IsRegular() {
+		return nil, errors.NotSupportedf("non-regular file %s", f.Name())
+	}
+
+	m = &Manifest{
+		Id:       id,
+		Size:     stat.Size(),
+		Mode:     stat.Mode().Perm(),
+		PartSize: PartSize,
+	}
+
+	total := sha256.New()
+	for offset, index := int64(0), 0; offset < m.Size; offset, index = offset+PartSize, index+1 {
+		size := min(PartSize, m.Size-offset)
+
+		h := sha256.New()
+		if _, err = io.Copy(io.MultiWriter(h, total), io.NewSectionReader(f, offset, size)); err != nil {
+			return nil, errors.Annotatef(err, "failed to read %s", f.Name())
+		}
+
+		m.Parts = append(m.Parts, Part{Index: index, Size: size, Digest: nats.GetObjectDigestValue(h)})
+	}
+
+	m.Digest = nats.GetObjectDigestValue(total)
+	return
+}
+
+// Upload stores the parts of f which are not already present in the object store, followed by the manifest.
+func Upload(ctx context.Context, obs nats.ObjectStore, m *Manifest, f io.ReaderAt, progress func(n int64)) (err error) {
+	for _, part := range m.Parts {
+		name := partName(m.Id, part.Index)
+
+		var info *nats.ObjectInfo
+		if info, err = obs.GetInfo(name, nats.Context(ctx)); err == nil && info.Digest == part.Digest && int64(info.Size) == part.Size {
+			// stored by a previous attempt
+			progress(part.Size)
+			continue
+		} else if err != nil && !errors.Is(err, nats.ErrObjectNotFound) {
+			return errors.Annotatef(err, "failed to check for part %d", part.Index)
+		}
+
+		reader := io.NewSectionReader(f, int64(part.Index)*m.PartSize, part.Size)
+		if _, err = obs.Put(&nats.ObjectMeta{Name: name}, reader, nats.Context(ctx)); err != nil {
+			return errors.Annotatef(err, "failed to store part %d", part.Index)
+		}
+		progress(part.Size)
+	}
+
+	var data []byte
+	if data, err = json.Marshal(m); err != nil {
+		return
+	}
+	_, err = obs.PutBytes(manifestName(m.Id), data, nats.Context(ctx))
+	return errors.Annotate(err, "failed to store manifest")
+}
+
+// GetManifest retrieves the manifest for a transfer, returning an error satisfying errors.NotFound if it does not
+// exist.
+func GetManifest(ctx context.Context, obs nats.ObjectStore, id string) (m *Manifest, err error) {
+	var data []byte
+	if data, err = obs.GetBytes(manifestName(id), nats.Context(ctx)); errors.Is(err, nats.ErrObjectNotFound) {
+		return nil, errors.NotFoundf("transfer %s", id)
+	} else if err != nil {
+		return
+	}
+
+	m = &Manifest{}
+	err = json.Unmarshal(data, m)
+	return
+}
+
+// Download writes the parts of a transfer into f, skipping any parts already present in f from a previous attempt,
+// and verifies the digest of the result.
+func Download(ctx context.Context, obs nats.ObjectStore, m *Manifest, f *os.File, progress func(n int64)) (err error) {
+	for _, part := range m.Parts {
+		offset := int64(part.Index) * m.PartSize
+
+		var ok bool
+		if ok, err = hasPart(f, offset, part); err != nil {
+			return
+		} else if ok {
+			progress(part.Size)
+			continue
+		}
+
+		var result nats.ObjectResult
+		if result, err = obs.Get(partName(m.Id, part.Index), nats.Context(ctx)); err != nil {
+			return errors.Annotatef(err, "failed to retrieve part %d", part.Index)
+		}
+
+		h := sha256.New()
+		_, err = io.Copy(io.NewOffsetWriter(f, offset), io.TeeReader(result, h))
+		_ = result.Close()
+
+		if err != nil {
+			return errors.Annotatef(err, "failed to write part %d", part.Index)
+		} else if digest := nats.GetObjectDigestValue(h); digest != part.Digest {
+			return errors.Annotatef(ErrCorrupt, "part %d has digest %s, expected %s", part.Index, digest, part.Digest)
+		}
+		progress(part.Size)
+	}
+
+	if err = f.Truncate(m.Size); err != nil {
+		return
+	}
+
+	h := sha256.New()
+	if _, err = io.Copy(h, io.NewSectionReader(f, 0, m.Size)); err != nil {
+		return
+	} else if digest := nats.GetObjectDigestValue(h); digest != m.Digest {
+		return errors.Annotatef(ErrCorrupt, "file has digest %s, expected %s", digest, m.Digest)
+	}
+	return
+}
+
+// hasPart returns true if f already contains part at offset.
+func hasPart(f *os.File, offset int64, part Part) (bool, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return false, err
+	} else if stat.Size() < offset+part.Size {
+		return false, nil
+	}
+
+	var h hash.Hash = sha256.New()
+	if _, err = io.Copy(h, io.NewSectionReader(f, offset, part.Size)); err != nil {
+		return false, err
+	}
+	return nats.GetObjectDigestValue(h) == part.Digest, nil
+}
+
+// Remove deletes the manifest and parts of a transfer once it is complete.
+func Remove(obs nats.ObjectStore, m *Manifest) (err error) {
+	for _, part := range m.Parts {
+		if err = obs.Delete(partName(m.Id, part.Index)); err != nil && !errors.Is(err, nats.ErrObjectNotFound) {
+			return
+		}
+	}
+	if err = obs.Delete(manifestName(m.Id)); errors.Is(err, nats.ErrObjectNotFound) {
+		err = nil
+	}
+	return
+}
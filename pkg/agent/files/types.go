@@ -0,0 +1,42 @@
+package files
+
+import "os"
+
+// Part is a fixed size section of a file, stored as a separate object so that an interrupted transfer can resume
+// from the last complete part.
+type Part struct {
+	Index  int    `json:"index"`
+	Size   int64  `json:"size"`
+	Digest string `json:"digest"`
+}
+
+// Manifest describes a file which has been split into parts within the object store.
+type Manifest struct {
+	Id       string      `json:"id"`
+	Size     int64       `json:"size"`
+	Mode     os.FileMode `json:"mode"`
+	PartSize int64       `json:"part-size"`
+	Parts    []Part      `json:"parts"`
+	// Digest of the whole file, in the same format as the object store.
+	Digest string `json:"digest"`
+}
+
+// GetRequest asks the agent to upload a file into the object store.
+type GetRequest struct {
+	Path string `json:"path"`
+}
+
+// PutRequest asks the agent to download a file from the object store, writing it to Path.
+type PutRequest struct {
+	Id   string `json:"id"`
+	Path string `json:"path"`
+	// Mode of the file, if zero the mode recorded in the manifest is used.
+	Mode  os.FileMode `json:"mode,omitempty"`
+	Owner string      `json:"owner,omitempty"`
+	Group string      `json:"group,omitempty"`
+}
+
+type PutResponse struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
@@ -0,0 +1,221 @@
+package forward
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/numtide/nits/pkg/agent/util"
+	nnats "github.com/numtide/nits/pkg/nats"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+const (
+	dialTimeout = 10 * time.Second
+
+	// KeepaliveInterval is how often the client signals it is still present whilst a connection is being forwarded.
+	KeepaliveInterval = 30 * time.Second
+)
+
+var idRegex = regexp.MustCompile("^[A-Za-z0-9]{1,64}$")
+
+type Options struct {
+	Allow       []string      `env:"FORWARD_ALLOW" help:"Addresses which connections may be forwarded to, in the form host:port. Either may be a glob pattern e.g. localhost:* or *:80. No connections are forwarded when empty."`
+	IdleTimeout time.Duration `env:"FORWARD_IDLE_TIMEOUT" default:"5m" help:"Close a forwarded connection if neither data nor a keepalive has been received from the client for this long."`
+}
+
+// Validate ensures every allowed address is in the form host:port, with valid glob patterns for each.
+func (o *Options) Validate() error {
+	for _, pattern := range o.Allow {
+		host, port, err := net.SplitHostPort(pattern)
+		if err != nil {
+			return errors.NotValidf("allowed address %q", pattern)
+		} else if _, err = path.Match(host, ""); err != nil {
+			return errors.NotValidf("allowed address %q", pattern)
+		} else if _, err = path.Match(port, ""); err != nil {
+			return errors.NotValidf("allowed address %q", pattern)
+		}
+	}
+	if o.IdleTimeout <= KeepaliveInterval {
+		return errors.Errorf("invalid idle timeout %v, it must be greater than the keepalive interval of %v", o.IdleTimeout, KeepaliveInterval)
+	}
+	return nil
+}
+
+var (
+	NKey string
+	Conn *nats.Conn
+
+	Allow       []string
+	IdleTimeout time.Duration
+
+	logger *log.Logger
+)
+
+func Init(ctx context.Context, opts *Options) (err error) {
+	Conn = util.GetConn(ctx)
+	NKey = util.GetNKey(ctx)
+	Allow = opts.Allow
+	IdleTimeout = opts.IdleTimeout
+
+	logger = util.Logger("forward")
+
+	for _, pattern := range Allow {
+		if _, _, err = net.SplitHostPort(pattern); err != nil {
+			return errors.Annotatef(err, "invalid forward allow pattern %q", pattern)
+		}
+	}
+
+	var srv micro.Service
+	if srv, err = micro.AddService(Conn, micro.Config{
+		Name:        "AgentForward",
+		Version:     "0.0.1",
+		Description: "Forward TCP connections through the agent.",
+	}); err != nil {
+		return
+	}
+
+	group := srv.AddGroup(subject.AgentService(NKey, "FORWARD"))
+	return group.AddEndpoint("DIAL", micro.HandlerFunc(onDial))
+}
+
+func onDial(req micro.Request) {
+	var request DialRequest
+
+	if err := json.Unmarshal(req.Data(), &request); err != nil {
+		_ = req.Error("400", fmt.Sprintf("Failed to unmarshal request: %s", err), nil)
+		return
+	} else if !idRegex.MatchString(request.Id) {
+		_ = req.Error("400", fmt.Sprintf("Invalid connection id: %q", request.Id), nil)
+		return
+	}
+
+	if ok, err := allowed(request.Address); err != nil {
+		_ = req.Error("400", err.Error(), nil)
+		return
+	} else if !ok {
+		logger.Warn("refused to forward to an address which is not allowed", "address", request.Address)
+		_ = req.Error("403", fmt.Sprintf("Address %s is not in the allow-list", request.Address), nil)
+		return
+	}
+
+	// handlers are invoked one at a time, so a slow or unreachable address must not hold up other requests
+	go dial(req, request)
+}
+
+// dial connects to the requested address, responding once the connection has been established and forwarding it
+// until either side closes.
+func dial(req micro.Request, request DialRequest) {
+	var (
+		err  error
+		conn net.Conn
+		pipe *nnats.Pipe
+	)
+
+	if conn, err = net.DialTimeout("tcp", request.Address, dialTimeout); err != nil {
+		_ = req.Error("502", fmt.Sprintf("Failed to connect to %s: %s", request.Address, err), nil)
+		return
+	}
+
+	if pipe, err = nnats.NewPipe(Conn, AgentSubject(NKey, request.Id), ClientSubject(NKey, request.Id), nnats.DefaultPipeWindow); err != nil {
+		_ = conn.Close()
+		_ = req.Error("500", err.Error(), nil)
+		return
+	}
+
+	resp := DialResponse{Id: request.Id, RemoteAddress: conn.RemoteAddr().String()}
+	if err = req.RespondJSON(resp); err != nil {
+		logger.Error("failed to respond", "error", err)
+		_ = conn.Close()
+		_ = pipe.Close()
+		return
+	}
+
+	logger.Debug("forwarding connection", "id", request.Id, "address", request.Address)
+
+	go closeIdle(request.Id, pipe)
+
+	Join(conn, pipe)
+	logger.Debug("forwarded connection closed", "id", request.Id, "address", request.Address)
+}
+
+// closeIdle closes the pipe if nothing has been received from the client for longer than the idle timeout, e.g. because
+// it went away without closing its end.
+func closeIdle(id string, pipe *nnats.Pipe) {
+	ticker := time.NewTicker(KeepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pipe.Done():
+			return
+		case <-ticker.C:
+			if time.Since(pipe.LastActivity()) > IdleTimeout {
+				logger.Info("forwarded connection idle, closing", "id", id, "timeout", IdleTimeout)
+				_ = pipe.Close()
+				return
+			}
+		}
+	}
+}
+
+// allowed returns true if address matches one of the allow-list patterns.
+func allowed(address string) (bool, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return false, errors.NotValidf("address %q", address)
+	}
+
+	for _, pattern := range Allow {
+		hostPattern, portPattern, _ := net.SplitHostPort(pattern)
+		if ok, _ := path.Match(hostPattern, host); !ok {
+			continue
+		} else if ok, _ = path.Match(portPattern, port); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Join copies data between a connection and a pipe in both directions, closing both once either side has finished.
+func Join(conn net.Conn, pipe *nnats.Pipe) {
+	var once sync.Once
+	closeBoth := func() {
+		once.Do(func() {
+			_ = conn.Close()
+			_ = pipe.Close()
+		})
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		defer closeBoth()
+		_, _ = io.Copy(pipe, conn)
+	}()
+
+	go func() {
+		defer wg.Done()
+		defer closeBoth()
+		_, _ = io.Copy(conn, pipe)
+	}()
+
+	wg.Wait()
+}
+
+func DialWithContext(ctx context.Context, conn *nats.EncodedConn, nkey string, req DialRequest) (resp DialResponse, err error) {
+	err = nnats.RequestWithContext(ctx, conn, subject.AgentService(nkey, "FORWARD.DIAL"), req, &resp)
+	return
+}
@@ -0,0 +1,13 @@
+package forward
+
+import "github.com/numtide/nits/pkg/subject"
+
+// AgentSubject is where the agent receives data and credit for a connection.
+func AgentSubject(nkey string, id string) string {
+	return subject.AgentForward(nkey, id) + ".AGENT"
+}
+
+// ClientSubject is where the client receives data and credit for a connection.
+func ClientSubject(nkey string, id string) string {
+	return subject.AgentForward(nkey, id) + ".CLIENT"
+}
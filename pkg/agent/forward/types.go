@@ -0,0 +1,15 @@
+package forward
+
+type DialRequest struct {
+	// Id of the connection, chosen by the client so that it can subscribe to the connection's subjects before the
+	// agent starts forwarding data.
+	Id string `json:"id"`
+	// Address to connect to from the agent, in the form host:port.
+	Address string `json:"address"`
+}
+
+type DialResponse struct {
+	Id string `json:"id"`
+	// RemoteAddress is the address the agent connected to.
+	RemoteAddress string `json:"remote-address"`
+}
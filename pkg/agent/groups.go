@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/pkg/agent/info"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+// Membership records the groups and labels which operators have assigned to an agent.
+type Membership struct {
+	Groups []string          `json:"groups,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Groups returns the key value bucket in which agent memberships are stored.
+func Groups(conn *nats.Conn) (kv nats.KeyValue, err error) {
+	var js nats.JetStreamContext
+	if js, err = conn.JetStream(); err != nil {
+		return
+	}
+	if kv, err = js.KeyValue(subject.AgentGroupsBucket); err != nil {
+		err = errors.Annotate(err, "failed to open agent groups")
+	}
+	return
+}
+
+// ListMemberships returns the membership of every agent which has been assigned groups or labels, keyed by nkey.
+func ListMemberships(ctx context.Context, conn *nats.Conn) (memberships map[string]*Membership, err error) {
+	var (
+		kv      nats.KeyValue
+		watcher nats.KeyWatcher
+	)
+
+	if kv, err = Groups(conn); err != nil {
+		return
+	} else if watcher, err = kv.WatchAll(nats.Context(ctx), nats.IgnoreDeletes()); err != nil {
+		return
+	}
+
+	defer func() {
+		_ = watcher.Stop()
+	}()
+
+	memberships = make(map[string]*Membership)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case entry, ok := <-watcher.Updates():
+			if !ok {
+				return nil, errors.New("agent groups watcher closed unexpectedly")
+			} else if entry == nil {
+				// we have received the current value for every key
+				return memberships, nil
+			}
+
+			var membership Membership
+			if err = json.Unmarshal(entry.Value(), &membership); err != nil {
+				return nil, errors.Annotatef(err, "failed to unmarshal membership for %s", entry.Key())
+			}
+			memberships[entry.Key()] = &membership
+		}
+	}
+}
+
+// UpdateMembership applies fn to the membership of the agent with the given nkey. Updates are made against the
+// revision which was read, and retried should another update happen concurrently.
+func UpdateMembership(conn *nats.Conn, nkey string, fn func(membership *Membership)) (membership *Membership, err error) {
+	var kv nats.KeyValue
+	if kv, err = Groups(conn); err != nil {
+		return
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		var (
+			entry    nats.KeyValueEntry
+			revision uint64
+			b        []byte
+		)
+
+		membership = &Membership{}
+
+		if entry, err = kv.Get(nkey); errors.Is(err, nats.ErrKeyNotFound) {
+			err = nil
+		} else if err != nil {
+			return
+		} else {
+			revision = entry.Revision()
+			if err = json.Unmarshal(entry.Value(), membership); err != nil {
+				return
+			}
+		}
+
+		fn(membership)
+
+		// keep things tidy and deterministic
+		slices.Sort(membership.Groups)
+		membership.Groups = slices.Compact(membership.Groups)
+		if len(membership.Labels) == 0 {
+			membership.Labels = nil
+		}
+
+		if b, err = json.Marshal(membership); err != nil {
+			return
+		}
+
+		if revision == 0 {
+			_, err = kv.Create(nkey, b)
+		} else {
+			_, err = kv.Update(nkey, b, revision)
+		}
+
+		if err == nil {
+			return
+		}
+
+		var apiErr *nats.APIError
+		if !(errors.Is(err, nats.ErrKeyExists) || (errors.As(err, &apiErr) && apiErr.ErrorCode == nats.JSErrCodeStreamWrongLastSequence)) {
+			return
+		}
+		// someone else updated the membership, try again
+	}
+
+	return nil, errors.Annotatef(err, "failed to update membership for %s", nkey)
+}
+
+// mergeMemberships adds the groups and labels assigned to each agent. Labels assigned centrally take precedence over
+// those the agent was configured with. A missing bucket, e.g. for a cluster which has not been updated since groups
+// were introduced, is treated as there being no memberships.
+func mergeMemberships(ctx context.Context, conn *nats.Conn, agents []*info.Response) error {
+	memberships, err := ListMemberships(ctx, conn)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, agent := range agents {
+		if membership, ok := memberships[agent.NKey]; ok {
+			agent.Groups = membership.Groups
+			if len(membership.Labels) > 0 {
+				labels := make(map[string]string, len(agent.Labels)+len(membership.Labels))
+				maps.Copy(labels, agent.Labels)
+				maps.Copy(labels, membership.Labels)
+				agent.Labels = labels
+			}
+		}
+	}
+	return nil
+}
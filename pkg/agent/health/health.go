@@ -0,0 +1,133 @@
+package health
+
+import (
+	"context"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/numtide/nits/pkg/agent/info"
+	"github.com/numtide/nits/pkg/agent/util"
+)
+
+// maxOutput is how much of the output of a failing check is logged.
+const maxOutput = 4096
+
+var nameRegex = regexp.MustCompile("^[A-Za-z0-9_.-]{1,64}$")
+
+type Options struct {
+	Checks   map[string]string `env:"HEALTH_CHECKS" placeholder:"NAME=COMMAND" help:"Commands to run periodically by name, each with /bin/sh e.g. nginx='systemctl is-active nginx'. A check passes when its command exits zero."`
+	Interval time.Duration     `env:"HEALTH_INTERVAL" default:"1m" help:"How often to run the health checks."`
+	Timeout  time.Duration     `env:"HEALTH_TIMEOUT" default:"30s" help:"How long a health check may run before it is considered to have failed."`
+}
+
+// Validate ensures check names are usable as identifiers, that every check has a command and the interval and timeout
+// are positive.
+func (o *Options) Validate() error {
+	for name, command := range o.Checks {
+		if !nameRegex.MatchString(name) {
+			return errors.NotValidf("health check name %q", name)
+		} else if strings.TrimSpace(command) == "" {
+			return errors.NotValidf("empty command for health check %q", name)
+		}
+	}
+	if o.Interval <= 0 {
+		return errors.NotValidf("health check interval %v", o.Interval)
+	} else if o.Timeout <= 0 {
+		return errors.NotValidf("health check timeout %v", o.Timeout)
+	}
+	return nil
+}
+
+var logger *log.Logger
+
+// Init begins running the configured health checks, recording their outcome in the agent's registration. Nothing is
+// run if there are no checks.
+func Init(ctx context.Context, opts *Options) (err error) {
+	logger = util.Logger("health")
+
+	if err = opts.Validate(); err != nil || len(opts.Checks) == 0 {
+		return
+	}
+
+	go run(ctx, opts)
+	return
+}
+
+func run(ctx context.Context, opts *Options) {
+	names := make([]string, 0, len(opts.Checks))
+	for name := range opts.Checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var previous map[string]info.Check
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		checks := make([]info.Check, 0, len(names))
+		current := make(map[string]info.Check, len(names))
+
+		for _, name := range names {
+			check, output := runCheck(ctx, name, opts.Checks[name], opts.Timeout)
+			if ctx.Err() != nil {
+				// checks which were interrupted by shutting down did not fail
+				return
+			}
+
+			if last, ok := previous[name]; ok && last.Passing == check.Passing {
+				check.Since = last.Since
+			} else if check.Passing {
+				logger.Info("health check passing", "name", name)
+			} else {
+				logger.Warn("health check failing", "name", name, "error", check.Error, "output", output)
+			}
+
+			checks = append(checks, check)
+			current[name] = check
+		}
+
+		previous = current
+		info.SetHealth(checks)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runCheck runs the command for a check, returning its outcome along with the tail of its output should it fail.
+func runCheck(ctx context.Context, name string, command string, timeout time.Duration) (info.Check, string) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	check := info.Check{Name: name, Passing: true, Since: time.Now().UTC()}
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	// background processes started by the check should not keep it running once it has been killed
+	cmd.WaitDelay = time.Second
+
+	output, err := cmd.CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		check.Passing = false
+		check.Error = "timed out after " + timeout.String()
+	} else if err != nil {
+		check.Passing = false
+		check.Error = err.Error()
+	}
+
+	if check.Passing {
+		return check, ""
+	} else if len(output) > maxOutput {
+		output = output[len(output)-maxOutput:]
+	}
+	return check, strings.TrimSpace(string(output))
+}
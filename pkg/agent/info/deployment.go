@@ -0,0 +1,38 @@
+package info
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type DeploymentOutcome string
+
+const (
+	DeploymentInProgress DeploymentOutcome = "in-progress"
+	DeploymentSuccess    DeploymentOutcome = "success"
+	DeploymentFailure    DeploymentOutcome = "failure"
+)
+
+// Deployment summarises the most recent deployment to an agent.
+type Deployment struct {
+	Id      string            `json:"id"`
+	Action  string            `json:"action"`
+	Closure string            `json:"closure"`
+	Outcome DeploymentOutcome `json:"outcome"`
+	Error   string            `json:"error,omitempty"`
+	Started time.Time         `json:"started"`
+	Ended   *time.Time        `json:"ended,omitempty"`
+}
+
+var lastDeployment atomic.Pointer[Deployment]
+
+// SetDeployment records the state of the most recent deployment, refreshing the agent's registration to reflect it.
+func SetDeployment(deployment *Deployment) {
+	lastDeployment.Store(deployment)
+	Refresh()
+}
+
+// LastDeployment returns the most recent deployment, or nil if there has not been one.
+func LastDeployment() *Deployment {
+	return lastDeployment.Load()
+}
@@ -0,0 +1,42 @@
+package info
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Check is the outcome of the most recent run of a health check configured on the agent.
+type Check struct {
+	Name    string `json:"name"`
+	Passing bool   `json:"passing"`
+	// Error describes why the check is failing e.g. its exit status, its output is logged by the agent instead.
+	Error string `json:"error,omitempty"`
+	// Since is when the check last changed between passing and failing.
+	Since time.Time `json:"since"`
+}
+
+var healthChecks atomic.Pointer[[]Check]
+
+// SetHealth records the outcome of the health checks, refreshing the agent's registration to reflect any change.
+func SetHealth(checks []Check) {
+	healthChecks.Store(&checks)
+	Refresh()
+}
+
+// Health returns the outcome of the health checks, or nil if there are none or they have yet to run.
+func Health() []Check {
+	if checks := healthChecks.Load(); checks != nil {
+		return *checks
+	}
+	return nil
+}
+
+// Healthy returns true if every health check is passing.
+func Healthy(checks []Check) bool {
+	for _, check := range checks {
+		if !check.Passing {
+			return false
+		}
+	}
+	return true
+}
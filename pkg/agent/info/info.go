@@ -16,6 +16,7 @@ import (
 	"github.com/charmbracelet/log"
 
 	"github.com/nats-io/nats.go/micro"
+	"github.com/numtide/nits/pkg/agent/config"
 	"github.com/numtide/nits/pkg/agent/util"
 	nnats "github.com/numtide/nits/pkg/nats"
 	"github.com/numtide/nits/pkg/subject"
@@ -29,17 +30,24 @@ import (
 var (
 	NKey   string
 	Claims *jwt.UserClaims
+	Conn   *nats.Conn
+	Labels map[string]string
 	logger *log.Logger
 )
 
-func Init(ctx context.Context) (err error) {
+func Init(ctx context.Context, heartbeatOpts *HeartbeatOptions, labels map[string]string) (err error) {
 	NKey = util.GetNKey(ctx)
 	Claims = util.GetClaims(ctx)
-	conn := util.GetConn(ctx)
+	Conn = util.GetConn(ctx)
+	Labels = labels
 
-	logger = log.Default().With("service", "info")
+	logger = util.Logger("info")
 
-	_, err = micro.AddService(conn, micro.Config{
+	if heartbeatOpts.Interval <= 0 {
+		return errors.New("heartbeat interval must be greater than zero")
+	}
+
+	if _, err = micro.AddService(Conn, micro.Config{
 		Name:        "AgentInfo",
 		Version:     "0.0.1",
 		Description: "Information about an agent and the machine it is running on",
@@ -47,42 +55,12 @@ func Init(ctx context.Context) (err error) {
 			Subject: subject.AgentService(NKey, "INFO"),
 			Handler: micro.HandlerFunc(handler),
 		},
-	})
-
-	// send a basic info package every second to the registry subject
-
-	info := Response{NKey: NKey, Name: Claims.Name, Subject: subject.AgentWithNKey(NKey)}
-
-	var heartbeat []byte
-	if heartbeat, err = json.Marshal(info); err != nil {
-		return err
+	}); err != nil {
+		return
 	}
 
-	go func() {
-		ticker := time.Tick(1 * time.Second)
-		subj := subject.AgentRegistration(NKey)
-
-		var (
-			err error
-			msg *nats.Msg
-		)
-
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker:
-				msg = nats.NewMsg(subj)
-				msg.Data = heartbeat
-				// conflate updates
-				msg.Header.Set(nats.MsgRollup, nats.MsgRollupSubject)
-
-				if err = conn.PublishMsg(msg); err != nil {
-					log.Error("failed to publish registry heartbeat", "error", err)
-				}
-			}
-		}
-	}()
+	// register with the agent registry
+	go heartbeat(ctx, heartbeatOpts)
 
 	return
 }
@@ -123,6 +101,8 @@ func info(req *Request) (resp *Response, err error) {
 		NKey:    NKey,
 		Name:    Claims.Name,
 		Subject: subject.AgentWithNKey(NKey),
+		Health:  Health(),
+		Labels:  Labels,
 	}
 
 	if req.All || req.Cpus {
@@ -176,6 +156,22 @@ func info(req *Request) (resp *Response, err error) {
 		if resp.Disk.Partitions, err = disk.Partitions(true); err != nil {
 			return nil, errors.Annotate(err, "failed to retrieve disk partitions")
 		}
+
+		// usage is only reported for physical devices, avoiding the many pseudo filesystems such as proc and sysfs
+		var physical []disk.PartitionStat
+		if physical, err = disk.Partitions(false); err != nil {
+			return nil, errors.Annotate(err, "failed to retrieve physical disk partitions")
+		}
+
+		for _, partition := range physical {
+			usage, err := disk.Usage(partition.Mountpoint)
+			if err != nil {
+				// a mount may be inaccessible or have disappeared, which should not prevent reporting the others
+				logger.Warn("failed to retrieve disk usage", "mountpoint", partition.Mountpoint, "error", err)
+				continue
+			}
+			resp.Disk.Usage = append(resp.Disk.Usage, usage)
+		}
 	}
 
 	if req.All || req.Memory {
@@ -191,6 +187,10 @@ func info(req *Request) (resp *Response, err error) {
 		}
 	}
 
+	if req.All || req.Config {
+		resp.Config = config.Effective()
+	}
+
 	return
 }
 
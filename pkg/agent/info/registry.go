@@ -0,0 +1,199 @@
+package info
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/internal/build"
+	"github.com/numtide/nits/pkg/nix"
+	"github.com/numtide/nits/pkg/subject"
+	"github.com/shirou/gopsutil/v3/host"
+)
+
+type HeartbeatOptions struct {
+	Interval  time.Duration `env:"HEARTBEAT_INTERVAL" default:"5s" help:"How often to check whether the registration has changed, publishing it if so."`
+	Keepalive time.Duration `env:"HEARTBEAT_KEEPALIVE" default:"30s" help:"Maximum time between publishing registrations when nothing has changed."`
+	Jitter    time.Duration `env:"HEARTBEAT_JITTER" default:"5s" help:"Random delay added to each keepalive, avoiding agents publishing in lockstep."`
+}
+
+// heartbeatUpdates is used to change the heartbeat options whilst running.
+var heartbeatUpdates = make(chan HeartbeatOptions, 1)
+
+// UpdateHeartbeat replaces the heartbeat options, taking effect from the next heartbeat.
+func UpdateHeartbeat(opts HeartbeatOptions) {
+	for {
+		select {
+		case heartbeatUpdates <- opts:
+			return
+		default:
+			// discard an update which has yet to be applied in favour of this one
+			select {
+			case <-heartbeatUpdates:
+			default:
+			}
+		}
+	}
+}
+
+// refresh is used to request the registration be checked for changes immediately.
+var refresh = make(chan struct{}, 1)
+
+// Refresh requests that the registration be checked for changes, and published if it has, without waiting for the
+// next interval.
+func Refresh() {
+	select {
+	case refresh <- struct{}{}:
+	default:
+		// a refresh is already pending
+	}
+}
+
+var (
+	// nixosInfo caches the NixOS version, which is only looked up again when the current system changes.
+	nixosInfo *NixOS
+	nixosLock sync.Mutex
+)
+
+// registration returns the entry to be stored in the agent registry. It should only contain values which change
+// infrequently, since any change results in the registration being published.
+func registration(online bool) Response {
+	resp := Response{
+		NKey:       NKey,
+		Name:       Claims.Name,
+		Subject:    subject.AgentWithNKey(NKey),
+		Version:    build.Version,
+		Deployment: LastDeployment(),
+		Health:     Health(),
+		Labels:     Labels,
+		Online:     online,
+	}
+
+	if bootTime, err := host.BootTime(); err != nil {
+		logger.Warn("failed to retrieve boot time", "error", err)
+	} else {
+		resp.BootTime = time.Unix(int64(bootTime), 0).UTC()
+	}
+
+	if isNixos, err := nix.IsHostNixOS(); err != nil {
+		logger.Warn("failed to determine if host is NixOS", "error", err)
+	} else if isNixos {
+		nixosLock.Lock()
+		defer nixosLock.Unlock()
+
+		system, err := nix.GetSystem()
+		if err != nil {
+			logger.Warn("failed to retrieve nixos system", "error", err)
+		} else if nixosInfo == nil || nixosInfo.CurrentSystem != system {
+			var version string
+			if version, err = nix.GetNixOSVersion(); err != nil {
+				logger.Warn("failed to retrieve nixos version", "error", err)
+			}
+			nixosInfo = &NixOS{Version: version, CurrentSystem: system}
+		}
+		resp.NixOS = nixosInfo
+	}
+
+	return resp
+}
+
+// register publishes an entry directly to the registry bucket's subject for this agent. We publish rather than using
+// the key value api so that agents do not require access to the JetStream api.
+func register(data []byte) error {
+	return Conn.Publish(subject.AgentRegistration(NKey), data)
+}
+
+func heartbeat(ctx context.Context, opts *HeartbeatOptions) {
+	var (
+		last      []byte
+		lastSent  time.Time
+		keepalive time.Duration
+		connected bool
+	)
+
+	nextKeepalive := func() time.Duration {
+		if opts.Jitter <= 0 {
+			return opts.Keepalive
+		}
+		return opts.Keepalive + time.Duration(rand.Int63n(int64(opts.Jitter)))
+	}
+
+	beat := func() {
+		if !Conn.IsConnected() {
+			// nothing to be gained by buffering heartbeats whilst disconnected
+			connected = false
+			return
+		}
+
+		data, err := json.Marshal(registration(true))
+		if err != nil {
+			logger.Error("failed to marshal registration", "error", err)
+			return
+		}
+
+		// publish whenever the registration changes, or we have just (re)connected and our registration may have gone
+		// stale, otherwise only once the keepalive has elapsed
+		if connected && bytes.Equal(data, last) && time.Since(lastSent) < keepalive {
+			return
+		}
+
+		if err = register(data); err != nil {
+			logger.Error("failed to publish registration", "error", err)
+			return
+		}
+
+		connected = true
+		last = data
+		lastSent = time.Now()
+		keepalive = nextKeepalive()
+	}
+
+	// when many agents start together, e.g. after a server restart, spread out their initial registrations
+	if opts.Jitter > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(rand.Int63n(int64(opts.Jitter)))):
+		}
+	}
+
+	beat()
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-refresh:
+			beat()
+		case update := <-heartbeatUpdates:
+			opts = &update
+			ticker.Reset(opts.Interval)
+			keepalive = nextKeepalive()
+		case <-ticker.C:
+			beat()
+		}
+	}
+}
+
+// Offline marks the agent as offline in the registry. It should be called when the agent is shutting down gracefully,
+// so that it is not considered online until its last heartbeat goes stale.
+func Offline() (err error) {
+	if Conn == nil || Conn.Status() != nats.CONNECTED {
+		return
+	}
+
+	var data []byte
+	if data, err = json.Marshal(registration(false)); err != nil {
+		return
+	} else if err = register(data); err != nil {
+		return
+	}
+	return Conn.Flush()
+}
@@ -3,6 +3,7 @@ package info
 import (
 	"time"
 
+	"github.com/numtide/nits/pkg/agent/config"
 	"github.com/numtide/nits/pkg/nix"
 
 	"github.com/shirou/gopsutil/v3/cpu"
@@ -21,6 +22,7 @@ type Request struct {
 	Load   bool `json:"load"`
 	Memory bool `json:"memory"`
 	Disk   bool `json:"disk"`
+	Config bool `json:"config"`
 }
 
 type Response struct {
@@ -35,7 +37,28 @@ type Response struct {
 	Memory  *Memory        `json:"memory,omitempty"`
 	Disk    *Disk          `json:"disk,omitempty"`
 
-	LastSeen time.Time
+	// Config holds the settings in effect after applying any remote configuration.
+	Config *config.Settings `json:"config,omitempty"`
+
+	// Version is the build version of the agent.
+	Version string `json:"version,omitempty"`
+	// BootTime is when the host last booted, from which its uptime can be derived.
+	BootTime time.Time `json:"boot-time"`
+	// Deployment is the most recent deployment to the agent, if any.
+	Deployment *Deployment `json:"deployment,omitempty"`
+
+	// Health is the outcome of the health checks configured on the agent, if any.
+	Health []Check `json:"health,omitempty"`
+
+	// Groups are assigned centrally by operators, and merged into the response when reading the registry. Labels may
+	// also be configured on the agent, with those assigned centrally taking precedence.
+	Groups []string          `json:"groups,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Online is set by the agent when it registers, and cleared when it disconnects gracefully. When reading from
+	// the registry it is also cleared if the agent has not been seen recently.
+	Online   bool      `json:"online"`
+	LastSeen time.Time `json:"last-seen"`
 }
 
 type NixOS struct {
@@ -61,4 +84,5 @@ type Memory struct {
 
 type Disk struct {
 	Partitions []disk.PartitionStat `json:"partitions,omitempty"`
+	Usage      []*disk.UsageStat    `json:"usage,omitempty"`
 }
@@ -0,0 +1,150 @@
+package journal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os/exec"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/pkg/agent/util"
+	nlog "github.com/numtide/nits/pkg/logging"
+	nnats "github.com/numtide/nits/pkg/nats"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+// maxEntrySize is the largest journal entry we will attempt to forward.
+const maxEntrySize = 1024 * 1024
+
+type Options struct {
+	Enable     bool     `env:"JOURNAL_ENABLE" help:"Forward entries from the systemd journal."`
+	Units      []string `env:"JOURNAL_UNITS" help:"Only forward entries for these systemd units. Forwards all entries when empty."`
+	CursorFile string   `env:"JOURNAL_CURSOR_FILE" help:"File in which to track the journal position across restarts."`
+}
+
+var (
+	NKey string
+	Conn *nats.Conn
+
+	Spool *nnats.Spool
+
+	logger  *log.Logger
+	writers map[string]*nnats.Writer
+)
+
+func Init(ctx context.Context, opts *Options) (err error) {
+	Conn = util.GetConn(ctx)
+	NKey = util.GetNKey(ctx)
+	Spool = util.GetSpool(ctx)
+
+	logger = util.Logger("journal")
+	writers = make(map[string]*nnats.Writer)
+
+	if _, err = exec.LookPath("journalctl"); err != nil {
+		return errors.Annotate(err, "journalctl could not be found")
+	}
+
+	go func() {
+		defer closeWriters()
+
+		for {
+			if err := follow(ctx, opts); err != nil {
+				logger.Error("failed to follow journal", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+				logger.Info("restarting journal follower")
+			}
+		}
+	}()
+
+	return
+}
+
+func follow(ctx context.Context, opts *Options) (err error) {
+	args := []string{"--output", "json", "--follow"}
+	if opts.CursorFile != "" {
+		args = append(args, "--cursor-file", opts.CursorFile)
+	}
+	for _, unit := range opts.Units {
+		if unit == "" {
+			continue
+		}
+		args = append(args, "--unit", unit)
+	}
+
+	cmd := exec.CommandContext(ctx, "journalctl", args...)
+	logger.Debug("following journal", "cmd", cmd.String())
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return
+	} else if err = cmd.Start(); err != nil {
+		return
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxEntrySize)
+
+	for scanner.Scan() {
+		// we only decode enough of the entry to determine the subject, the rest is forwarded as is
+		var entry struct {
+			Unit       string `json:"_SYSTEMD_UNIT"`
+			Identifier string `json:"SYSLOG_IDENTIFIER"`
+		}
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			logger.Warn("failed to unmarshal journal entry", "error", err)
+			continue
+		}
+
+		unit := entry.Unit
+		if unit == "" {
+			unit = entry.Identifier
+		}
+
+		// copy the entry as the scanner will re-use its buffer
+		data := make([]byte, len(scanner.Bytes()))
+		copy(data, scanner.Bytes())
+
+		_, _ = writerFor(unit).Write(data)
+	}
+
+	if err = scanner.Err(); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return
+	}
+
+	return cmd.Wait()
+}
+
+func writerFor(unit string) *nnats.Writer {
+	subj := subject.AgentJournal(NKey, unit)
+	writer, ok := writers[subj]
+	if !ok {
+		writer = &nnats.Writer{
+			Conn:    Conn,
+			Subject: subj,
+			Headers: nats.Header{
+				nlog.HeaderFormat: []string{nlog.HeaderJournal},
+			},
+			Spool: Spool,
+		}
+		writers[subj] = writer
+	}
+	return writer
+}
+
+func closeWriters() {
+	for _, writer := range writers {
+		if err := writer.Close(); err != nil {
+			logger.Error("failed to close journal writer", "subject", writer.Subject, "error", err)
+		}
+	}
+}
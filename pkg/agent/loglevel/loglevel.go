@@ -0,0 +1,177 @@
+package loglevel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/numtide/nits/pkg/agent/util"
+	nnats "github.com/numtide/nits/pkg/nats"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+// MaxDuration limits how long a temporary change may last, so that an agent is not left logging verbosely.
+const MaxDuration = 24 * time.Hour
+
+var (
+	NKey string
+	Conn *nats.Conn
+
+	// configured is the level from local or remote configuration
+	configured = log.WarnLevel
+	// override is the temporary level, if any, which applies until it expires
+	override *log.Level
+	until    time.Time
+	timer    *time.Timer
+	// generation identifies the latest temporary change, so that an expired timer cannot revert a later one
+	generation uint64
+	lock       sync.Mutex
+
+	logger *log.Logger
+)
+
+func Init(ctx context.Context, level string) (err error) {
+	Conn = util.GetConn(ctx)
+	NKey = util.GetNKey(ctx)
+
+	logger = util.Logger("loglevel")
+
+	var parsed log.Level
+	if parsed, err = log.ParseLevel(level); err != nil {
+		return
+	}
+	SetConfigured(parsed)
+
+	var srv micro.Service
+	if srv, err = micro.AddService(Conn, micro.Config{
+		Name:        "AgentLogLevel",
+		Version:     "0.0.1",
+		Description: "Temporarily change the agent's log level.",
+	}); err != nil {
+		return
+	}
+
+	return srv.AddGroup(subject.AgentService(NKey, "AGENT")).AddEndpoint("LOGLEVEL", micro.HandlerFunc(onLogLevel))
+}
+
+// SetConfigured changes the level used when no temporary change is in effect.
+func SetConfigured(level log.Level) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	configured = level
+	if override == nil {
+		util.SetLogLevel(level)
+	}
+}
+
+func onLogLevel(req micro.Request) {
+	var request Request
+	if len(req.Data()) > 0 {
+		if err := json.Unmarshal(req.Data(), &request); err != nil {
+			_ = req.Error("400", fmt.Sprintf("Failed to unmarshal request: %s", err), nil)
+			return
+		}
+	}
+
+	switch {
+	case request.Reset:
+		logger.Info("log level reset", "to", reset().String())
+
+	case request.Level != "":
+		level, err := log.ParseLevel(request.Level)
+		if err != nil {
+			_ = req.Error("400", fmt.Sprintf("Invalid log level: %q", request.Level), nil)
+			return
+		} else if request.For <= 0 || request.For > MaxDuration {
+			_ = req.Error("400", fmt.Sprintf("Duration must be greater than zero and at most %v", MaxDuration), nil)
+			return
+		}
+
+		set(level, request.For)
+		logger.Info("log level changed", "to", level.String(), "for", request.For)
+	}
+
+	data, err := json.Marshal(current())
+	if err != nil {
+		_ = req.Error("500", fmt.Sprintf("Failed to marshal response: %s", err), nil)
+		return
+	}
+	if err = req.Respond(data); err != nil {
+		logger.Error("failed to respond", "error", err)
+	}
+}
+
+// set applies level for duration d, after which the configured level is restored.
+func set(level log.Level, d time.Duration) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if timer != nil {
+		timer.Stop()
+	}
+
+	generation++
+	current := generation
+
+	override = &level
+	until = time.Now().Add(d)
+	timer = time.AfterFunc(d, func() {
+		expire(current)
+	})
+
+	util.SetLogLevel(level)
+}
+
+// expire restores the configured level, unless the change of the given generation has since been replaced.
+func expire(g uint64) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if g != generation || override == nil {
+		return
+	}
+
+	timer = nil
+	override = nil
+	util.SetLogLevel(configured)
+
+	logger.Info("temporary log level expired", "to", configured.String())
+}
+
+// reset restores the configured level immediately, returning it.
+func reset() log.Level {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if timer != nil {
+		timer.Stop()
+		timer = nil
+	}
+
+	override = nil
+	util.SetLogLevel(configured)
+	return configured
+}
+
+func current() *Response {
+	lock.Lock()
+	defer lock.Unlock()
+
+	resp := &Response{Level: configured.String(), Configured: configured.String()}
+	if override != nil {
+		expiry := until.UTC()
+		resp.Level = override.String()
+		resp.Until = &expiry
+	}
+	return resp
+}
+
+func SetWithContext(ctx context.Context, conn *nats.EncodedConn, nkey string, req Request, resp *Response) error {
+	return nnats.RequestWithContext(ctx, conn, subject.AgentService(nkey, "AGENT.LOGLEVEL"), req, resp)
+}
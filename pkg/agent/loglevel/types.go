@@ -0,0 +1,20 @@
+package loglevel
+
+import "time"
+
+// Request changes the log level for a limited time. An empty request reports the current level without changing it.
+type Request struct {
+	Level string        `json:"level,omitempty"`
+	For   time.Duration `json:"for,omitempty"`
+	// Reset reverts to the configured level immediately.
+	Reset bool `json:"reset,omitempty"`
+}
+
+type Response struct {
+	// Level is the level currently in use.
+	Level string `json:"level"`
+	// Configured is the level which will be used once any temporary change expires.
+	Configured string `json:"configured"`
+	// Until is when a temporary change expires, if one is in effect.
+	Until *time.Time `json:"until,omitempty"`
+}
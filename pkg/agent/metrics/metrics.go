@@ -0,0 +1,207 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/pkg/agent/util"
+	"github.com/numtide/nits/pkg/subject"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+type Options struct {
+	Interval      time.Duration `env:"METRICS_INTERVAL" default:"30s" help:"How often to publish metrics. Publishing is disabled when zero."`
+	StoreInterval time.Duration `env:"METRICS_STORE_INTERVAL" default:"1h" help:"How often to measure the size of the nix store, which is expensive. Disabled when zero."`
+}
+
+var (
+	NKey string
+	Conn *nats.Conn
+
+	logger *log.Logger
+
+	// the last measurement of the nix store, which is refreshed less often than the other metrics
+	nixStore     *NixStore
+	nixStoreLock sync.RWMutex
+)
+
+func Init(ctx context.Context, opts *Options) (err error) {
+	Conn = util.GetConn(ctx)
+	NKey = util.GetNKey(ctx)
+
+	logger = util.Logger("metrics")
+
+	if opts.Interval <= 0 {
+		return errors.New("metrics interval must be greater than zero")
+	}
+
+	if opts.StoreInterval > 0 {
+		if _, err = exec.LookPath("nix"); err != nil {
+			return errors.Annotate(err, "nix could not be found")
+		}
+		go measureStore(ctx, opts.StoreInterval)
+	}
+
+	go publish(ctx, opts.Interval)
+
+	return
+}
+
+// intervalUpdates is used to change how often metrics are published whilst running.
+var intervalUpdates = make(chan time.Duration, 1)
+
+// UpdateInterval changes how often metrics are published. It has no effect if publishing is disabled.
+func UpdateInterval(interval time.Duration) {
+	for {
+		select {
+		case intervalUpdates <- interval:
+			return
+		default:
+			// discard an update which has yet to be applied in favour of this one
+			select {
+			case <-intervalUpdates:
+			default:
+			}
+		}
+	}
+}
+
+func publish(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case interval = <-intervalUpdates:
+			ticker.Reset(interval)
+		case <-ticker.C:
+			if !Conn.IsConnected() {
+				// metrics are only of interest whilst they are current, so we do not spool them
+				continue
+			}
+
+			b, err := json.Marshal(Collect())
+			if err != nil {
+				logger.Error("failed to marshal metrics", "error", err)
+			} else if err = Conn.Publish(subject.AgentMetrics(NKey), b); err != nil {
+				logger.Error("failed to publish metrics", "error", err)
+			}
+		}
+	}
+}
+
+// Collect takes a snapshot of the host's metrics. Failures to read an individual metric are logged and the metric is
+// omitted, rather than failing the whole snapshot.
+func Collect() *Metrics {
+	m := &Metrics{Timestamp: time.Now().UTC()}
+
+	if avg, err := load.Avg(); err != nil {
+		logger.Warn("failed to retrieve load", "error", err)
+	} else {
+		m.Load = &Load{Load1: avg.Load1, Load5: avg.Load5, Load15: avg.Load15}
+	}
+
+	if virtual, err := mem.VirtualMemory(); err != nil {
+		logger.Warn("failed to retrieve memory", "error", err)
+	} else {
+		m.Memory = &Memory{Total: virtual.Total, Used: virtual.Used, Available: virtual.Available}
+		if swap, err := mem.SwapMemory(); err == nil {
+			m.Memory.SwapTotal = swap.Total
+			m.Memory.SwapUsed = swap.Used
+		}
+	}
+
+	if partitions, err := disk.Partitions(false); err != nil {
+		logger.Warn("failed to retrieve disk partitions", "error", err)
+	} else {
+		for _, partition := range partitions {
+			if usage, err := disk.Usage(partition.Mountpoint); err == nil {
+				m.Disks = append(m.Disks, Disk{Mountpoint: usage.Path, Total: usage.Total, Used: usage.Used})
+			}
+		}
+	}
+
+	if counters, err := net.IOCounters(true); err != nil {
+		logger.Warn("failed to retrieve network counters", "error", err)
+	} else {
+		for _, c := range counters {
+			if c.Name == "lo" {
+				continue
+			}
+			m.Network = append(m.Network, Network{
+				Name:        c.Name,
+				BytesSent:   c.BytesSent,
+				BytesRecv:   c.BytesRecv,
+				PacketsSent: c.PacketsSent,
+				PacketsRecv: c.PacketsRecv,
+				Errors:      c.Errin + c.Errout,
+			})
+		}
+	}
+
+	nixStoreLock.RLock()
+	m.NixStore = nixStore
+	nixStoreLock.RUnlock()
+
+	return m
+}
+
+func measureStore(ctx context.Context, interval time.Duration) {
+	for {
+		if store, err := storeSize(ctx); err != nil {
+			logger.Warn("failed to measure nix store", "error", err)
+		} else {
+			nixStoreLock.Lock()
+			nixStore = store
+			nixStoreLock.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+type pathInfo struct {
+	NarSize uint64 `json:"narSize"`
+}
+
+func storeSize(ctx context.Context) (store *NixStore, err error) {
+	var b []byte
+	if b, err = exec.CommandContext(ctx, "nix", "path-info", "--all", "--json").Output(); err != nil {
+		return
+	}
+
+	// depending on the version of nix, the output is either a list or a map keyed by store path
+	var infos []pathInfo
+	if err = json.Unmarshal(b, &infos); err != nil {
+		var byPath map[string]*pathInfo
+		if err = json.Unmarshal(b, &byPath); err != nil {
+			return nil, errors.Annotate(err, "failed to parse nix path-info output")
+		}
+		for _, info := range byPath {
+			if info != nil {
+				infos = append(infos, *info)
+			}
+		}
+	}
+
+	store = &NixStore{Paths: len(infos)}
+	for _, info := range infos {
+		store.Size += info.NarSize
+	}
+	return
+}
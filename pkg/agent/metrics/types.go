@@ -0,0 +1,49 @@
+package metrics
+
+import "time"
+
+// Metrics is a compact snapshot of a host's utilisation, published periodically by each agent.
+type Metrics struct {
+	Timestamp time.Time `json:"ts"`
+	Load      *Load     `json:"load,omitempty"`
+	Memory    *Memory   `json:"mem,omitempty"`
+	Disks     []Disk    `json:"disks,omitempty"`
+	Network   []Network `json:"net,omitempty"`
+	NixStore  *NixStore `json:"nix,omitempty"`
+}
+
+type Load struct {
+	Load1  float64 `json:"1m"`
+	Load5  float64 `json:"5m"`
+	Load15 float64 `json:"15m"`
+}
+
+type Memory struct {
+	Total     uint64 `json:"total"`
+	Used      uint64 `json:"used"`
+	Available uint64 `json:"avail"`
+	SwapTotal uint64 `json:"swapTotal"`
+	SwapUsed  uint64 `json:"swapUsed"`
+}
+
+type Disk struct {
+	Mountpoint string `json:"mount"`
+	Total      uint64 `json:"total"`
+	Used       uint64 `json:"used"`
+}
+
+// Network contains the cumulative counters for an interface since boot.
+type Network struct {
+	Name        string `json:"name"`
+	BytesSent   uint64 `json:"tx"`
+	BytesRecv   uint64 `json:"rx"`
+	PacketsSent uint64 `json:"txPkts"`
+	PacketsRecv uint64 `json:"rxPkts"`
+	Errors      uint64 `json:"errs"`
+}
+
+type NixStore struct {
+	// Size is the sum of the nar size of every valid path in the store.
+	Size  uint64 `json:"size"`
+	Paths int    `json:"paths"`
+}
@@ -15,6 +15,8 @@ import (
 	"github.com/nats-io/nats.go/micro"
 	"github.com/nats-io/nuid"
 	"github.com/nix-community/go-nix/pkg/storepath"
+	"github.com/numtide/nits/pkg/agent/info"
+	"github.com/numtide/nits/pkg/agent/secrets"
 	nlog "github.com/numtide/nits/pkg/logging"
 	nnats "github.com/numtide/nits/pkg/nats"
 	"github.com/numtide/nits/pkg/nix"
@@ -36,11 +38,14 @@ var currentDeployId = atomic.Value{}
 type DeployRequest struct {
 	Action  DeployAction `json:"action"`
 	Closure string       `json:"closure"`
+	// IgnoreMaintenanceWindows allows a configuration to be activated outside the agent's maintenance windows.
+	IgnoreMaintenanceWindows bool `json:"ignore-maintenance-windows,omitempty"`
 }
 
 type DeployResponse struct {
-	Id   string `json:"id"`
-	Logs string `json:"logs"`
+	Id     string `json:"id"`
+	Logs   string `json:"logs"`
+	Output string `json:"output"`
 }
 
 type DeployResult struct {
@@ -64,8 +69,15 @@ func onDeploy(req micro.Request) {
 		return
 	}
 
+	// a dry run does not change the host, so it is allowed at any time
+	if request.Action != DryActivate && !request.IgnoreMaintenanceWindows && !inMaintenanceWindow(time.Now()) {
+		_ = req.Error("409", fmt.Sprintf("Outside of the maintenance windows: %s.", formatWindows()), nil)
+		return
+	}
+
 	id := nuid.Next()
 	logSubject := fmt.Sprintf("%s.NIXOS.DEPLOY.%s", subject.AgentLogs(NKey), id)
+	outputSubject := fmt.Sprintf("%s.NIXOS.DEPLOY.%s", subject.AgentOutput(NKey), id)
 
 	if !currentDeployId.CompareAndSwap("", id) {
 		_ = req.Error("417", "A deployment is in progress.", nil)
@@ -73,6 +85,8 @@ func onDeploy(req micro.Request) {
 	}
 
 	go func() {
+		var err error
+
 		currentDeployId.Store(id)
 		defer currentDeployId.Store("")
 
@@ -82,22 +96,25 @@ func onDeploy(req micro.Request) {
 			Headers: nats.Header{
 				nlog.HeaderFormat: []string{nlog.HeaderLogFmt},
 			},
+			Spool: Spool,
 		}
 
 		outWriter := &nnats.Writer{
 			Conn:    Conn,
-			Subject: logSubject + ".STDOUT",
+			Subject: outputSubject + ".STDOUT",
 			Headers: nats.Header{
 				nlog.HeaderFormat: []string{nlog.HeaderTerm},
 			},
+			Spool: Spool,
 		}
 
 		errWriter := &nnats.Writer{
 			Conn:    Conn,
-			Subject: logSubject + ".STDERR",
+			Subject: outputSubject + ".STDERR",
 			Headers: nats.Header{
 				nlog.HeaderFormat: []string{nlog.HeaderTerm},
 			},
+			Spool: Spool,
 		}
 
 		l := log.New(io.MultiWriter(os.Stdout, logWriter))
@@ -122,6 +139,27 @@ func onDeploy(req micro.Request) {
 
 		action := strcase.ToKebab(request.Action.String())
 
+		deployment := &info.Deployment{
+			Id:      id,
+			Action:  action,
+			Closure: closure.Absolute(),
+			Outcome: info.DeploymentInProgress,
+			Started: time.Now().UTC(),
+		}
+		recordDeployment(deployment)
+
+		defer func() {
+			now := time.Now().UTC()
+			deployment.Ended = &now
+			if err != nil {
+				deployment.Outcome = info.DeploymentFailure
+				deployment.Error = err.Error()
+			} else {
+				deployment.Outcome = info.DeploymentSuccess
+			}
+			recordDeployment(deployment)
+		}()
+
 		l.Info("starting deployment")
 
 		l.Info("building closure", "closure", closure)
@@ -130,12 +168,29 @@ func onDeploy(req micro.Request) {
 			return
 		}
 
+		// a dry run must leave the host untouched, so secrets are only written when the configuration is activated
+		activates := request.Action != DryActivate
+
+		// services in the new configuration may depend on secrets which were only recently added
+		if activates {
+			l.Info("refreshing secrets")
+			if err = secrets.Refresh(ctx); err != nil {
+				l.Error("failed to refresh secrets", "error", err)
+				return
+			}
+		}
+
 		l.Info("switching configuration", "action", action)
 		if err = nix.Switch(closure, action, ctx); err != nil {
 			l.Error("failed to switch configuration", "error", err)
 			return
 		}
 
+		// the new configuration may have created users and groups which secrets belong to
+		if activates {
+			secrets.FixOwners()
+		}
+
 		switch request.Action {
 		case Boot, Switch:
 			l.Info("setting system")
@@ -153,8 +208,9 @@ func onDeploy(req micro.Request) {
 	}()
 
 	response := DeployResponse{
-		Id:   id,
-		Logs: logSubject,
+		Id:     id,
+		Logs:   logSubject,
+		Output: outputSubject,
 	}
 
 	if err = req.RespondJSON(response); err != nil {
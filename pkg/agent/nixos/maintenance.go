@@ -0,0 +1,136 @@
+package nixos
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Window is a recurring period of the week during which deployments may activate a configuration. It is written as
+// an optional list of days followed by a range of times in the host's local time zone, e.g. "02:00-04:00" every day,
+// "Sat,Sun 02:00-06:00" or "Mon-Fri 22:00-02:00". A range which ends before it starts continues into the next day.
+type Window struct {
+	str   string
+	days  [7]bool
+	start time.Duration
+	end   time.Duration
+}
+
+func ParseWindow(str string) (w *Window, err error) {
+	w = &Window{str: str}
+
+	fields := strings.Fields(str)
+	switch len(fields) {
+	case 1:
+		for idx := range w.days {
+			w.days[idx] = true
+		}
+	case 2:
+		if err = w.parseDays(fields[0]); err != nil {
+			return nil, errors.Annotatef(err, "invalid maintenance window %q", str)
+		}
+	default:
+		return nil, errors.NotValidf("maintenance window %q", str)
+	}
+
+	from, to, ok := strings.Cut(fields[len(fields)-1], "-")
+	if !ok {
+		return nil, errors.Errorf("invalid maintenance window %q, expected a range of times e.g. 02:00-04:00", str)
+	} else if w.start, err = parseTimeOfDay(from); err != nil {
+		return nil, errors.Annotatef(err, "invalid maintenance window %q", str)
+	} else if w.end, err = parseTimeOfDay(to); err != nil {
+		return nil, errors.Annotatef(err, "invalid maintenance window %q", str)
+	} else if w.start == w.end {
+		return nil, errors.Errorf("invalid maintenance window %q, it must not start and end at the same time", str)
+	}
+
+	return w, nil
+}
+
+// parseDays parses a comma separated list of days or ranges of days, e.g. Mon-Fri,Sun.
+func (w *Window) parseDays(str string) error {
+	for _, term := range strings.Split(str, ",") {
+		from, to, isRange := strings.Cut(term, "-")
+
+		start, err := parseWeekday(from)
+		if err != nil {
+			return err
+		}
+
+		end := start
+		if isRange {
+			if end, err = parseWeekday(to); err != nil {
+				return err
+			}
+		}
+
+		// ranges may wrap around the end of the week e.g. Sat-Mon
+		for day := start; ; day = (day + 1) % 7 {
+			w.days[day] = true
+			if day == end {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func parseWeekday(str string) (int, error) {
+	for idx, day := range weekdays {
+		if strings.EqualFold(str, day) {
+			return idx, nil
+		}
+	}
+	return 0, errors.Errorf("invalid day %q, expected one of Mon, Tue, Wed, Thu, Fri, Sat or Sun", str)
+}
+
+func parseTimeOfDay(str string) (time.Duration, error) {
+	t, err := time.Parse("15:04", str)
+	if err != nil {
+		return 0, errors.Errorf("invalid time %q, expected HH:MM", str)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains returns true if t, in its own time zone, falls within the window.
+func (w *Window) Contains(t time.Time) bool {
+	day := int(t.Weekday())
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+
+	if w.start < w.end {
+		return w.days[day] && offset >= w.start && offset < w.end
+	}
+
+	// the window starts on one day and ends on the next
+	return (w.days[day] && offset >= w.start) || (w.days[(day+6)%7] && offset < w.end)
+}
+
+func (w *Window) String() string {
+	return w.str
+}
+
+// inMaintenanceWindow returns true if there are no maintenance windows, or t falls within one of them.
+func inMaintenanceWindow(t time.Time) bool {
+	if len(MaintenanceWindows) == 0 {
+		return true
+	}
+	for _, w := range MaintenanceWindows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatWindows lists the maintenance windows for use within an error message.
+func formatWindows() string {
+	strs := make([]string, len(MaintenanceWindows))
+	for idx, w := range MaintenanceWindows {
+		strs[idx] = fmt.Sprintf("%q", w.String())
+	}
+	return strings.Join(strs, ", ")
+}
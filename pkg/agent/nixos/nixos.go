@@ -7,21 +7,52 @@ import (
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/micro"
 	"github.com/numtide/nits/pkg/agent/util"
+	nnats "github.com/numtide/nits/pkg/nats"
 	"github.com/numtide/nits/pkg/subject"
 )
 
+type Options struct {
+	DeploymentFile     string   `env:"NIXOS_DEPLOYMENT_FILE" help:"File in which to record the outcome of the last deployment across restarts."`
+	MaintenanceWindows []string `env:"NIXOS_MAINTENANCE_WINDOWS" sep:";" help:"Times at which deployments may activate a configuration, in the host's local time and separated by ';' e.g. '02:00-04:00' or 'Sat,Sun 02:00-06:00;Mon-Fri 22:00-02:00'. Deployments are accepted at any time when empty."`
+}
+
+// Validate ensures every maintenance window can be parsed.
+func (o *Options) Validate() error {
+	for _, str := range o.MaintenanceWindows {
+		if _, err := ParseWindow(str); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 var (
-	NKey string
-	Conn *nats.Conn
+	NKey  string
+	Conn  *nats.Conn
+	Spool *nnats.Spool
+
+	DeploymentFile     string
+	MaintenanceWindows []*Window
 
 	logger *log.Logger
 )
 
-func Init(ctx context.Context) (err error) {
+func Init(ctx context.Context, opts *Options) (err error) {
+	DeploymentFile = opts.DeploymentFile
+
+	MaintenanceWindows = nil
+	for _, str := range opts.MaintenanceWindows {
+		var window *Window
+		if window, err = ParseWindow(str); err != nil {
+			return
+		}
+		MaintenanceWindows = append(MaintenanceWindows, window)
+	}
 	Conn = util.GetConn(ctx)
 	NKey = util.GetNKey(ctx)
+	Spool = util.GetSpool(ctx)
 
-	logger = log.Default().With("service", "nixos")
+	logger = util.Logger("nixos")
 
 	var srv micro.Service
 	if srv, err = micro.AddService(Conn, micro.Config{
@@ -36,5 +67,10 @@ func Init(ctx context.Context) (err error) {
 
 	currentDeployId.Store("")
 
+	if err = loadDeployment(); err != nil {
+		logger.Warn("failed to load last deployment", "error", err)
+		err = nil
+	}
+
 	return group.AddEndpoint("DEPLOY", micro.HandlerFunc(onDeploy))
 }
@@ -0,0 +1,109 @@
+package nixos
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/pkg/agent/info"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+// loadDeployment restores the last deployment from disk, so that it survives the agent being restarted.
+func loadDeployment() (err error) {
+	if DeploymentFile == "" {
+		return
+	}
+
+	var b []byte
+	if b, err = os.ReadFile(DeploymentFile); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return
+	}
+
+	var deployment info.Deployment
+	if err = json.Unmarshal(b, &deployment); err != nil {
+		return
+	}
+
+	if deployment.Outcome == info.DeploymentInProgress {
+		// the agent was restarted part way through, most likely by the deployment itself when switching, in which case
+		// we consider it successful if the system it was deploying is now current
+		if current, err := os.Readlink("/run/current-system"); err == nil && current == deployment.Closure {
+			deployment.Outcome = info.DeploymentSuccess
+		} else {
+			deployment.Outcome = info.DeploymentFailure
+			deployment.Error = "agent restarted during deployment"
+		}
+		now := time.Now().UTC()
+		deployment.Ended = &now
+
+		// persist the outcome and let others know the deployment has finished
+		recordDeployment(&deployment)
+		return nil
+	}
+
+	info.SetDeployment(&deployment)
+	return nil
+}
+
+// recordDeployment updates the last deployment, persisting it to disk if configured. Once a deployment has finished an
+// event is published, spooling it if we are disconnected, as is likely after switching configuration.
+func recordDeployment(deployment *info.Deployment) {
+	// copy to avoid racing with readers of the previous state
+	d := *deployment
+	info.SetDeployment(&d)
+
+	if d.Outcome != info.DeploymentInProgress {
+		publishDeployment(&d)
+	}
+
+	if DeploymentFile == "" {
+		return
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		logger.Error("failed to marshal deployment", "error", err)
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(DeploymentFile), 0o755); err != nil {
+		logger.Error("failed to create deployment state directory", "error", err)
+		return
+	}
+
+	// write to a temporary file and rename, so we never leave a partially written file behind
+	tmp := DeploymentFile + ".tmp"
+	if err = os.WriteFile(tmp, b, 0o644); err != nil {
+		logger.Error("failed to write deployment state", "error", err)
+	} else if err = os.Rename(tmp, DeploymentFile); err != nil {
+		logger.Error("failed to write deployment state", "error", err)
+	}
+}
+
+func publishDeployment(deployment *info.Deployment) {
+	b, err := json.Marshal(deployment)
+	if err != nil {
+		logger.Error("failed to marshal deployment event", "error", err)
+		return
+	}
+
+	msg := nats.NewMsg(subject.AgentDeploymentWithNKey(NKey))
+	msg.Data = b
+
+	if Conn.IsConnected() {
+		err = Conn.PublishMsg(msg)
+	} else if Spool != nil {
+		err = Spool.Append(msg)
+	} else {
+		err = nats.ErrConnectionClosed
+	}
+
+	if err != nil {
+		logger.Error("failed to publish deployment event", "error", err)
+	}
+}
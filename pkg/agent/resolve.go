@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/numtide/nits/pkg/agent/info"
+)
+
+// Resolve finds the agent matching query, which is checked in order against:
+//
+//   - an exact nkey;
+//   - an agent name, preferring the most recently seen should more than one agent share it;
+//   - an nkey prefix, which must match a single agent.
+func Resolve(agents []*info.Response, query string) (*info.Response, error) {
+	if query == "" {
+		return nil, errors.New("an agent name or nkey is required")
+	}
+
+	var (
+		byName   []*info.Response
+		byPrefix []*info.Response
+	)
+
+	for _, agent := range agents {
+		switch {
+		case agent.NKey == query:
+			return agent, nil
+		case agent.Name == query:
+			byName = append(byName, agent)
+		case strings.HasPrefix(agent.NKey, query):
+			byPrefix = append(byPrefix, agent)
+		}
+	}
+
+	if len(byName) > 0 {
+		resolved := byName[0]
+		for _, agent := range byName[1:] {
+			if agent.LastSeen.After(resolved.LastSeen) {
+				resolved = agent
+			}
+		}
+
+		if len(byName) > 1 {
+			var nkeys []string
+			for _, agent := range byName {
+				nkeys = append(nkeys, agent.NKey)
+			}
+			log.Warn("more than one agent shares this name, using the most recently seen; specify an nkey to choose another",
+				"name", query, "nkey", resolved.NKey, "candidates", nkeys,
+			)
+		}
+
+		return resolved, nil
+	}
+
+	switch len(byPrefix) {
+	case 0:
+		return nil, errors.NotFoundf("agent with name or nkey %s", query)
+	case 1:
+		return byPrefix[0], nil
+	default:
+		var nkeys []string
+		for _, agent := range byPrefix {
+			nkeys = append(nkeys, agent.NKey)
+		}
+		return nil, errors.Errorf("nkey prefix %s is ambiguous, it matches: %s", query, strings.Join(nkeys, ", "))
+	}
+}
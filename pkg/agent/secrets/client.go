@@ -0,0 +1,144 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	nnats "github.com/numtide/nits/pkg/nats"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+var nameRegex = regexp.MustCompile("^[A-Za-z0-9_-][A-Za-z0-9_.-]{0,127}$")
+
+// ValidateName ensures a secret name can be used both as part of a key and as a file name.
+func ValidateName(name string) error {
+	if !nameRegex.MatchString(name) {
+		return errors.NotValidf("secret name %q", name)
+	}
+	return nil
+}
+
+// Key returns the key under which the named secret for an agent is stored.
+func Key(nkey string, name string) string {
+	return nkey + "." + name
+}
+
+// Bucket returns the key value bucket in which secrets are stored.
+func Bucket(conn *nats.Conn) (kv nats.KeyValue, err error) {
+	var js nats.JetStreamContext
+	if js, err = conn.JetStream(); err != nil {
+		return
+	}
+	if kv, err = js.KeyValue(subject.AgentSecretsBucket); err != nil {
+		err = errors.Annotate(err, "failed to open agent secrets")
+	}
+	return
+}
+
+// Seal encrypts data for the agent with the given nkey using a fresh ephemeral key pair.
+func Seal(nkey string, data []byte) (secret *Secret, err error) {
+	var (
+		recipient string
+		sender    nkeys.KeyPair
+	)
+
+	if recipient, err = nnats.XKeyForNKey(nkey); err != nil {
+		return
+	} else if sender, err = nkeys.CreateCurveKeys(); err != nil {
+		return
+	}
+
+	defer sender.Wipe()
+
+	secret = &Secret{Updated: time.Now().UTC()}
+	if secret.Sender, err = sender.PublicKey(); err != nil {
+		return
+	} else if secret.Data, err = sender.Seal(data, recipient); err != nil {
+		return nil, errors.Annotate(err, "failed to seal secret")
+	}
+	return
+}
+
+// Put stores a sealed secret for the agent with the given nkey.
+func Put(conn *nats.Conn, nkey string, name string, secret *Secret) (err error) {
+	if err = ValidateName(name); err != nil {
+		return
+	}
+
+	var (
+		kv nats.KeyValue
+		b  []byte
+	)
+	if kv, err = Bucket(conn); err != nil {
+		return
+	} else if b, err = json.Marshal(secret); err != nil {
+		return
+	}
+	_, err = kv.Put(Key(nkey, name), b)
+	return
+}
+
+// Delete removes the named secret for the agent with the given nkey, including its history.
+func Delete(conn *nats.Conn, nkey string, name string) (err error) {
+	if err = ValidateName(name); err != nil {
+		return
+	}
+
+	var kv nats.KeyValue
+	if kv, err = Bucket(conn); err != nil {
+		return
+	} else if _, err = kv.Get(Key(nkey, name)); errors.Is(err, nats.ErrKeyNotFound) {
+		return errors.NotFoundf("secret %s", name)
+	} else if err != nil {
+		return
+	}
+	return kv.Purge(Key(nkey, name))
+}
+
+// List returns the secrets held for the agent with the given nkey, keyed by name.
+func List(ctx context.Context, conn *nats.Conn, nkey string) (secrets map[string]*Secret, err error) {
+	var kv nats.KeyValue
+	if kv, err = Bucket(conn); err != nil {
+		return
+	}
+	return list(ctx, kv, nkey)
+}
+
+func list(ctx context.Context, kv nats.KeyValue, nkey string) (secrets map[string]*Secret, err error) {
+	var watcher nats.KeyWatcher
+	if watcher, err = kv.Watch(nkey+".>", nats.Context(ctx), nats.IgnoreDeletes()); err != nil {
+		return
+	}
+
+	defer func() {
+		_ = watcher.Stop()
+	}()
+
+	secrets = make(map[string]*Secret)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case entry, ok := <-watcher.Updates():
+			if !ok {
+				return nil, errors.New("agent secrets watcher closed unexpectedly")
+			} else if entry == nil {
+				// we have received the current value for every key
+				return secrets, nil
+			}
+
+			var secret Secret
+			if err = json.Unmarshal(entry.Value(), &secret); err != nil {
+				return nil, errors.Annotatef(err, "failed to unmarshal secret %s", entry.Key())
+			}
+			secrets[strings.TrimPrefix(entry.Key(), nkey+".")] = &secret
+		}
+	}
+}
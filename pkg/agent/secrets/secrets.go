@@ -0,0 +1,310 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/numtide/nits/pkg/agent/util"
+	nnats "github.com/numtide/nits/pkg/nats"
+)
+
+const DefaultMode = os.FileMode(0o400)
+
+type Options struct {
+	Dir string `env:"SECRETS_DIR" default:"/run/nits/secrets" help:"Directory into which secrets are written."`
+}
+
+// Validate ensures the secrets directory is absolute.
+func (o *Options) Validate() error {
+	if !filepath.IsAbs(o.Dir) {
+		return errors.NotValidf("relative directory %q", o.Dir)
+	}
+	return nil
+}
+
+var (
+	NKey string
+	Conn *nats.Conn
+	Dir  string
+
+	// the curve key pair derived from the host key, used to open secrets
+	xkey nkeys.KeyPair
+
+	// serialises writes from the watcher and from Refresh
+	lock sync.Mutex
+	// secrets written as root because their owner or group did not exist yet, see FixOwners
+	pending = make(map[string]*Secret)
+
+	logger *log.Logger
+)
+
+func Init(ctx context.Context, opts *Options, hostKeyFile string) (err error) {
+	Conn = util.GetConn(ctx)
+	NKey = util.GetNKey(ctx)
+	Dir = opts.Dir
+
+	logger = util.Logger("secrets")
+
+	if hostKeyFile == "" {
+		// only agents authenticating with a host key have a key pair with which secrets can be opened
+		logger.Warn("no host key file configured, secrets will not be delivered")
+		return nil
+	}
+
+	if xkey, err = nnats.NewXKeyPair(hostKeyFile); err != nil {
+		return errors.Annotate(err, "failed to derive curve key pair from host key")
+	} else if err = os.MkdirAll(Dir, 0o711); err != nil {
+		return errors.Annotate(err, "failed to create secrets directory")
+	} else if err = os.Chmod(Dir, 0o711); err != nil {
+		return errors.Annotate(err, "failed to set secrets directory permissions")
+	}
+
+	go func() {
+		for {
+			if err := follow(ctx); err != nil {
+				logger.Error("failed to watch secrets, retrying", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Minute):
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Refresh synchronously writes every secret for this agent and removes those which no longer exist. It is called
+// before activating a new configuration, so that anything it depends on is in place. Secrets whose owner or group is
+// yet to be created by that configuration are written as root, see FixOwners.
+func Refresh(ctx context.Context) (err error) {
+	if xkey == nil {
+		return nil
+	}
+
+	// avoid holding up a deployment indefinitely should we be disconnected
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	var (
+		kv      nats.KeyValue
+		secrets map[string]*Secret
+	)
+
+	if kv, err = Bucket(Conn); err != nil {
+		return
+	} else if secrets, err = list(ctx, kv, NKey); err != nil {
+		return
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	for name, secret := range secrets {
+		if err = ValidateName(name); err != nil {
+			logger.Warn("skipping secret with an invalid name", "name", name, "error", err)
+			continue
+		} else if err = write(name, secret); err != nil {
+			return errors.Annotatef(err, "failed to write secret %s", name)
+		}
+	}
+	return prune(secrets)
+}
+
+// FixOwners applies the owner and group of any secret which was written before they existed. It is called after
+// activating a new configuration, which may have created them.
+func FixOwners() {
+	lock.Lock()
+	defer lock.Unlock()
+
+	for name, secret := range pending {
+		uid, gid, err := util.LookupOwner(secret.Owner, secret.Group)
+		if err != nil {
+			logger.Warn("owner of secret is still unknown", "name", name, "error", err)
+			continue
+		} else if err = os.Chown(filepath.Join(Dir, name), uid, gid); err != nil {
+			logger.Error("failed to set owner of secret", "name", name, "error", err)
+			continue
+		}
+		delete(pending, name)
+		logger.Info("secret owner set", "name", name, "owner", secret.Owner, "group", secret.Group)
+	}
+}
+
+// follow writes the current value of every secret, removes any which no longer exist, then applies updates as they
+// happen until ctx is cancelled or the watcher fails.
+func follow(ctx context.Context) (err error) {
+	var (
+		kv      nats.KeyValue
+		watcher nats.KeyWatcher
+	)
+
+	if kv, err = Bucket(Conn); err != nil {
+		return
+	} else if watcher, err = kv.Watch(NKey+".>", nats.Context(ctx)); err != nil {
+		return
+	}
+
+	defer func() {
+		_ = watcher.Stop()
+	}()
+
+	// secrets seen before the initial values have all been received, nil once they have
+	initial := make(map[string]*Secret)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case entry, ok := <-watcher.Updates():
+			if !ok {
+				return errors.New("agent secrets watcher closed unexpectedly")
+			} else if entry == nil {
+				lock.Lock()
+				err = prune(initial)
+				lock.Unlock()
+
+				if err != nil {
+					logger.Error("failed to remove stale secrets", "error", err)
+				}
+				initial = nil
+				continue
+			}
+
+			name := strings.TrimPrefix(entry.Key(), NKey+".")
+			if err = apply(name, entry); err != nil {
+				logger.Error("failed to apply secret", "name", name, "error", err)
+			} else if initial != nil && entry.Operation() == nats.KeyValuePut {
+				initial[name] = nil
+			}
+		}
+	}
+}
+
+func apply(name string, entry nats.KeyValueEntry) (err error) {
+	if err = ValidateName(name); err != nil {
+		return
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	switch entry.Operation() {
+	case nats.KeyValuePut:
+		var secret Secret
+		if err = json.Unmarshal(entry.Value(), &secret); err != nil {
+			return errors.Annotate(err, "failed to unmarshal secret")
+		} else if err = write(name, &secret); err != nil {
+			return
+		}
+		logger.Info("secret updated", "name", name)
+
+	default:
+		if err = os.Remove(filepath.Join(Dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		delete(pending, name)
+		logger.Info("secret removed", "name", name)
+	}
+
+	return nil
+}
+
+// write opens a secret and atomically replaces the file holding its plaintext.
+func write(name string, secret *Secret) (err error) {
+	var (
+		data     []byte
+		uid, gid int
+		f        *os.File
+	)
+
+	if data, err = xkey.Open(secret.Data, secret.Sender); err != nil {
+		return errors.Annotate(err, "failed to open secret")
+	}
+
+	defer func() {
+		for i := range data {
+			data[i] = 0
+		}
+	}()
+
+	if uid, gid, err = util.LookupOwner(secret.Owner, secret.Group); isUnknownOwner(err) {
+		// the owner may be created by the configuration which is about to be activated, so we fall back to root
+		logger.Warn("owner of secret is unknown, writing it as root until it exists", "name", name, "error", err)
+		uid, gid, err = 0, 0, nil
+		pending[name] = secret
+	} else if err != nil {
+		return
+	} else {
+		delete(pending, name)
+	}
+
+	mode := secret.Mode.Perm()
+	if mode == 0 {
+		mode = DefaultMode
+	}
+
+	// names may not begin with a '.', so the temporary file cannot collide with another secret
+	if f, err = os.CreateTemp(Dir, "."+name+".*"); err != nil {
+		return
+	}
+
+	defer func() {
+		_ = f.Close()
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	if _, err = f.Write(data); err != nil {
+		return
+	} else if err = f.Chmod(mode); err != nil {
+		return
+	} else if err = f.Chown(uid, gid); err != nil {
+		return
+	} else if err = f.Sync(); err != nil {
+		return
+	}
+	return os.Rename(f.Name(), filepath.Join(Dir, name))
+}
+
+// prune removes any file in the secrets directory which does not correspond to a current secret.
+func prune(current map[string]*Secret) (err error) {
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(Dir); err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if _, ok := current[entry.Name()]; ok || entry.IsDir() {
+			continue
+		}
+		if err = os.Remove(filepath.Join(Dir, entry.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		delete(pending, entry.Name())
+		logger.Info("stale secret removed", "name", entry.Name())
+	}
+
+	return nil
+}
+
+// isUnknownOwner returns true if err is due to a user or group which does not exist.
+func isUnknownOwner(err error) bool {
+	var (
+		unknownUser  user.UnknownUserError
+		unknownGroup user.UnknownGroupError
+	)
+	return errors.As(err, &unknownUser) || errors.As(err, &unknownGroup)
+}
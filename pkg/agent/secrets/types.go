@@ -0,0 +1,18 @@
+package secrets
+
+import (
+	"os"
+	"time"
+)
+
+// Secret is the envelope stored in the secrets bucket. Data is sealed with the curve key derived from the host key of
+// the agent it is intended for, so only that agent can open it.
+type Secret struct {
+	// Sender is the public curve key of the ephemeral key pair used to seal Data.
+	Sender  string      `json:"sender"`
+	Data    []byte      `json:"data"`
+	Owner   string      `json:"owner,omitempty"`
+	Group   string      `json:"group,omitempty"`
+	Mode    os.FileMode `json:"mode,omitempty"`
+	Updated time.Time   `json:"updated"`
+}
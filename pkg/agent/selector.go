@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/numtide/nits/pkg/agent/info"
+)
+
+type requirementOp int
+
+const (
+	opEquals requirementOp = iota
+	opNotEquals
+	opExists
+	opNotExists
+)
+
+type requirement struct {
+	key   string
+	op    requirementOp
+	value string
+}
+
+// Selector matches agents based on their labels. It is a comma separated list of requirements, all of which must be
+// satisfied, in the form:
+//
+//   - key=value or key==value, the label must be present with the given value;
+//   - key!=value, the label must be absent or have a different value;
+//   - key, the label must be present;
+//   - !key, the label must be absent.
+type Selector []requirement
+
+func ParseSelector(str string) (selector Selector, err error) {
+	for _, term := range strings.Split(str, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		var req requirement
+		if key, value, ok := strings.Cut(term, "!="); ok {
+			req = requirement{key: key, op: opNotEquals, value: value}
+		} else if key, value, ok = strings.Cut(term, "=="); ok {
+			req = requirement{key: key, op: opEquals, value: value}
+		} else if key, value, ok = strings.Cut(term, "="); ok {
+			req = requirement{key: key, op: opEquals, value: value}
+		} else if strings.HasPrefix(term, "!") {
+			req = requirement{key: term[1:], op: opNotExists}
+		} else {
+			req = requirement{key: term, op: opExists}
+		}
+
+		req.key = strings.TrimSpace(req.key)
+		req.value = strings.TrimSpace(req.value)
+
+		if err = ValidateLabelKey(req.key); err != nil {
+			return nil, errors.Annotatef(err, "invalid selector term '%s'", term)
+		}
+
+		selector = append(selector, req)
+	}
+
+	return
+}
+
+// Matches returns true if labels satisfies every requirement of the selector. An empty selector matches everything.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, req := range s {
+		value, ok := labels[req.key]
+		switch req.op {
+		case opEquals:
+			if !ok || value != req.value {
+				return false
+			}
+		case opNotEquals:
+			if ok && value == req.value {
+				return false
+			}
+		case opExists:
+			if !ok {
+				return false
+			}
+		case opNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ValidateLabelKey ensures key can be used unambiguously within a selector.
+func ValidateLabelKey(key string) error {
+	if key == "" {
+		return errors.New("label key cannot be empty")
+	} else if strings.ContainsAny(key, "=!, ") {
+		return errors.Errorf("label key '%s' cannot contain '=', '!', ',' or spaces", key)
+	}
+	return nil
+}
+
+// Select returns the agents which are members of group, if not empty, and whose labels match selector.
+func Select(agents []*info.Response, group string, selector Selector) (selected []*info.Response) {
+	for _, agent := range agents {
+		if group != "" && !slices.Contains(agent.Groups, group) {
+			continue
+		} else if !selector.Matches(agent.Labels) {
+			continue
+		}
+		selected = append(selected, agent)
+	}
+	return
+}
@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/numtide/nits/pkg/agent/config"
+	"github.com/numtide/nits/pkg/agent/info"
+	"github.com/numtide/nits/pkg/agent/loglevel"
+	"github.com/numtide/nits/pkg/agent/metrics"
+)
+
+// localSettings returns the settings which can be changed remotely, as configured locally.
+func localSettings() *config.Settings {
+	duration := func(d time.Duration) *config.Duration {
+		value := config.Duration(d)
+		return &value
+	}
+
+	settings := &config.Settings{
+		LogLevel:           LogLevel,
+		HeartbeatInterval:  duration(HeartbeatOptions.Interval),
+		HeartbeatKeepalive: duration(HeartbeatOptions.Keepalive),
+		HeartbeatJitter:    duration(HeartbeatOptions.Jitter),
+	}
+
+	if MetricsOptions != nil && MetricsOptions.Interval > 0 {
+		settings.MetricsInterval = duration(MetricsOptions.Interval)
+	}
+
+	return settings
+}
+
+// applySettings is called whenever the remote configuration changes the effective settings.
+func applySettings(settings *config.Settings) {
+	if level, err := log.ParseLevel(settings.LogLevel); err != nil {
+		log.Error("failed to parse log level", "level", settings.LogLevel, "error", err)
+	} else {
+		loglevel.SetConfigured(level)
+	}
+
+	info.UpdateHeartbeat(info.HeartbeatOptions{
+		Interval:  time.Duration(*settings.HeartbeatInterval),
+		Keepalive: time.Duration(*settings.HeartbeatKeepalive),
+		Jitter:    time.Duration(*settings.HeartbeatJitter),
+	})
+
+	// metrics can only be published more or less often, enabling them requires a change to the local configuration
+	if MetricsOptions != nil && MetricsOptions.Interval > 0 && settings.MetricsInterval != nil {
+		metrics.UpdateInterval(time.Duration(*settings.MetricsInterval))
+	}
+}
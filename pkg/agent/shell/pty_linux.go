@@ -0,0 +1,76 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/juju/errors"
+	"golang.org/x/sys/unix"
+)
+
+// openPty allocates a pseudo terminal, returning the controlling end and the terminal to be used by the shell.
+func openPty() (ptm *os.File, pts *os.File, err error) {
+	if ptm, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0); err != nil {
+		return nil, nil, errors.Annotate(err, "failed to open /dev/ptmx")
+	}
+
+	defer func() {
+		if err != nil {
+			_ = ptm.Close()
+		}
+	}()
+
+	var n uint32
+	if err = control(ptm, func(fd int) error {
+		return unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0)
+	}); err != nil {
+		return nil, nil, errors.Annotate(err, "failed to unlock pty")
+	} else if err = control(ptm, func(fd int) (err error) {
+		n, err = unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+		return
+	}); err != nil {
+		return nil, nil, errors.Annotate(err, "failed to determine pty number")
+	}
+
+	name := fmt.Sprintf("/dev/pts/%d", n)
+	if pts, err = os.OpenFile(name, os.O_RDWR|syscall.O_NOCTTY, 0); err != nil {
+		return nil, nil, errors.Annotatef(err, "failed to open %s", name)
+	}
+	return
+}
+
+func setSize(ptm *os.File, rows uint16, cols uint16) error {
+	if rows == 0 || cols == 0 {
+		return nil
+	}
+	return control(ptm, func(fd int) error {
+		return unix.IoctlSetWinsize(fd, unix.TIOCSWINSZ, &unix.Winsize{Row: rows, Col: cols})
+	})
+}
+
+// control runs fn with the file's descriptor. Unlike Fd, it leaves the file in non-blocking mode, so that reads can
+// still be interrupted by closing it.
+func control(f *os.File, fn func(fd int) error) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var fnErr error
+	if err = conn.Control(func(fd uintptr) {
+		fnErr = fn(int(fd))
+	}); err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// sysProcAttr starts the shell in a new session with the pty, which is its stdin, as the controlling terminal.
+func sysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setsid:  true,
+		Setctty: true,
+		Ctty:    0,
+	}
+}
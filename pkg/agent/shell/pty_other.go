@@ -0,0 +1,22 @@
+//go:build !linux
+
+package shell
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/juju/errors"
+)
+
+func openPty() (*os.File, *os.File, error) {
+	return nil, nil, errors.NotSupportedf("pseudo terminals on this platform")
+}
+
+func setSize(*os.File, uint16, uint16) error {
+	return errors.NotSupportedf("pseudo terminals on this platform")
+}
+
+func sysProcAttr() *syscall.SysProcAttr {
+	return nil
+}
@@ -0,0 +1,353 @@
+package shell
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/numtide/nits/pkg/agent/util"
+	nlog "github.com/numtide/nits/pkg/logging"
+	nnats "github.com/numtide/nits/pkg/nats"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+const (
+	// hangupDelay is how long the shell has to exit after being sent SIGHUP before it is killed.
+	hangupDelay = 5 * time.Second
+	// drainDelay is how long we wait for remaining output after the shell has exited.
+	drainDelay = time.Second
+	// clientBacklog is how many reads from the terminal may be waiting to be sent to the client, each of up to 32KiB.
+	clientBacklog = 128
+)
+
+var idRegex = regexp.MustCompile("^[A-Za-z0-9]{1,64}$")
+
+type Options struct {
+	Enable      bool          `env:"SHELL_ENABLE" help:"Allow interactive shell sessions to be opened remotely."`
+	Command     string        `env:"SHELL_COMMAND" default:"/bin/sh" help:"Shell to run for each session, started as a login shell."`
+	IdleTimeout time.Duration `env:"SHELL_IDLE_TIMEOUT" default:"30m" help:"Close a session if no input has been received for this long."`
+	Record      bool          `env:"SHELL_RECORD" default:"true" negatable:"" help:"Record the output of each session to the logs stream for auditing."`
+}
+
+var (
+	NKey  string
+	Conn  *nats.Conn
+	Spool *nnats.Spool
+
+	options *Options
+	logger  *log.Logger
+)
+
+func Init(ctx context.Context, opts *Options) (err error) {
+	Conn = util.GetConn(ctx)
+	NKey = util.GetNKey(ctx)
+	Spool = util.GetSpool(ctx)
+
+	options = opts
+	logger = util.Logger("shell")
+
+	if opts.IdleTimeout <= 0 {
+		return errors.New("shell idle timeout must be greater than zero")
+	}
+
+	var srv micro.Service
+	if srv, err = micro.AddService(Conn, micro.Config{
+		Name:        "AgentShell",
+		Version:     "0.0.1",
+		Description: "Interactive shell sessions.",
+	}); err != nil {
+		return
+	}
+
+	group := srv.AddGroup(subject.AgentService(NKey, "SHELL"))
+	return group.AddEndpoint("OPEN", micro.HandlerFunc(onOpen))
+}
+
+func onOpen(req micro.Request) {
+	var (
+		err     error
+		request Request
+	)
+
+	if err = json.Unmarshal(req.Data(), &request); err != nil {
+		_ = req.Error("400", fmt.Sprintf("Failed to unmarshal request: %s", err), nil)
+		return
+	} else if !idRegex.MatchString(request.Id) {
+		_ = req.Error("400", fmt.Sprintf("Invalid session id: %q", request.Id), nil)
+		return
+	}
+
+	s := &session{Request: request}
+	if err = s.start(); err != nil {
+		logger.Error("failed to start shell session", "id", request.Id, "error", err)
+		_ = req.Error("500", err.Error(), nil)
+		return
+	}
+
+	resp := Response{Id: request.Id}
+	if s.recorder != nil {
+		resp.Recording = s.recorder.Subject
+	}
+
+	if err = req.RespondJSON(resp); err != nil {
+		logger.Error("failed to respond", "error", err)
+	}
+
+	go s.run()
+}
+
+type session struct {
+	Request
+
+	cmd       *exec.Cmd
+	ptm       *os.File
+	pipe      *nnats.Pipe
+	resizeSub *nats.Subscription
+	recorder  *nnats.Writer
+}
+
+func (s *session) start() (err error) {
+	var pts *os.File
+	if s.ptm, pts, err = openPty(); err != nil {
+		return
+	}
+	// the shell holds its own reference to the terminal
+	defer func() {
+		_ = pts.Close()
+	}()
+
+	defer func() {
+		if err != nil {
+			s.close()
+		}
+	}()
+
+	if err = setSize(s.ptm, s.Rows, s.Cols); err != nil {
+		return errors.Annotate(err, "failed to set terminal size")
+	}
+
+	if s.pipe, err = nnats.NewPipe(Conn, AgentSubject(NKey, s.Id), ClientSubject(NKey, s.Id), nnats.DefaultPipeWindow); err != nil {
+		return
+	}
+
+	if s.resizeSub, err = Conn.Subscribe(ResizeSubject(NKey, s.Id), s.onResize); err != nil {
+		return
+	}
+
+	if options.Record {
+		s.recorder = &nnats.Writer{
+			Conn:    Conn,
+			Subject: fmt.Sprintf("%s.SHELL.%s", subject.AgentLogs(NKey), s.Id),
+			Headers: nats.Header{
+				nlog.HeaderFormat: []string{nlog.HeaderTerm},
+			},
+			Spool: Spool,
+		}
+	}
+
+	term := s.Term
+	if term == "" {
+		term = "xterm"
+	}
+
+	home, homeErr := os.UserHomeDir()
+	if homeErr != nil {
+		home = "/"
+	}
+
+	s.cmd = &exec.Cmd{
+		Path: options.Command,
+		// a leading dash indicates a login shell
+		Args:        []string{"-" + filepath.Base(options.Command)},
+		Dir:         home,
+		Env:         append(os.Environ(), "TERM="+term, "HOME="+home),
+		Stdin:       pts,
+		Stdout:      pts,
+		Stderr:      pts,
+		SysProcAttr: sysProcAttr(),
+	}
+
+	if err = s.cmd.Start(); err != nil {
+		return errors.Annotate(err, "failed to start shell")
+	}
+
+	logger.Info("shell session started", "id", s.Id, "pid", s.cmd.Process.Pid)
+	return
+}
+
+func (s *session) run() {
+	defer s.close()
+
+	// copy output until the terminal is closed
+	outputDone := make(chan struct{})
+	go func() {
+		defer close(outputDone)
+		s.copyOutput()
+	}()
+
+	// copy input until the client closes the pipe
+	go func() {
+		_, _ = io.Copy(s.ptm, s.pipe)
+	}()
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- s.cmd.Wait()
+	}()
+
+	ticker := time.NewTicker(min(options.IdleTimeout/4, time.Minute))
+	defer ticker.Stop()
+
+	var err error
+
+loop:
+	for {
+		select {
+		case err = <-exited:
+			break loop
+		case <-s.pipe.Done():
+			logger.Info("shell session closed by client", "id", s.Id)
+			err = s.hangup(exited)
+			break loop
+		case <-ticker.C:
+			if time.Since(s.pipe.LastActivity()) > options.IdleTimeout {
+				logger.Info("shell session idle, closing", "id", s.Id, "timeout", options.IdleTimeout)
+				err = s.hangup(exited)
+				break loop
+			}
+		}
+	}
+
+	// background processes may keep the terminal open, so we only wait a short while for the remaining output
+	select {
+	case <-outputDone:
+	case <-time.After(drainDelay):
+	}
+
+	exit := Exit{ExitCode: s.cmd.ProcessState.ExitCode()}
+	logger.Info("shell session finished", "id", s.Id, "exit_code", exit.ExitCode, "error", err)
+
+	if data, err := json.Marshal(exit); err != nil {
+		logger.Error("failed to marshal exit", "id", s.Id, "error", err)
+	} else if err = Conn.Publish(ExitSubject(NKey, s.Id), data); err != nil {
+		logger.Error("failed to publish exit", "id", s.Id, "error", err)
+	}
+}
+
+// copyOutput copies output from the terminal to the recording and the client until the terminal is closed. The
+// terminal is drained and recorded as fast as the shell produces output, with the client being sent what it can keep
+// up with. Should its backlog exceed clientBacklog, e.g. because it has stopped granting credit, further output is
+// discarded for the client only, so that the recording never depends on the client's flow control.
+func (s *session) copyOutput() {
+	var (
+		recordErr error
+		dropped   int
+	)
+
+	client := make(chan []byte, clientBacklog)
+	clientDone := make(chan struct{})
+
+	go func() {
+		defer close(clientDone)
+
+		var err error
+		for b := range client {
+			// keep draining once the client has gone away, so that the terminal is never blocked on it
+			if err == nil {
+				_, err = s.pipe.Write(b)
+			}
+		}
+	}()
+
+	defer func() {
+		close(client)
+		<-clientDone
+	}()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := s.ptm.Read(buf)
+		if n > 0 {
+			if s.recorder != nil && recordErr == nil {
+				if _, recordErr = s.recorder.Write(buf[:n]); recordErr != nil {
+					logger.Error("failed to record shell output", "id", s.Id, "error", recordErr)
+				}
+			}
+
+			b := make([]byte, n)
+			copy(b, buf[:n])
+
+			select {
+			case client <- b:
+				if dropped > 0 {
+					logger.Warn("client caught up with shell output", "id", s.Id, "dropped_bytes", dropped)
+					dropped = 0
+				}
+			default:
+				if dropped == 0 {
+					logger.Warn("client is not keeping up with shell output, discarding", "id", s.Id)
+				}
+				dropped += n
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// hangup signals the shell's process group that the terminal has gone away, killing it if it does not exit in time.
+func (s *session) hangup(exited chan error) error {
+	pid := s.cmd.Process.Pid
+	_ = syscall.Kill(-pid, syscall.SIGHUP)
+
+	select {
+	case err := <-exited:
+		return err
+	case <-time.After(hangupDelay):
+		_ = syscall.Kill(-pid, syscall.SIGKILL)
+		return <-exited
+	}
+}
+
+func (s *session) onResize(msg *nats.Msg) {
+	var resize Resize
+	if err := json.Unmarshal(msg.Data, &resize); err != nil {
+		logger.Warn("failed to unmarshal resize", "id", s.Id, "error", err)
+	} else if err = setSize(s.ptm, resize.Rows, resize.Cols); err != nil {
+		logger.Warn("failed to resize terminal", "id", s.Id, "error", err)
+	}
+}
+
+func (s *session) close() {
+	if s.resizeSub != nil {
+		_ = s.resizeSub.Unsubscribe()
+	}
+	if s.pipe != nil {
+		_ = s.pipe.Close()
+	}
+	if s.ptm != nil {
+		_ = s.ptm.Close()
+	}
+	if s.recorder != nil {
+		if err := s.recorder.Close(); err != nil {
+			logger.Error("failed to close recording", "id", s.Id, "error", err)
+		}
+	}
+}
+
+func OpenWithContext(ctx context.Context, conn *nats.EncodedConn, nkey string, req Request) (resp Response, err error) {
+	err = nnats.RequestWithContext(ctx, conn, subject.AgentService(nkey, "SHELL.OPEN"), req, &resp)
+	return
+}
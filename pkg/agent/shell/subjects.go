@@ -0,0 +1,23 @@
+package shell
+
+import "github.com/numtide/nits/pkg/subject"
+
+// AgentSubject is where the agent receives input and credit for the session.
+func AgentSubject(nkey string, id string) string {
+	return subject.AgentShell(nkey, id) + ".AGENT"
+}
+
+// ClientSubject is where the client receives output and credit for the session.
+func ClientSubject(nkey string, id string) string {
+	return subject.AgentShell(nkey, id) + ".CLIENT"
+}
+
+// ResizeSubject is where the client publishes changes to its terminal size.
+func ResizeSubject(nkey string, id string) string {
+	return subject.AgentShell(nkey, id) + ".RESIZE"
+}
+
+// ExitSubject is where the agent publishes the exit code of the shell once it has finished.
+func ExitSubject(nkey string, id string) string {
+	return subject.AgentShell(nkey, id) + ".EXIT"
+}
@@ -0,0 +1,28 @@
+package shell
+
+// EOF is the character a terminal in canonical mode treats as the end of input, i.e. ^D.
+const EOF = 0x04
+
+type Request struct {
+	// Id of the session, chosen by the client so that it can subscribe to the session's subjects before the shell
+	// starts producing output.
+	Id   string `json:"id"`
+	Term string `json:"term,omitempty"`
+	Rows uint16 `json:"rows,omitempty"`
+	Cols uint16 `json:"cols,omitempty"`
+}
+
+type Response struct {
+	Id string `json:"id"`
+	// Recording is the subject under which the session's output is recorded, empty if recording is disabled.
+	Recording string `json:"recording,omitempty"`
+}
+
+type Resize struct {
+	Rows uint16 `json:"rows"`
+	Cols uint16 `json:"cols"`
+}
+
+type Exit struct {
+	ExitCode int `json:"exit-code"`
+}
@@ -0,0 +1,136 @@
+package systemd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// statusProperties are the unit properties requested from systemctl show.
+var statusProperties = []string{
+	"Id", "Description", "LoadState", "ActiveState", "SubState", "UnitFileState", "FragmentPath",
+	"MainPID", "ExecMainStatus", "NRestarts", "MemoryCurrent", "ActiveEnterTimestamp",
+}
+
+// unitSuffixes are the unit types recognised by systemd.
+var unitSuffixes = []string{
+	".service", ".socket", ".device", ".mount", ".automount", ".swap",
+	".target", ".path", ".timer", ".slice", ".scope",
+}
+
+// normaliseUnit validates a unit name, appending .service if no unit type is given in the same way systemctl does.
+func normaliseUnit(unit string) (string, error) {
+	if unit == "" {
+		return "", errors.NotValidf("empty unit name")
+	} else if strings.HasPrefix(unit, "-") || strings.ContainsAny(unit, "/ \t\n") {
+		return "", errors.NotValidf("unit name %q", unit)
+	}
+
+	for _, suffix := range unitSuffixes {
+		if strings.HasSuffix(unit, suffix) {
+			return unit, nil
+		}
+	}
+	return unit + ".service", nil
+}
+
+// allowed returns true if the unit matches one of the allow-list patterns.
+func allowed(unit string) bool {
+	for _, pattern := range AllowedUnits {
+		if ok, _ := path.Match(pattern, unit); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func systemctl(ctx context.Context, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "systemctl", args...)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Annotatef(err, "systemctl %s: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func listUnits(ctx context.Context, req *ListRequest) (units []Unit, err error) {
+	args := []string{"list-units", "--output=json", "--no-pager"}
+	if req.All {
+		args = append(args, "--all")
+	}
+	if len(req.Patterns) > 0 {
+		args = append(args, "--")
+		args = append(args, req.Patterns...)
+	}
+
+	var out []byte
+	if out, err = systemctl(ctx, args...); err != nil {
+		return
+	}
+
+	if err = json.Unmarshal(out, &units); err != nil {
+		err = errors.Annotate(err, "failed to unmarshal unit list")
+	}
+	return
+}
+
+func unitStatus(ctx context.Context, unit string) (status *Status, err error) {
+	var out []byte
+	if out, err = systemctl(ctx, "show", "--no-pager", "--property="+strings.Join(statusProperties, ","), "--", unit); err != nil {
+		return
+	}
+
+	props := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if key, value, ok := strings.Cut(scanner.Text(), "="); ok {
+			props[key] = value
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+
+	status = &Status{
+		Name:          props["Id"],
+		Description:   props["Description"],
+		LoadState:     props["LoadState"],
+		ActiveState:   props["ActiveState"],
+		SubState:      props["SubState"],
+		UnitFileState: props["UnitFileState"],
+		FragmentPath:  props["FragmentPath"],
+		Controllable:  allowed(unit),
+	}
+
+	if status.LoadState == "not-found" {
+		return nil, errors.NotFoundf("unit %s", unit)
+	}
+
+	status.MainPID, _ = strconv.Atoi(props["MainPID"])
+	status.ExitStatus, _ = strconv.Atoi(props["ExecMainStatus"])
+	status.Restarts, _ = strconv.Atoi(props["NRestarts"])
+
+	// memory accounting may be disabled, in which case the value is [not set] or the max uint64
+	if memory, err := strconv.ParseUint(props["MemoryCurrent"], 10, 64); err == nil && memory != ^uint64(0) {
+		status.MemoryCurrent = memory
+	}
+
+	// e.g. Mon 2024-01-08 10:15:42 UTC, or empty if the unit has never been active
+	if since, err := time.Parse("Mon 2006-01-02 15:04:05 MST", props["ActiveEnterTimestamp"]); err == nil {
+		status.ActiveSince = &since
+	}
+
+	return
+}
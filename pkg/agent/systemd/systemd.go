@@ -0,0 +1,205 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/numtide/nits/pkg/agent/util"
+	nnats "github.com/numtide/nits/pkg/nats"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+// commandTimeout bounds how long we wait for systemctl, a start or restart waits for the unit to become active.
+const commandTimeout = 2 * time.Minute
+
+type Options struct {
+	AllowedUnits []string `env:"SYSTEMD_ALLOWED_UNITS" help:"Glob patterns for the units which may be started, stopped or restarted remotely. No units may be controlled when empty."`
+}
+
+// Validate ensures every allowed unit is a valid glob pattern.
+func (o *Options) Validate() error {
+	for _, pattern := range o.AllowedUnits {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.NotValidf("allowed unit pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+var (
+	NKey string
+	Conn *nats.Conn
+
+	AllowedUnits []string
+
+	logger *log.Logger
+)
+
+func Init(ctx context.Context, opts *Options) (err error) {
+	Conn = util.GetConn(ctx)
+	NKey = util.GetNKey(ctx)
+	AllowedUnits = opts.AllowedUnits
+
+	logger = util.Logger("systemd")
+
+	if _, err = exec.LookPath("systemctl"); err != nil {
+		// not every host runs systemd, so this is not fatal
+		logger.Warn("systemctl could not be found, systemd service disabled")
+		return nil
+	}
+
+	var srv micro.Service
+	if srv, err = micro.AddService(Conn, micro.Config{
+		Name:        "AgentSystemd",
+		Version:     "0.0.1",
+		Description: "Inspect and control systemd units.",
+	}); err != nil {
+		return
+	}
+
+	group := srv.AddGroup(subject.AgentService(NKey, "SYSTEMD"))
+
+	if err = group.AddEndpoint("LIST", micro.HandlerFunc(onList)); err != nil {
+		return
+	} else if err = group.AddEndpoint("STATUS", micro.HandlerFunc(onStatus)); err != nil {
+		return
+	}
+	return group.AddEndpoint("CONTROL", micro.HandlerFunc(onControl))
+}
+
+func onList(req micro.Request) {
+	var request ListRequest
+	if !unmarshal(req, &request) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	units, err := listUnits(ctx, &request)
+	if err != nil {
+		_ = req.Error("500", err.Error(), nil)
+		return
+	} else if units == nil {
+		units = []Unit{}
+	}
+
+	respond(req, &ListResponse{Units: units})
+}
+
+func onStatus(req micro.Request) {
+	var (
+		err     error
+		request StatusRequest
+		status  *Status
+	)
+
+	if !unmarshal(req, &request) {
+		return
+	} else if request.Unit, err = normaliseUnit(request.Unit); err != nil {
+		_ = req.Error("400", err.Error(), nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	if status, err = unitStatus(ctx, request.Unit); errors.Is(err, errors.NotFound) {
+		_ = req.Error("404", err.Error(), nil)
+		return
+	} else if err != nil {
+		_ = req.Error("500", err.Error(), nil)
+		return
+	}
+
+	respond(req, status)
+}
+
+func onControl(req micro.Request) {
+	var (
+		err     error
+		request ControlRequest
+		status  *Status
+	)
+
+	if !unmarshal(req, &request) {
+		return
+	} else if request.Unit, err = normaliseUnit(request.Unit); err != nil {
+		_ = req.Error("400", err.Error(), nil)
+		return
+	}
+
+	switch request.Action {
+	case Start, Stop, Restart:
+	default:
+		_ = req.Error("400", fmt.Sprintf("Unsupported action: %q", request.Action), nil)
+		return
+	}
+
+	if !allowed(request.Unit) {
+		logger.Warn("refused to control unit which is not allowed", "unit", request.Unit, "action", request.Action)
+		_ = req.Error("403", fmt.Sprintf("Unit %s is not in the allow-list", request.Unit), nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	logger.Info("controlling unit", "unit", request.Unit, "action", request.Action)
+
+	if _, err = systemctl(ctx, string(request.Action), "--", request.Unit); err != nil {
+		logger.Error("failed to control unit", "unit", request.Unit, "action", request.Action, "error", err)
+		_ = req.Error("500", err.Error(), nil)
+		return
+	}
+
+	if status, err = unitStatus(ctx, request.Unit); err != nil {
+		_ = req.Error("500", err.Error(), nil)
+		return
+	}
+
+	respond(req, status)
+}
+
+func unmarshal(req micro.Request, v any) bool {
+	if len(req.Data()) == 0 {
+		// we accept empty request data as a default request
+		return true
+	}
+	if err := json.Unmarshal(req.Data(), v); err != nil {
+		_ = req.Error("400", fmt.Sprintf("Failed to unmarshal request: %s", err), nil)
+		return false
+	}
+	return true
+}
+
+func respond(req micro.Request, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		_ = req.Error("500", fmt.Sprintf("Failed to marshal response: %s", err), nil)
+		return
+	}
+	if err = req.Respond(data); err != nil {
+		logger.Error("failed to respond", "error", err)
+	}
+}
+
+func ListWithContext(ctx context.Context, conn *nats.EncodedConn, nkey string, req ListRequest, resp *ListResponse) error {
+	return nnats.RequestWithContext(ctx, conn, subject.AgentService(nkey, "SYSTEMD.LIST"), req, resp)
+}
+
+func StatusWithContext(ctx context.Context, conn *nats.EncodedConn, nkey string, req StatusRequest, resp *Status) error {
+	return nnats.RequestWithContext(ctx, conn, subject.AgentService(nkey, "SYSTEMD.STATUS"), req, resp)
+}
+
+func ControlWithContext(ctx context.Context, conn *nats.EncodedConn, nkey string, req ControlRequest, resp *Status) error {
+	return nnats.RequestWithContext(ctx, conn, subject.AgentService(nkey, "SYSTEMD.CONTROL"), req, resp)
+}
@@ -0,0 +1,58 @@
+package systemd
+
+import "time"
+
+// Unit is the summary of a unit, as returned by systemctl list-units.
+type Unit struct {
+	Name        string `json:"unit"`
+	Load        string `json:"load"`
+	Active      string `json:"active"`
+	Sub         string `json:"sub"`
+	Description string `json:"description"`
+}
+
+type ListRequest struct {
+	// Patterns limits the units returned to those matching one of the glob patterns. All units are returned when empty.
+	Patterns []string `json:"patterns,omitempty"`
+	// All includes units which are inactive or have not been loaded.
+	All bool `json:"all,omitempty"`
+}
+
+type ListResponse struct {
+	Units []Unit `json:"units"`
+}
+
+type StatusRequest struct {
+	Unit string `json:"unit"`
+}
+
+// Status is the detailed state of a single unit.
+type Status struct {
+	Name          string     `json:"name"`
+	Description   string     `json:"description"`
+	LoadState     string     `json:"load-state"`
+	ActiveState   string     `json:"active-state"`
+	SubState      string     `json:"sub-state"`
+	UnitFileState string     `json:"unit-file-state,omitempty"`
+	FragmentPath  string     `json:"fragment-path,omitempty"`
+	MainPID       int        `json:"main-pid,omitempty"`
+	ExitStatus    int        `json:"exit-status"`
+	Restarts      int        `json:"restarts"`
+	MemoryCurrent uint64     `json:"memory-current,omitempty"`
+	ActiveSince   *time.Time `json:"active-since,omitempty"`
+	// Controllable indicates whether the unit may be started, stopped or restarted through the agent.
+	Controllable bool `json:"controllable"`
+}
+
+type ControlAction string
+
+const (
+	Start   ControlAction = "start"
+	Stop    ControlAction = "stop"
+	Restart ControlAction = "restart"
+)
+
+type ControlRequest struct {
+	Action ControlAction `json:"action"`
+	Unit   string        `json:"unit"`
+}
@@ -6,12 +6,14 @@ import (
 	"github.com/nats-io/jwt/v2"
 
 	"github.com/nats-io/nats.go"
+	nnats "github.com/numtide/nits/pkg/nats"
 )
 
 const (
 	ConnKey   = "conn"
 	NKeyKey   = "nkey"
 	ClaimsKey = "claims"
+	SpoolKey  = "spool"
 )
 
 func SetClaims(ctx context.Context, claims *jwt.UserClaims) context.Context {
@@ -37,3 +39,13 @@ func SetNKey(ctx context.Context, nkey string) context.Context {
 func GetNKey(ctx context.Context) string {
 	return ctx.Value(NKeyKey).(string)
 }
+
+func SetSpool(ctx context.Context, spool *nnats.Spool) context.Context {
+	return context.WithValue(ctx, SpoolKey, spool)
+}
+
+// GetSpool returns the spool for buffering messages whilst disconnected, or nil if spooling has not been enabled.
+func GetSpool(ctx context.Context) *nnats.Spool {
+	spool, _ := ctx.Value(SpoolKey).(*nnats.Spool)
+	return spool
+}
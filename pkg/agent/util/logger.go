@@ -0,0 +1,34 @@
+package util
+
+import (
+	"sync"
+
+	"github.com/charmbracelet/log"
+)
+
+var (
+	loggers     []*log.Logger
+	loggersLock sync.Mutex
+)
+
+// Logger returns a child of the default logger for the named service. Child loggers copy the level of their parent
+// when created, so we track them in order for SetLogLevel to apply to every service.
+func Logger(service string) *log.Logger {
+	loggersLock.Lock()
+	defer loggersLock.Unlock()
+
+	logger := log.Default().With("service", service)
+	loggers = append(loggers, logger)
+	return logger
+}
+
+// SetLogLevel changes the level of the default logger and every service logger.
+func SetLogLevel(level log.Level) {
+	loggersLock.Lock()
+	defer loggersLock.Unlock()
+
+	log.SetLevel(level)
+	for _, logger := range loggers {
+		logger.SetLevel(level)
+	}
+}
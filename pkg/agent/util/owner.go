@@ -0,0 +1,31 @@
+package util
+
+import (
+	"os/user"
+	"strconv"
+)
+
+// LookupOwner resolves user and group names into ids, returning -1 for those not specified.
+func LookupOwner(owner string, group string) (uid int, gid int, err error) {
+	uid, gid = -1, -1
+
+	if owner != "" {
+		var u *user.User
+		if u, err = user.Lookup(owner); err != nil {
+			return
+		} else if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return
+		}
+	}
+
+	if group != "" {
+		var g *user.Group
+		if g, err = user.LookupGroup(group); err != nil {
+			return
+		} else if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/pkg/agent/info"
+)
+
+type EventType int
+
+const (
+	// EventJoin is emitted when an agent comes online.
+	EventJoin EventType = iota
+	// EventLeave is emitted when an agent disconnects gracefully, or has not been seen within the StaleAfter.
+	EventLeave
+	// EventUpdate is emitted when an online agent publishes a heartbeat.
+	EventUpdate
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventJoin:
+		return "join"
+	case EventLeave:
+		return "leave"
+	case EventUpdate:
+		return "update"
+	default:
+		return "unknown"
+	}
+}
+
+type Event struct {
+	Type  EventType
+	Agent *info.Response
+}
+
+// Watch follows the agent registry, emitting an event whenever an agent joins, leaves or updates its registration.
+// Agents which are online when the watch begins are emitted as joins. The returned channel is closed when ctx is
+// cancelled or the underlying watcher stops.
+func Watch(ctx context.Context, conn *nats.Conn) (<-chan Event, error) {
+	kv, err := Registry(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := kv.WatchAll(nats.Context(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event, 64)
+
+	go func() {
+		defer close(events)
+		defer func() {
+			_ = watcher.Stop()
+		}()
+
+		// online agents, keyed by nkey
+		online := make(map[string]*info.Response)
+
+		emit := func(eventType EventType, agent *info.Response) bool {
+			select {
+			case events <- Event{Type: eventType, Agent: agent}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		ticker := time.NewTicker(StaleAfter / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-ticker.C:
+				// expire agents we have not heard from
+				for nkey, agent := range online {
+					if time.Since(agent.LastSeen) > StaleAfter {
+						delete(online, nkey)
+						agent.Online = false
+						if !emit(EventLeave, agent) {
+							return
+						}
+					}
+				}
+
+			case entry, ok := <-watcher.Updates():
+				if !ok {
+					return
+				} else if entry == nil {
+					// marker indicating the initial values have been delivered
+					continue
+				}
+
+				prev, wasOnline := online[entry.Key()]
+
+				if entry.Operation() != nats.KeyValuePut {
+					// the registration was deleted or purged
+					delete(online, entry.Key())
+					if wasOnline {
+						prev.Online = false
+						if !emit(EventLeave, prev) {
+							return
+						}
+					}
+					continue
+				}
+
+				agent, err := UnmarshalRegistration(entry)
+				if err != nil {
+					log.Error("failed to unmarshal agent info", "key", entry.Key(), "error", err)
+					continue
+				}
+
+				var eventType EventType
+				switch {
+				case agent.Online && wasOnline:
+					eventType = EventUpdate
+				case agent.Online:
+					eventType = EventJoin
+				case wasOnline:
+					eventType = EventLeave
+				default:
+					// an agent which is offline and remains so
+					continue
+				}
+
+				if agent.Online {
+					online[entry.Key()] = agent
+				} else {
+					delete(online, entry.Key())
+				}
+
+				if !emit(eventType, agent) {
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
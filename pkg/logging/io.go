@@ -11,40 +11,67 @@ import (
 const (
 	ErrUnexpectedFormat = errors.ConstError("unexpected format")
 
-	HeaderFormat = "Fmt"
-	HeaderLogFmt = "LogFmt"
-	HeaderTerm   = "Term"
+	HeaderFormat  = "Fmt"
+	HeaderLogFmt  = "LogFmt"
+	HeaderTerm    = "Term"
+	HeaderJournal = "Journal"
 )
 
+// RecordReader reads records from either a single subscription, or from a channel into which several subscriptions
+// are delivering messages.
 type RecordReader struct {
 	Sub     *nats.Subscription
+	Msgs    <-chan *nats.Msg
 	Context context.Context
 }
 
+func (r *RecordReader) next() (msg *nats.Msg, err error) {
+	if r.Msgs == nil {
+		return r.Sub.NextMsgWithContext(r.Context)
+	}
+
+	select {
+	case <-r.Context.Done():
+		return nil, r.Context.Err()
+	case msg = <-r.Msgs:
+		return
+	}
+}
+
 func (r *RecordReader) Read() (record Record, err error) {
 	var (
 		msg   *nats.Msg
 		isEOS bool
 	)
-	if msg, err = r.Sub.NextMsgWithContext(r.Context); err != nil {
+	if msg, err = r.next(); err != nil {
 		return
 	} else if isEOS, err = nnats.IsEndOfStream(msg); err != nil {
 		return
 	} else if isEOS {
-		return nil, nnats.EndOfStreamErr{Subject: r.Sub.Subject}
+		return nil, nnats.EndOfStreamErr{Subject: msg.Subject}
 	}
 
+	return UnmarshalRecord(r.Context, msg)
+}
+
+// UnmarshalRecord decodes msg into the appropriate record type based on its format header.
+func UnmarshalRecord(ctx context.Context, msg *nats.Msg) (record Record, err error) {
 	switch msg.Header.Get(HeaderFormat) {
 	case HeaderTerm:
 		tRecord := &TerminalRecord{}
-		if err = UnmarshalTerminalRecord(r.Context, msg, tRecord); err == nil {
+		if err = UnmarshalTerminalRecord(ctx, msg, tRecord); err == nil {
 			record = tRecord
 		}
 	case HeaderLogFmt:
 		lfRecord := &LogFmtRecord{}
-		if err = UnmarshalLogFmtRecord(r.Context, msg, lfRecord); err == nil {
+		if err = UnmarshalLogFmtRecord(ctx, msg, lfRecord); err == nil {
 			record = lfRecord
 		}
+	case HeaderJournal:
+		jRecord := &JournalRecord{}
+		if err = UnmarshalJournalRecord(ctx, msg, jRecord); err == nil {
+			record = jRecord
+		}
 	default:
 		err = ErrUnexpectedFormat
 	}
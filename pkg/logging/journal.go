@@ -0,0 +1,190 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/numtide/nits/pkg/agent/info"
+	"github.com/numtide/nits/pkg/subject"
+)
+
+// journalMetaFields are the journal fields which are included when rendering a record, in addition to the message.
+var journalMetaFields = []string{"SYSLOG_IDENTIFIER", "_PID", "_COMM"}
+
+type JournalRecord struct {
+	Priority int
+	Unit     string
+	Text     string
+	Meta     map[string]string
+
+	Timestamp time.Time
+
+	msg       *nats.Msg
+	agentInfo *info.Response
+}
+
+func (j *JournalRecord) Type() RecordType {
+	return RecordJournal
+}
+
+func (j *JournalRecord) Msg() *nats.Msg {
+	return j.msg
+}
+
+// Level maps the syslog priority of the record to the closest log level.
+func (j *JournalRecord) Level() log.Level {
+	switch {
+	case j.Priority <= 2:
+		return log.FatalLevel
+	case j.Priority == 3:
+		return log.ErrorLevel
+	case j.Priority == 4:
+		return log.WarnLevel
+	case j.Priority <= 6:
+		return log.InfoLevel
+	default:
+		return log.DebugLevel
+	}
+}
+
+func (j *JournalRecord) Write(w io.Writer) (n int, err error) {
+	b := bytes.NewBuffer(nil)
+
+	styles := log.DefaultStyles()
+
+	b.WriteString(styles.Timestamp.Render(j.Timestamp.Format(time.RFC3339)))
+	b.WriteByte(' ')
+	b.WriteString(levelStyle(j.Level()).Render(j.Level().String()))
+	b.WriteByte(' ')
+
+	prefix := recordPrefix(j.agentInfo, j.msg.Subject)
+
+	b.WriteString(styles.Prefix.Render(prefix))
+
+	b.WriteByte(' ')
+	b.WriteString(styles.Message.Render(j.Text))
+	b.WriteByte(' ')
+
+	if j.Unit != "" {
+		b.WriteString(styles.Key.Render("unit"))
+		b.WriteByte('=')
+		b.WriteString(styles.Value.Render(j.Unit))
+		b.WriteByte(' ')
+	}
+
+	for _, k := range journalMetaFields {
+		if v, ok := j.Meta[k]; ok {
+			b.WriteString(styles.Key.Render(strings.ToLower(strings.TrimPrefix(k, "_"))))
+			b.WriteByte('=')
+			b.WriteString(styles.Value.Render(v))
+			b.WriteByte(' ')
+		}
+	}
+
+	b.WriteByte('\n')
+	return w.Write(b.Bytes())
+}
+
+func (j *JournalRecord) Entry() (entry Entry, err error) {
+	entry = newEntry(j.agentInfo, j.msg)
+	entry.Time = j.Timestamp
+	entry.Level = j.Level().String()
+	entry.Message = j.Text
+	entry.Fields = make(map[string]string, len(j.Meta)+1)
+	for k, v := range j.Meta {
+		entry.Fields[k] = v
+	}
+	if j.Unit != "" {
+		entry.Fields["unit"] = j.Unit
+	}
+	return
+}
+
+func UnmarshalJournalRecord(ctx context.Context, msg *nats.Msg, record *JournalRecord) (err error) {
+	if msg == nil {
+		return errors.New("msg cannot be nil")
+	} else if record == nil {
+		return errors.New("record cannot be nil")
+	} else if msg.Header.Get(HeaderFormat) != HeaderJournal {
+		return ErrUnexpectedFormat
+	}
+
+	record.msg = msg
+	record.Meta = make(map[string]string)
+
+	// look up agent info based on the subject
+	byNKey := GetAgentsByNKey(ctx)
+	nkey := subject.AgentNKeyForSubject(msg.Subject)
+
+	agentInfo, ok := byNKey[nkey]
+	if ok {
+		record.agentInfo = agentInfo
+	}
+
+	// entries are in the format produced by journalctl -o json
+	var entry map[string]json.RawMessage
+	if err = json.Unmarshal(msg.Data, &entry); err != nil {
+		return errors.Annotate(err, "failed to unmarshal journal entry")
+	}
+
+	for key, raw := range entry {
+		value := journalFieldValue(raw)
+		switch key {
+		case "MESSAGE":
+			record.Text = value
+		case "PRIORITY":
+			if record.Priority, err = strconv.Atoi(value); err != nil {
+				return errors.Annotate(err, "failed to parse journal priority")
+			}
+		case "_SYSTEMD_UNIT":
+			record.Unit = value
+		case "__REALTIME_TIMESTAMP":
+			var micros int64
+			if micros, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return errors.Annotate(err, "failed to parse journal timestamp")
+			}
+			record.Timestamp = time.UnixMicro(micros)
+		default:
+			record.Meta[key] = value
+		}
+	}
+
+	return
+}
+
+// journalFieldValue decodes a journal field value. journalctl outputs fields as a string, as an array of bytes when the
+// value is not valid utf-8, or as an array when a field has been set more than once.
+func journalFieldValue(raw json.RawMessage) string {
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return str
+	}
+
+	var data []byte
+	var ints []int
+	if err := json.Unmarshal(raw, &ints); err == nil {
+		for _, i := range ints {
+			data = append(data, byte(i))
+		}
+		return string(data)
+	}
+
+	var values []json.RawMessage
+	if err := json.Unmarshal(raw, &values); err == nil {
+		var result []string
+		for _, v := range values {
+			result = append(result, journalFieldValue(v))
+		}
+		return strings.Join(result, " ")
+	}
+
+	return string(raw)
+}
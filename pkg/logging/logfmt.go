@@ -3,9 +3,7 @@ package logging
 import (
 	"bytes"
 	"context"
-	"fmt"
-	"os"
-	"strings"
+	"io"
 	"time"
 
 	"github.com/numtide/nits/pkg/subject"
@@ -37,7 +35,7 @@ func (r *LogFmtRecord) Msg() *nats.Msg {
 	return r.msg
 }
 
-func (r *LogFmtRecord) Write(file *os.File) (n int, err error) {
+func (r *LogFmtRecord) Write(w io.Writer) (n int, err error) {
 	b := bytes.NewBuffer(nil)
 
 	// todo handle errors
@@ -49,10 +47,7 @@ func (r *LogFmtRecord) Write(file *os.File) (n int, err error) {
 	b.WriteString(levelStyle(r.Level).Render(r.Level.String()))
 	b.WriteByte(' ')
 
-	prefix := r.msg.Subject
-	if r.agentInfo != nil {
-		prefix = fmt.Sprintf("%s | %s", r.agentInfo.Name, strings.TrimPrefix(r.msg.Subject, subject.AgentLogs(r.agentInfo.NKey)+"."))
-	}
+	prefix := recordPrefix(r.agentInfo, r.msg.Subject)
 
 	b.WriteString(styles.Prefix.Render(prefix))
 
@@ -75,7 +70,16 @@ func (r *LogFmtRecord) Write(file *os.File) (n int, err error) {
 	}
 
 	b.WriteByte('\n')
-	return file.Write(b.Bytes())
+	return w.Write(b.Bytes())
+}
+
+func (r *LogFmtRecord) Entry() (entry Entry, err error) {
+	entry = newEntry(r.agentInfo, r.msg)
+	entry.Time = r.Timestamp
+	entry.Level = r.Level.String()
+	entry.Message = r.Text
+	entry.Fields = r.Meta
+	return
 }
 
 func levelStyle(level log.Level) lipgloss.Style {
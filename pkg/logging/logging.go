@@ -1,7 +1,13 @@
 package logging
 
 import (
-	"os"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/numtide/nits/pkg/agent/info"
+	"github.com/numtide/nits/pkg/subject"
 
 	"github.com/nats-io/nats.go"
 )
@@ -9,12 +15,54 @@ import (
 type RecordType int
 
 const (
-	RecordTerm   = iota
-	RecordLogFmt = 1
+	RecordTerm    = iota
+	RecordLogFmt  = 1
+	RecordJournal = 2
 )
 
 type Record interface {
 	Type() RecordType
 	Msg() *nats.Msg
-	Write(file *os.File) (n int, err error)
+	Write(w io.Writer) (n int, err error)
+	Entry() (Entry, error)
+}
+
+// Entry is a structured representation of a record, suitable for forwarding to other systems or encoding as JSON.
+type Entry struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level,omitempty"`
+	Agent   string            `json:"agent,omitempty"`
+	NKey    string            `json:"nkey"`
+	Subject string            `json:"subject"`
+	Source  string            `json:"source"`
+	Message string            `json:"msg"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+func newEntry(agentInfo *info.Response, msg *nats.Msg) Entry {
+	nkey := subject.AgentNKeyForSubject(msg.Subject)
+	entry := Entry{
+		NKey:    nkey,
+		Subject: msg.Subject,
+		Source:  relativeSubject(nkey, msg.Subject),
+	}
+	if agentInfo != nil {
+		entry.Agent = agentInfo.Name
+	}
+	return entry
+}
+
+// recordPrefix returns the subject of a record relative to the agent which produced it, prefixed with the agent's name.
+func recordPrefix(agentInfo *info.Response, subj string) string {
+	if agentInfo == nil {
+		return subj
+	}
+
+	return fmt.Sprintf("%s | %s", agentInfo.Name, relativeSubject(agentInfo.NKey, subj))
+}
+
+// relativeSubject strips the log or output prefix for an agent from subj e.g. NITS.AGENT.<nkey>.LOG.SYS becomes SYS.
+func relativeSubject(nkey string, subj string) string {
+	relative := strings.TrimPrefix(subj, subject.AgentLogs(nkey)+".")
+	return strings.TrimPrefix(relative, subject.AgentOutput(nkey)+".")
 }
@@ -0,0 +1,106 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/errors"
+	nlog "github.com/numtide/nits/pkg/logging"
+)
+
+// File writes entries as json lines, rotating the file once it exceeds MaxSize. Rotated files are suffixed with an
+// index e.g. nits.log.1, with at most MaxBackups being retained.
+type File struct {
+	Path       string
+	MaxSize    int64
+	MaxBackups int
+
+	file *os.File
+	size int64
+}
+
+func NewFile(path string, maxSize int64, maxBackups int) (*File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, errors.Annotate(err, "failed to create log directory")
+	}
+
+	f := &File{
+		Path:       path,
+		MaxSize:    maxSize,
+		MaxBackups: maxBackups,
+	}
+
+	return f, f.open()
+}
+
+func (f *File) Send(_ context.Context, entries []nlog.Entry) (err error) {
+	for _, entry := range entries {
+		var b []byte
+		if b, err = json.Marshal(entry); err != nil {
+			return
+		}
+		b = append(b, '\n')
+
+		if f.MaxSize > 0 && f.size > 0 && f.size+int64(len(b)) > f.MaxSize {
+			if err = f.rotate(); err != nil {
+				return errors.Annotate(err, "failed to rotate log file")
+			}
+		}
+
+		var n int
+		n, err = f.file.Write(b)
+		f.size += int64(n)
+		if err != nil {
+			return
+		}
+	}
+
+	return f.file.Sync()
+}
+
+func (f *File) Close() error {
+	return f.file.Close()
+}
+
+func (f *File) open() (err error) {
+	if f.file, err = os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+		return
+	}
+
+	var info os.FileInfo
+	if info, err = f.file.Stat(); err != nil {
+		return
+	}
+	f.size = info.Size()
+	return
+}
+
+func (f *File) rotate() (err error) {
+	if err = f.file.Close(); err != nil {
+		return
+	}
+
+	// shift existing backups along, discarding the oldest
+	for idx := f.MaxBackups; idx > 0; idx-- {
+		src := f.Path
+		if idx > 1 {
+			src = fmt.Sprintf("%s.%d", f.Path, idx-1)
+		}
+		dst := fmt.Sprintf("%s.%d", f.Path, idx)
+
+		if err = os.Rename(src, dst); err != nil && !os.IsNotExist(err) {
+			return
+		}
+	}
+
+	if f.MaxBackups == 0 {
+		if err = os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+			return
+		}
+	}
+
+	return f.open()
+}
@@ -0,0 +1,149 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logfmt/logfmt"
+	"github.com/juju/errors"
+	nlog "github.com/numtide/nits/pkg/logging"
+)
+
+const lokiPushPath = "/loki/api/v1/push"
+
+// Loki pushes entries to a Loki compatible http endpoint. Entries are grouped into streams labelled with the agent,
+// the level and the source of the entry e.g. SYS or JOURNAL. Remaining fields are encoded into the line as logfmt.
+type Loki struct {
+	Url      string
+	TenantId string
+	Client   *http.Client
+}
+
+type lokiPushRequest struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func NewLoki(url string, tenantId string) *Loki {
+	return &Loki{
+		Url:      strings.TrimSuffix(url, "/"),
+		TenantId: tenantId,
+		Client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (l *Loki) Send(ctx context.Context, entries []nlog.Entry) (err error) {
+	streams := make(map[string]*lokiStream)
+
+	for _, entry := range entries {
+		labels := map[string]string{
+			"job":    "nits",
+			"agent":  entry.Agent,
+			"nkey":   entry.NKey,
+			"level":  entry.Level,
+			"source": strings.SplitN(entry.Source, ".", 2)[0],
+		}
+
+		// loki does not accept empty label values
+		for k, v := range labels {
+			if v == "" {
+				delete(labels, k)
+			}
+		}
+
+		key := fmt.Sprint(labels)
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{Stream: labels}
+			streams[key] = stream
+		}
+
+		var line string
+		if line, err = lokiLine(entry); err != nil {
+			return
+		}
+
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(entry.Time.UnixNano(), 10), line})
+	}
+
+	var req lokiPushRequest
+	for _, stream := range streams {
+		req.Streams = append(req.Streams, *stream)
+	}
+
+	var body []byte
+	if body, err = json.Marshal(req); err != nil {
+		return
+	}
+
+	var httpReq *http.Request
+	if httpReq, err = http.NewRequestWithContext(ctx, http.MethodPost, l.Url+lokiPushPath, bytes.NewReader(body)); err != nil {
+		return
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	if l.TenantId != "" {
+		httpReq.Header.Set("X-Scope-OrgID", l.TenantId)
+	}
+
+	var resp *http.Response
+	if resp, err = l.Client.Do(httpReq); err != nil {
+		return errors.Annotate(err, "failed to push to loki")
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("failed to push to loki: %s: %s", resp.Status, string(msg))
+	}
+
+	return
+}
+
+func (l *Loki) Close() error {
+	return nil
+}
+
+func lokiLine(entry nlog.Entry) (string, error) {
+	b := bytes.NewBuffer(nil)
+	enc := logfmt.NewEncoder(b)
+
+	if err := enc.EncodeKeyval("msg", entry.Message); err != nil {
+		return "", err
+	}
+	if err := enc.EncodeKeyval("subject", entry.Subject); err != nil {
+		return "", err
+	}
+
+	var keys []string
+	for k := range entry.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err := enc.EncodeKeyval(k, entry.Fields[k]); err != nil {
+			return "", err
+		}
+	}
+
+	if err := enc.EndRecord(); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
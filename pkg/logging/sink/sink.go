@@ -0,0 +1,47 @@
+package sink
+
+import (
+	"context"
+
+	nlog "github.com/numtide/nits/pkg/logging"
+)
+
+// Sink receives log entries forwarded from the agent logs stream.
+type Sink interface {
+	// Send delivers a batch of entries. An error indicates none of the batch should be considered delivered.
+	Send(ctx context.Context, entries []nlog.Entry) error
+	Close() error
+}
+
+// Multi sends each batch to all of its sinks. Delivery is tracked per sink, so that a batch which fails for one sink
+// can be retried for that sink alone, without the others receiving it again.
+type Multi []Sink
+
+// Send delivers a batch to every sink, returning the first error encountered.
+func (m Multi) Send(ctx context.Context, entries []nlog.Entry) error {
+	_, err := m.SendEach(ctx, entries)
+	return err
+}
+
+// SendEach delivers a batch to every sink, returning those which failed along with the first error encountered. A
+// retry should only be made with the sinks which failed.
+func (m Multi) SendEach(ctx context.Context, entries []nlog.Entry) (failed Multi, err error) {
+	for _, sink := range m {
+		if sendErr := sink.Send(ctx, entries); sendErr != nil {
+			failed = append(failed, sink)
+			if err == nil {
+				err = sendErr
+			}
+		}
+	}
+	return
+}
+
+func (m Multi) Close() (err error) {
+	for _, sink := range m {
+		if closeErr := sink.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return
+}
@@ -0,0 +1,156 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/juju/errors"
+	nlog "github.com/numtide/nits/pkg/logging"
+)
+
+const (
+	// syslogEnterpriseId is used to identify our structured data element. It is the example enterprise number
+	// reserved for documentation, until such time as we have a registered one.
+	syslogEnterpriseId = 32473
+
+	// FacilityLocal0 is the default syslog facility used when forwarding.
+	FacilityLocal0 = 16
+)
+
+// Syslog forwards entries to a syslog server in RFC5424 format, over either udp or tcp. Messages sent over tcp are
+// framed using octet counting as described in RFC6587.
+type Syslog struct {
+	Network  string
+	Address  string
+	Facility int
+
+	conn net.Conn
+}
+
+func NewSyslog(network string, address string, facility int) (*Syslog, error) {
+	if !(network == "udp" || network == "tcp") {
+		return nil, errors.Errorf("unsupported syslog network: %s", network)
+	}
+	return &Syslog{
+		Network:  network,
+		Address:  address,
+		Facility: facility,
+	}, nil
+}
+
+func (s *Syslog) Send(ctx context.Context, entries []nlog.Entry) (err error) {
+	if s.conn == nil {
+		var dialer net.Dialer
+		if s.conn, err = dialer.DialContext(ctx, s.Network, s.Address); err != nil {
+			return errors.Annotate(err, "failed to connect to syslog server")
+		}
+	}
+
+	for _, entry := range entries {
+		msg := s.format(entry)
+		if s.Network == "tcp" {
+			msg = fmt.Sprintf("%d %s", len(msg), msg)
+		}
+
+		if _, err = s.conn.Write([]byte(msg)); err != nil {
+			// force a reconnect on the next attempt
+			_ = s.conn.Close()
+			s.conn = nil
+			return errors.Annotate(err, "failed to write to syslog server")
+		}
+	}
+
+	return
+}
+
+func (s *Syslog) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+func (s *Syslog) format(entry nlog.Entry) string {
+	hostname := syslogToken(entry.Agent, 255)
+	if entry.Agent == "" {
+		hostname = syslogToken(entry.NKey, 255)
+	}
+
+	var sd strings.Builder
+	sd.WriteString(fmt.Sprintf("[nits@%d", syslogEnterpriseId))
+	sd.WriteString(fmt.Sprintf(` nkey="%s"`, syslogParamValue(entry.NKey)))
+	sd.WriteString(fmt.Sprintf(` subject="%s"`, syslogParamValue(entry.Subject)))
+
+	var keys []string
+	for k := range entry.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		sd.WriteString(fmt.Sprintf(` %s="%s"`, syslogToken(k, 32), syslogParamValue(entry.Fields[k])))
+	}
+	sd.WriteString("]")
+
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	return fmt.Sprintf("<%d>1 %s %s nits - %s %s %s\n",
+		s.Facility*8+syslogSeverity(entry.Level),
+		entry.Time.UTC().Format(time.RFC3339Nano),
+		hostname,
+		syslogToken(strings.SplitN(entry.Source, ".", 2)[0], 32),
+		sd.String(),
+		entry.Message,
+	)
+}
+
+func syslogSeverity(level string) int {
+	parsed, err := log.ParseLevel(level)
+	if err != nil {
+		// notice
+		return 5
+	}
+
+	switch parsed {
+	case log.DebugLevel:
+		return 7
+	case log.InfoLevel:
+		return 6
+	case log.WarnLevel:
+		return 4
+	case log.ErrorLevel:
+		return 3
+	default:
+		return 2
+	}
+}
+
+// syslogToken ensures str is a valid header field or parameter name, which must be printable ascii without spaces,
+// '=', ']' or '"', and within the maximum length for the field.
+func syslogToken(str string, maxLen int) string {
+	if str == "" {
+		return "-"
+	}
+
+	token := strings.Map(func(r rune) rune {
+		if r <= 32 || r >= 127 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, str)
+
+	if len(token) > maxLen {
+		token = token[:maxLen]
+	}
+	return token
+}
+
+var syslogParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func syslogParamValue(str string) string {
+	return syslogParamEscaper.Replace(str)
+}
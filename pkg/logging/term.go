@@ -3,12 +3,11 @@ package logging
 import (
 	"bytes"
 	"context"
-	"fmt"
-	"os"
-	"strings"
+	"io"
 	"time"
 
 	"github.com/numtide/nits/pkg/agent/info"
+	nnats "github.com/numtide/nits/pkg/nats"
 	"github.com/numtide/nits/pkg/subject"
 
 	"github.com/charmbracelet/log"
@@ -28,24 +27,20 @@ func (t *TerminalRecord) Msg() *nats.Msg {
 	return t.msg
 }
 
-func (t *TerminalRecord) Write(file *os.File) (n int, err error) {
+func (t *TerminalRecord) Write(w io.Writer) (n int, err error) {
 	b := bytes.NewBuffer(nil)
 
-	var meta *nats.MsgMetadata
-	if meta, err = t.msg.Metadata(); err != nil {
+	var timestamp time.Time
+	if timestamp, err = nnats.MsgTimestamp(t.msg); err != nil {
 		return
 	}
 
 	styles := log.DefaultStyles()
 
-	b.WriteString(styles.Timestamp.Render(meta.Timestamp.Format(time.RFC3339)))
+	b.WriteString(styles.Timestamp.Render(timestamp.Format(time.RFC3339)))
 	b.WriteByte(' ')
 
-	// by default the prefix is just the msg subject
-	prefix := t.msg.Subject
-	if t.agentInfo != nil {
-		prefix = fmt.Sprintf("%s | %s", t.agentInfo.Name, strings.TrimPrefix(t.msg.Subject, subject.AgentLogs(t.agentInfo.NKey)+"."))
-	}
+	prefix := recordPrefix(t.agentInfo, t.msg.Subject)
 
 	b.WriteString(styles.Prefix.Render(prefix))
 	b.WriteString("\n")
@@ -53,7 +48,14 @@ func (t *TerminalRecord) Write(file *os.File) (n int, err error) {
 	b.WriteByte(' ')
 
 	b.WriteString("\n")
-	return file.Write(b.Bytes())
+	return w.Write(b.Bytes())
+}
+
+func (t *TerminalRecord) Entry() (entry Entry, err error) {
+	entry = newEntry(t.agentInfo, t.msg)
+	entry.Message = string(t.msg.Data)
+	entry.Time, err = nnats.MsgTimestamp(t.msg)
+	return
 }
 
 func UnmarshalTerminalRecord(ctx context.Context, msg *nats.Msg, record *TerminalRecord) (err error) {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/juju/errors"
@@ -33,6 +34,10 @@ type Writer struct {
 	Conn    *nats.Conn
 	Subject string
 	Headers nats.Header
+
+	// Spool is optional. When set, messages which cannot be published whilst disconnected are spooled to disk
+	// rather than dropped.
+	Spool *Spool
 }
 
 func (w *Writer) newMsg() *nats.Msg {
@@ -45,17 +50,31 @@ func (w *Writer) newMsg() *nats.Msg {
 	return msg
 }
 
+func (w *Writer) publish(msg *nats.Msg) (err error) {
+	if w.Spool == nil {
+		return w.Conn.PublishMsg(msg)
+	}
+
+	if w.Conn.IsConnected() {
+		if err = w.Conn.PublishMsg(msg); err == nil {
+			return
+		}
+	}
+
+	return w.Spool.Append(msg)
+}
+
 func (w *Writer) Close() (err error) {
 	msg := w.newMsg()
 	msg.Header.Set(EOS, EOSValue)
-	return w.Conn.PublishMsg(msg)
+	return w.publish(msg)
 }
 
 func (w *Writer) Write(p []byte) (n int, err error) {
 	msg := w.newMsg()
 	msg.Data = p
 	n = len(p)
-	if err = w.Conn.PublishMsg(msg); err != nil {
+	if err = w.publish(msg); err != nil && w.Spool == nil {
 		log.Error("failed to publish message", "subject", w.Subject)
 	}
 	return
@@ -116,6 +135,20 @@ func (r *Reader) processSubscription() {
 	}
 }
 
+// MsgTimestamp returns the time at which msg was originally written, falling back to the time at which it was
+// stored in JetStream.
+func MsgTimestamp(msg *nats.Msg) (time.Time, error) {
+	if value := msg.Header.Get(HeaderTimestamp); value != "" {
+		return time.Parse(time.RFC3339Nano, value)
+	}
+
+	meta, err := msg.Metadata()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return meta.Timestamp, nil
+}
+
 func IsEndOfStream(msg *nats.Msg) (result bool, err error) {
 	if msg == nil {
 		err = errors.New("msg cannot be nil")
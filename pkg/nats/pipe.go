@@ -0,0 +1,229 @@
+package nats
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// HeaderPipe identifies the type of message sent between the ends of a pipe.
+	HeaderPipe = "Nits-Pipe"
+	// HeaderPipeCredit is the number of bytes the sender of a credit message is prepared to receive.
+	HeaderPipeCredit = "Nits-Pipe-Credit"
+
+	pipeData      = "data"
+	pipeCredit    = "credit"
+	pipeKeepalive = "keepalive"
+	pipeClose     = "close"
+
+	// DefaultPipeWindow is the number of bytes which may be in flight before a writer must wait for the reader at
+	// the other end of a pipe to catch up.
+	DefaultPipeWindow = 256 * 1024
+
+	pipeChunkSize = 32 * 1024
+)
+
+var ErrPipeClosed = errors.New("pipe closed")
+
+// Pipe is one end of a bidirectional byte stream over NATS. Each end receives on its own subject and publishes to the
+// subject of the other end.
+//
+// Flow control is credit based: each end starts with a window of credit and may only send that many bytes before the
+// other end grants more, which it does as the data is read. Both ends must use the same window.
+type Pipe struct {
+	conn   *nats.Conn
+	sub    *nats.Subscription
+	remote string
+	window int
+
+	lock         sync.Mutex
+	cond         *sync.Cond
+	buf          bytes.Buffer
+	credit       int
+	consumed     int
+	remoteClosed bool
+	closed       bool
+	lastActivity time.Time
+	done         chan struct{}
+}
+
+// NewPipe subscribes to local and returns a pipe which writes to remote. The subscription should be in place before the
+// other end starts writing, otherwise data may be lost.
+func NewPipe(conn *nats.Conn, local string, remote string, window int) (p *Pipe, err error) {
+	if window <= 0 {
+		window = DefaultPipeWindow
+	}
+
+	p = &Pipe{
+		conn:         conn,
+		remote:       remote,
+		window:       window,
+		credit:       window,
+		lastActivity: time.Now(),
+		done:         make(chan struct{}),
+	}
+	p.cond = sync.NewCond(&p.lock)
+
+	if p.sub, err = conn.Subscribe(local, p.onMsg); err != nil {
+		return nil, errors.Annotatef(err, "failed to subscribe to %s", local)
+	}
+	return
+}
+
+func (p *Pipe) onMsg(msg *nats.Msg) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		return
+	}
+
+	switch msg.Header.Get(HeaderPipe) {
+	case pipeData:
+		p.buf.Write(msg.Data)
+		p.lastActivity = time.Now()
+	case pipeCredit:
+		if credit, err := strconv.Atoi(msg.Header.Get(HeaderPipeCredit)); err == nil && credit > 0 {
+			p.credit += credit
+		}
+	case pipeKeepalive:
+		p.lastActivity = time.Now()
+	case pipeClose:
+		if !p.remoteClosed {
+			p.remoteClosed = true
+			close(p.done)
+		}
+	default:
+		return
+	}
+
+	p.cond.Broadcast()
+}
+
+// Read blocks until data is available, returning io.EOF once the other end has closed and all data has been read.
+func (p *Pipe) Read(b []byte) (n int, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for p.buf.Len() == 0 {
+		if p.closed {
+			return 0, ErrPipeClosed
+		} else if p.remoteClosed {
+			return 0, io.EOF
+		}
+		p.cond.Wait()
+	}
+
+	n, _ = p.buf.Read(b)
+
+	// grant more credit once half the window has been consumed, avoiding a message for every read
+	p.consumed += n
+	if p.consumed >= p.window/2 && !p.remoteClosed {
+		msg := p.newMsg(pipeCredit)
+		msg.Header.Set(HeaderPipeCredit, strconv.Itoa(p.consumed))
+		if err = p.conn.PublishMsg(msg); err != nil {
+			return
+		}
+		p.consumed = 0
+	}
+
+	return
+}
+
+// Write blocks until all of b has been sent or the pipe has been closed, waiting for credit from the other end as
+// required.
+func (p *Pipe) Write(b []byte) (n int, err error) {
+	for len(b) > 0 {
+		p.lock.Lock()
+		for p.credit == 0 && !p.closed && !p.remoteClosed {
+			p.cond.Wait()
+		}
+		if p.closed || p.remoteClosed {
+			p.lock.Unlock()
+			return n, ErrPipeClosed
+		}
+
+		size := min(len(b), p.credit, pipeChunkSize)
+		p.credit -= size
+		p.lock.Unlock()
+
+		msg := p.newMsg(pipeData)
+		msg.Data = b[:size]
+		if err = p.conn.PublishMsg(msg); err != nil {
+			return
+		}
+
+		n += size
+		b = b[size:]
+	}
+	return
+}
+
+// Close notifies the other end and releases the subscription. Any blocked reads or writes return ErrPipeClosed.
+func (p *Pipe) Close() error {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return nil
+	}
+	p.closed = true
+	if !p.remoteClosed {
+		close(p.done)
+	}
+	p.cond.Broadcast()
+	p.lock.Unlock()
+
+	// there is no point telling the other end if it has already gone
+	var err error
+	if !p.RemoteClosed() {
+		err = p.conn.PublishMsg(p.newMsg(pipeClose))
+	}
+
+	if unsubErr := p.sub.Unsubscribe(); err == nil {
+		err = unsubErr
+	}
+	return err
+}
+
+// Keepalive tells the other end this end is still present, which it records as activity.
+func (p *Pipe) Keepalive() error {
+	p.lock.Lock()
+	closed := p.closed || p.remoteClosed
+	p.lock.Unlock()
+
+	if closed {
+		return ErrPipeClosed
+	}
+	return p.conn.PublishMsg(p.newMsg(pipeKeepalive))
+}
+
+// Done is closed when either end of the pipe has been closed.
+func (p *Pipe) Done() <-chan struct{} {
+	return p.done
+}
+
+// RemoteClosed returns true if the other end has closed the pipe.
+func (p *Pipe) RemoteClosed() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.remoteClosed
+}
+
+// LastActivity returns when data or a keepalive was last received from the other end.
+func (p *Pipe) LastActivity() time.Time {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.lastActivity
+}
+
+func (p *Pipe) newMsg(kind string) *nats.Msg {
+	msg := nats.NewMsg(p.remote)
+	msg.Header.Set(HeaderPipe, kind)
+	return msg
+}
@@ -0,0 +1,335 @@
+package nats
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+)
+
+const (
+	// HeaderTimestamp records when a message was originally written, which can differ from when it was stored in
+	// JetStream if it was spooled whilst disconnected.
+	HeaderTimestamp = "Nits-Timestamp"
+
+	segmentPrefix = "segment-"
+	segmentSuffix = ".jsonl"
+	// offsetSuffix is appended to the path of a segment to record how far through it replay has progressed.
+	offsetSuffix = ".offset"
+
+	// replayBatch is how many messages are published between recording progress through a segment.
+	replayBatch = 100
+
+	defaultSegmentSize = 1024 * 1024
+)
+
+type spooledMsg struct {
+	Subject string      `json:"subject"`
+	Header  nats.Header `json:"header"`
+	Data    []byte      `json:"data"`
+	Time    time.Time   `json:"time"`
+}
+
+// Spool is a disk-backed buffer for messages which could not be published whilst disconnected.
+// Messages are appended to segment files within Dir which are replayed and removed once the connection returns.
+// The oldest segments are discarded when the spool grows beyond MaxBytes or when they are older than MaxAge.
+//
+// Progress through each segment is recorded as it is replayed, so that a replay which is interrupted resumes where it
+// left off rather than publishing the whole segment again. At most replayBatch messages which the server had not yet
+// confirmed receiving may be published twice.
+//
+// A Spool does not log as it typically sits beneath the log output of the agent.
+type Spool struct {
+	Dir         string
+	MaxBytes    int64
+	MaxAge      time.Duration
+	SegmentSize int64
+
+	lock    sync.Mutex
+	current *os.File
+	size    int64
+}
+
+func NewSpool(dir string, maxBytes int64, maxAge time.Duration) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, errors.Annotate(err, "failed to create spool directory")
+	}
+	return &Spool{
+		Dir:         dir,
+		MaxBytes:    maxBytes,
+		MaxAge:      maxAge,
+		SegmentSize: defaultSegmentSize,
+	}, nil
+}
+
+// Append writes msg to the spool. A Nats-Msg-Id header is added if not already present so that replays can be
+// de-duplicated by JetStream, along with a timestamp header recording when the message was written.
+func (s *Spool) Append(msg *nats.Msg) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+
+	now := time.Now()
+	if msg.Header.Get(nats.MsgIdHdr) == "" {
+		msg.Header.Set(nats.MsgIdHdr, nuid.Next())
+	}
+	if msg.Header.Get(HeaderTimestamp) == "" {
+		msg.Header.Set(HeaderTimestamp, now.Format(time.RFC3339Nano))
+	}
+
+	var b []byte
+	if b, err = json.Marshal(spooledMsg{
+		Subject: msg.Subject,
+		Header:  msg.Header,
+		Data:    msg.Data,
+		Time:    now,
+	}); err != nil {
+		return
+	}
+	b = append(b, '\n')
+
+	if s.current == nil || s.size+int64(len(b)) > s.SegmentSize {
+		if err = s.rotate(); err != nil {
+			return
+		} else if err = s.enforceLimits(); err != nil {
+			return
+		}
+	}
+
+	var n int
+	n, err = s.current.Write(b)
+	s.size += int64(n)
+	return
+}
+
+// Replay publishes the contents of the spool in the order it was written, removing segments once they have been
+// published. Messages older than MaxAge or which are malformed are discarded. Segments which were partially replayed
+// before are resumed from the last recorded offset.
+func (s *Spool) Replay(conn *nats.Conn) (count int, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err = s.closeCurrent(); err != nil {
+		return
+	}
+
+	var segments []string
+	if segments, err = s.segments(); err != nil {
+		return
+	}
+
+	var n int
+	for _, segment := range segments {
+		n, err = s.replaySegment(conn, segment)
+		count += n
+		if err != nil {
+			return count, errors.Annotatef(err, "failed to replay spool segment %s", segment)
+		} else if err = removeSegment(segment); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (s *Spool) replaySegment(conn *nats.Conn, path string) (count int, err error) {
+	var offset int64
+	if offset, err = readOffset(path); err != nil {
+		return
+	}
+
+	var file *os.File
+	if file, err = os.Open(path); err != nil {
+		return
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return
+	}
+
+	// progress is only recorded once the server has confirmed receiving everything published before it
+	pending := 0
+	checkpoint := func() error {
+		if err := conn.Flush(); err != nil {
+			return err
+		}
+		pending = 0
+		return writeOffset(path, offset)
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), int(s.SegmentSize)*2)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		offset += int64(len(line)) + 1
+
+		var spooled spooledMsg
+		if json.Unmarshal(line, &spooled) != nil {
+			// a partial write may have occurred if the agent was stopped abruptly
+			continue
+		}
+
+		if s.MaxAge > 0 && time.Since(spooled.Time) > s.MaxAge {
+			continue
+		}
+
+		msg := nats.NewMsg(spooled.Subject)
+		msg.Header = spooled.Header
+		msg.Data = spooled.Data
+
+		if err = conn.PublishMsg(msg); err != nil {
+			return
+		}
+		count++
+
+		if pending++; pending >= replayBatch {
+			if err = checkpoint(); err != nil {
+				return
+			}
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	return count, conn.Flush()
+}
+
+// readOffset returns how far through the segment at path replay has progressed, or zero if it has not been replayed.
+func readOffset(path string) (offset int64, err error) {
+	var b []byte
+	if b, err = os.ReadFile(path + offsetSuffix); errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return
+	}
+
+	if offset, err = strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64); err != nil || offset < 0 {
+		// start from the beginning rather than lose the segment, relying on de-duplication where possible
+		return 0, nil
+	}
+	return
+}
+
+// writeOffset records how far through the segment at path replay has progressed, replacing the previous record
+// atomically.
+func writeOffset(path string, offset int64) (err error) {
+	tmp := path + offsetSuffix + ".tmp"
+	if err = os.WriteFile(tmp, []byte(strconv.FormatInt(offset, 10)), 0o600); err != nil {
+		return
+	}
+	return os.Rename(tmp, path+offsetSuffix)
+}
+
+// removeSegment removes a segment along with any record of replay progress through it.
+func removeSegment(path string) (err error) {
+	if err = os.Remove(path); err != nil {
+		return
+	}
+	if err = os.Remove(path + offsetSuffix); errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	return
+}
+
+func (s *Spool) rotate() (err error) {
+	if err = s.closeCurrent(); err != nil {
+		return
+	}
+
+	name := fmt.Sprintf("%s%020d%s", segmentPrefix, time.Now().UnixNano(), segmentSuffix)
+	if s.current, err = os.OpenFile(filepath.Join(s.Dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600); err != nil {
+		return
+	}
+	s.size = 0
+	return
+}
+
+func (s *Spool) closeCurrent() (err error) {
+	if s.current == nil {
+		return
+	}
+	err = s.current.Close()
+	s.current = nil
+	s.size = 0
+	return
+}
+
+// segments returns the paths of all segments in the spool, oldest first.
+func (s *Spool) segments() (segments []string, err error) {
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(s.Dir); err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !(strings.HasPrefix(name, segmentPrefix) && strings.HasSuffix(name, segmentSuffix)) {
+			continue
+		}
+		segments = append(segments, filepath.Join(s.Dir, name))
+	}
+
+	// segment names are zero-padded timestamps, so lexical ordering is chronological
+	sort.Strings(segments)
+	return
+}
+
+// enforceLimits removes the oldest segments until the spool is within MaxBytes, and removes any segments whose
+// most recent write is older than MaxAge. The segment currently being written to is never removed.
+func (s *Spool) enforceLimits() (err error) {
+	var segments []string
+	if segments, err = s.segments(); err != nil {
+		return
+	}
+
+	var (
+		total int64
+		infos = make([]os.FileInfo, len(segments))
+	)
+
+	for idx, segment := range segments {
+		if infos[idx], err = os.Stat(segment); err != nil {
+			return
+		}
+		total += infos[idx].Size()
+	}
+
+	for idx, segment := range segments {
+		if segment == s.current.Name() {
+			break
+		}
+
+		expired := s.MaxAge > 0 && time.Since(infos[idx].ModTime()) > s.MaxAge
+		oversize := s.MaxBytes > 0 && total > s.MaxBytes
+
+		if !(expired || oversize) {
+			continue
+		}
+
+		if err = removeSegment(segment); err != nil {
+			return
+		}
+		total -= infos[idx].Size()
+	}
+
+	return
+}
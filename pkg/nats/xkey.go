@@ -0,0 +1,99 @@
+package nats
+
+import (
+	"crypto/ed25519"
+	"crypto/sha512"
+	"math/big"
+	"os"
+
+	"github.com/juju/errors"
+	"github.com/nats-io/nkeys"
+	"golang.org/x/crypto/ssh"
+)
+
+// curve25519P is the prime 2^255 - 19 over which both edwards25519 and curve25519 are defined.
+var curve25519P = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+// XKeyForNKey returns the public curve key (xkey) corresponding to a user nkey derived from an ed25519 host key, such
+// that data can be sealed for an agent knowing only its nkey.
+//
+// This is the birational map from the edwards25519 point to its montgomery form, u = (1 + y) / (1 - y), as used by age
+// for ssh-ed25519 recipients.
+func XKeyForNKey(nkey string) (string, error) {
+	raw, err := nkeys.Decode(nkeys.PrefixByteUser, []byte(nkey))
+	if err != nil {
+		return "", errors.Annotate(err, "failed to decode nkey")
+	} else if len(raw) != ed25519.PublicKeySize {
+		return "", errors.NotValidf("nkey length %d", len(raw))
+	}
+
+	// the point is encoded as y in little-endian with the sign of x in the most significant bit
+	le := make([]byte, len(raw))
+	copy(le, raw)
+	le[31] &= 0x7f
+
+	y := new(big.Int).SetBytes(reverse(le))
+
+	one := big.NewInt(1)
+	numerator := new(big.Int).Add(one, y)
+	denominator := new(big.Int).Sub(one, y)
+	denominator.Mod(denominator, curve25519P)
+
+	inverse := new(big.Int).ModInverse(denominator, curve25519P)
+	if inverse == nil {
+		return "", errors.NotValidf("nkey which is not a valid curve point")
+	}
+
+	u := numerator.Mul(numerator, inverse)
+	u.Mod(u, curve25519P)
+
+	out := make([]byte, 32)
+	u.FillBytes(out)
+
+	encoded, err := nkeys.Encode(nkeys.PrefixByteCurve, reverse(out))
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// NewXKeyPair returns the curve key pair (xkey) derived from an ed25519 host key, whose public key matches
+// XKeyForNKey for the host's nkey.
+func NewXKeyPair(path string) (kp nkeys.KeyPair, err error) {
+	var b []byte
+	if b, err = os.ReadFile(path); err != nil {
+		return
+	}
+
+	var key any
+	if key, err = ssh.ParseRawPrivateKey(b); err != nil {
+		return nil, errors.Annotate(err, "failed to parse host key")
+	}
+
+	var private ed25519.PrivateKey
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		private = k
+	case *ed25519.PrivateKey:
+		private = *k
+	default:
+		return nil, errors.NotSupportedf("host key of type %T", key)
+	}
+
+	// the same derivation as for an x25519 private key from an ed25519 seed, clamping is applied when it is used
+	digest := sha512.Sum512(private.Seed())
+
+	var seed []byte
+	if seed, err = nkeys.EncodeSeed(nkeys.PrefixByteCurve, digest[:32]); err != nil {
+		return
+	}
+	return nkeys.FromCurveSeed(seed)
+}
+
+func reverse(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[len(b)-1-i] = b[i]
+	}
+	return out
+}
@@ -0,0 +1,125 @@
+package nats
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nats-io/nkeys"
+	"golang.org/x/crypto/ssh"
+)
+
+// writeHostKey generates an ed25519 host key, writing it to a file in the same format as ssh-keygen.
+func writeHostKey(t *testing.T) string {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(private, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "ssh_host_ed25519_key")
+	if err = os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestXKeyForNKey(t *testing.T) {
+	// the mapping depends on the point, so we check a number of keys
+	for i := 0; i < 16; i++ {
+		path := writeHostKey(t)
+
+		signer, err := NewSigner(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		nkey, err := NKeyForSigner(signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected, err := XKeyForNKey(nkey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kp, err := NewXKeyPair(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual, err := kp.PublicKey()
+		if err != nil {
+			t.Fatal(err)
+		} else if actual != expected {
+			t.Fatalf("public key of %s does not match the xkey for its nkey: %s != %s", path, actual, expected)
+		}
+	}
+}
+
+func TestXKeySealOpen(t *testing.T) {
+	path := writeHostKey(t)
+
+	signer, err := NewSigner(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nkey, err := NKeyForSigner(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recipient, err := XKeyForNKey(nkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender, err := nkeys.CreateCurveKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	senderKey, err := sender.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := []byte("hello world")
+
+	sealed, err := sender.Seal(plaintext, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kp, err := NewXKeyPair(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err := kp.Open(sealed, senderKey)
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(opened, plaintext) {
+		t.Fatalf("opened %q, expected %q", opened, plaintext)
+	}
+
+	// a different host cannot open it
+	other, err := NewXKeyPair(writeHostKey(t))
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err = other.Open(sealed, senderKey); err == nil {
+		t.Fatal("expected a different host key to fail to open the secret")
+	}
+}
@@ -17,6 +17,10 @@ func AgentDeploymentWithNKey(nkey string) string {
 	return fmt.Sprintf("%s.AGENT.%s.DEPLOYMENT", Prefix, nkey)
 }
 
+func AgentDeploymentAll() string {
+	return fmt.Sprintf("%s.AGENT.*.DEPLOYMENT", Prefix)
+}
+
 func AgentWithName(name string) string {
 	return fmt.Sprintf("%s.AGENT.NAME.%s", Prefix, name)
 }
@@ -41,12 +45,51 @@ func AgentLogsAll() string {
 	return fmt.Sprintf("%s.AGENT.*.LOG.>", Prefix)
 }
 
+func AgentOutputAll() string {
+	return fmt.Sprintf("%s.AGENT.*.OUT.>", Prefix)
+}
+
+func AgentMetrics(nkey string) string {
+	return fmt.Sprintf("%s.AGENT.%s.METRICS", Prefix, nkey)
+}
+
+func AgentMetricsAll() string {
+	return fmt.Sprintf("%s.AGENT.*.METRICS", Prefix)
+}
+
 func AgentService(nkey string, name string) string {
 	return fmt.Sprintf("%s.AGENT.%s.SRV.%s", Prefix, nkey, name)
 }
 
+// AgentRegistryBucket is the name of the key value bucket in which agents register themselves, keyed by nkey. Its max
+// age only bounds how long the registrations of agents which have gone away are retained, presence is determined from
+// the online flag and when each registration was last published.
+const AgentRegistryBucket = "agent-registry"
+
+// AgentGroupsBucket is the name of the key value bucket which records the groups and labels assigned to each agent,
+// keyed by nkey.
+const AgentGroupsBucket = "agent-groups"
+
+// AgentConfigBucket is the name of the key value bucket which holds settings applied to agents whilst they are
+// running, keyed by nkey, with defaults for every agent under "default".
+const AgentConfigBucket = "agent-config"
+
+// AgentSecretsBucket is the name of the key value bucket which holds secrets sealed for each agent, keyed by
+// <nkey>.<name>.
+const AgentSecretsBucket = "agent-secrets"
+
+// AgentFilesBucketPrefix prefixes the name of the object store each agent uses to transfer files.
+const AgentFilesBucketPrefix = "agent-files-"
+
+// AgentFilesBucket returns the name of the object store used to transfer files to and from the agent with the given
+// nkey. Each agent has its own, so that it cannot read or tamper with the transfers of another.
+func AgentFilesBucket(nkey string) string {
+	return AgentFilesBucketPrefix + nkey
+}
+
+// AgentRegistry is the subject prefix used by the agent registry bucket.
 func AgentRegistry() string {
-	return fmt.Sprintf("%s.AGENT_REGISTRY", Prefix)
+	return fmt.Sprintf("$KV.%s", AgentRegistryBucket)
 }
 
 func AgentRegistration(nkey string) string {
@@ -62,3 +105,17 @@ func AgentNKeyForSubject(subject string) string {
 	end := start + 56 // nkey is 56 characters long
 	return subject[start:end]
 }
+
+func AgentJournal(nkey string, unit string) string {
+	return fmt.Sprintf("%s.JOURNAL.%s", AgentLogs(nkey), Token(unit))
+}
+
+// AgentShell is the subject prefix for an interactive shell session with an agent.
+func AgentShell(nkey string, id string) string {
+	return fmt.Sprintf("%s.AGENT.%s.SHELL.%s", Prefix, nkey, id)
+}
+
+// AgentForward is the subject prefix for a single forwarded connection through an agent.
+func AgentForward(nkey string, id string) string {
+	return fmt.Sprintf("%s.AGENT.%s.FORWARD.%s", Prefix, nkey, id)
+}
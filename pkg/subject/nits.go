@@ -1,7 +1,27 @@
 package subject
 
+import "strings"
+
 const (
 	DefaultPrefix = "NITS"
 )
 
 var Prefix = DefaultPrefix
+
+// tokenReplacer replaces characters which are not valid within a single subject token.
+var tokenReplacer = strings.NewReplacer(
+	".", "_",
+	"*", "_",
+	">", "_",
+	" ", "_",
+	"\t", "_",
+)
+
+// Token converts an arbitrary string into something which can be used as a single subject token,
+// e.g. nginx.service becomes nginx_service.
+func Token(str string) string {
+	if str == "" {
+		return "_"
+	}
+	return tokenReplacer.Replace(str)
+}